@@ -0,0 +1,257 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// Imp typesets a marked up text file and writes it as PDF document.
+//
+// Usage:
+//
+//	imp [flags] file
+//
+// Files with the extension .md or .markdown are read as Markdown. The
+// document is written to standard output unless the -o flag is given.
+// The fonts normal, bold, italic and light are loaded from the font
+// directory. Additional fonts, which are selected with the macro \name, can
+// be loaded with -font name=path. Words are hyphenated with English patterns
+// unless TeX patterns for the language are loaded with -patterns lang=path,
+// e.g. -patterns de=hyph-de-1996.pat.txt. Hyphenation exceptions are read
+// from the corresponding .hyp.txt file if it exists. Characters without a
+// glyph in the selected font are taken from the fonts given with -fallback.
+//
+// Problems in the text, like unknown macros, overfull lines or missing
+// glyphs, are reported on standard error with their position. The document
+// is written anyway and the exit status is 0, unless the -strict flag is
+// given, which makes imp exit with status 1 after reporting them.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tux21b/imp/imp"
+	"github.com/tux21b/imp/imp/otf"
+	"github.com/tux21b/imp/imp/text"
+)
+
+var (
+	output    = flag.String("o", "", "write the PDF document to `file` instead of stdout")
+	fontDir   = flag.String("fontdir", "fonts", "load the default fonts from `dir`")
+	title     = flag.String("title", "", "title of the document")
+	imgPath   = flag.String("image", "", "place the image `file` at the bottom of the first page")
+	compress  = flag.Bool("compress", true, "compress the streams of the document")
+	pdf15     = flag.Bool("objstm", false, "write a PDF 1.5 document with object streams")
+	strict    = flag.Bool("strict", false, "exit with status 1 if problems in the text are reported")
+	fonts     = pathFlag{}
+	patterns  = pathFlag{}
+	fallbacks listFlag
+)
+
+// defaultFonts are the file names of the fonts which are loaded from the
+// font directory.
+var defaultFonts = map[string]string{
+	"normal": "SourceSansPro-Regular.otf",
+	"bold":   "SourceSansPro-Bold.otf",
+	"italic": "SourceSansPro-It.otf",
+	"light":  "SourceSansPro-Light.otf",
+}
+
+// pathFlag collects the files given with -font name=path or
+// -patterns lang=path.
+type pathFlag map[string]string
+
+func (f pathFlag) String() string {
+	return ""
+}
+
+func (f pathFlag) Set(v string) error {
+	i := strings.Index(v, "=")
+	if i <= 0 || i == len(v)-1 {
+		return fmt.Errorf("expected name=path, got %q", v)
+	}
+	f[v[:i]] = v[i+1:]
+	return nil
+}
+
+// listFlag collects the values of a flag which may be repeated.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: imp [flags] file\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Var(fonts, "font", "load the font `name=path`, may be repeated")
+	flag.Var(patterns, "patterns", "load the hyphenation patterns `lang=path`, may be repeated")
+	flag.Var(&fallbacks, "fallback", "use the font `file` for missing characters, may be repeated")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+	}
+	if err := run(flag.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "imp: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(path string) error {
+	input, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for lang, path := range patterns {
+		if err := loadPatterns(lang, path); err != nil {
+			return err
+		}
+	}
+
+	doc := imp.NewDocument()
+	doc.Title = *title
+	doc.Compress = *compress
+	doc.ObjectStreams = *pdf15
+	if err := loadFonts(doc); err != nil {
+		return err
+	}
+	if *imgPath != "" {
+		if doc.Image, err = loadImage(*imgPath); err != nil {
+			return err
+		}
+	}
+	switch filepath.Ext(path) {
+	case ".md", ".markdown":
+		doc.AddMarkdown(path, string(input))
+	default:
+		doc.AddFile(path, string(input))
+	}
+
+	if *output == "" || *output == "-" {
+		out := bufio.NewWriter(os.Stdout)
+		err = doc.Render(out)
+		if err == nil {
+			err = out.Flush()
+		}
+	} else {
+		err = writeFile(*output, doc)
+	}
+	for _, d := range doc.Diagnostics {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", doc.Position(d.Pos), d.Message)
+	}
+	if err == nil && *strict && len(doc.Diagnostics) > 0 {
+		err = fmt.Errorf("%s: problems reported with -strict", path)
+	}
+	return err
+}
+
+// loadFonts adds the default fonts, the fonts given on the command line and
+// the fallback fonts to the document. Default fonts which are missing in
+// the font directory are skipped, except for the normal font, unless it is
+// given explicitly.
+func loadFonts(doc *imp.Document) error {
+	for name, file := range defaultFonts {
+		if _, ok := fonts[name]; ok {
+			continue
+		}
+		path := filepath.Join(*fontDir, file)
+		if _, err := os.Stat(path); os.IsNotExist(err) && name != "normal" {
+			continue
+		}
+		if err := loadFont(doc, name, path); err != nil {
+			return err
+		}
+	}
+	for name, path := range fonts {
+		if err := loadFont(doc, name, path); err != nil {
+			return err
+		}
+	}
+	for _, path := range fallbacks {
+		f, err := otf.Open(path)
+		if err != nil {
+			return fmt.Errorf("fallback font: %v", err)
+		}
+		doc.Fallbacks = append(doc.Fallbacks, f)
+	}
+	return nil
+}
+
+func loadFont(doc *imp.Document, name, path string) error {
+	f, err := otf.Open(path)
+	if err != nil {
+		return fmt.Errorf("font %s: %v", name, err)
+	}
+	doc.AddFont(name, f)
+	return nil
+}
+
+// loadPatterns registers the hyphenation patterns of a language and the
+// exceptions of the corresponding .hyp.txt file.
+func loadPatterns(lang, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h, err := text.ReadHyphenator(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if strings.HasSuffix(path, ".pat.txt") {
+		hyp := strings.TrimSuffix(path, ".pat.txt") + ".hyp.txt"
+		if f, err := os.Open(hyp); err == nil {
+			defer f.Close()
+			if err := h.ReadExceptions(f); err != nil {
+				return fmt.Errorf("%s: %v", hyp, err)
+			}
+		}
+	}
+	text.RegisterHyphenator(lang, h)
+	return nil
+}
+
+func loadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return img, nil
+}
+
+// writeFile renders the document to the file path. The file is removed if
+// the document can not be rendered.
+func writeFile(path string, doc *imp.Document) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = doc.Render(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildImp builds the command into a temporary directory.
+func buildImp(t *testing.T) (dir, bin string) {
+	if testing.Short() {
+		t.Skip("skipping the build of the command in short mode")
+	}
+	dir, err := ioutil.TempDir("", "imp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin = filepath.Join(dir, "imp")
+	if out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return dir, bin
+}
+
+func TestCommand(t *testing.T) {
+	dir, bin := buildImp(t)
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "example.pdf")
+	var stderr bytes.Buffer
+	cmd := exec.Command(bin, "-fontdir", "../../fonts", "-image", "../../buddy.jpg",
+		"-title", "Example", "-strict", "-o", out, "../../example.imp")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("imp example.imp: %v\n%s", err, stderr.Bytes())
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Errorf("the output is not a PDF document: %.20q...%q", data, data[len(data)-10:])
+	}
+	for _, want := range []string{"/Title (Example)", "/Subtype /Image", "SourceSansPro-Bold"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("the output does not contain %q", want)
+		}
+	}
+
+	// problems in the text are reported, but only fail with -strict
+	src := filepath.Join(dir, "unknown.imp")
+	if err := ioutil.WriteFile(src, []byte("Hello\n{World\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, strict := range []bool{false, true} {
+		args := []string{"-fontdir", "../../fonts", "-o", out, src}
+		if strict {
+			args = append([]string{"-strict"}, args...)
+		}
+		os.Remove(out)
+		stderr.Reset()
+		cmd := exec.Command(bin, args...)
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		if (err != nil) != strict {
+			t.Errorf("strict %v: got %v", strict, err)
+		}
+		if want := src + ":2:1: unclosed {\n"; !strings.HasPrefix(stderr.String(), want) {
+			t.Errorf("strict %v: got %q, want %q", strict, stderr.String(), want)
+		}
+		if _, err := os.Stat(out); err != nil {
+			t.Errorf("strict %v: the document is not written: %v", strict, err)
+		}
+	}
+}
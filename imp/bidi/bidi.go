@@ -0,0 +1,642 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// Package bidi implements the Unicode Bidirectional Algorithm (UAX #9)
+// which determines the order of mixed left-to-right and right-to-left text.
+package bidi
+
+// A Class is the bidirectional character type of a rune.
+type Class uint8
+
+const (
+	L   Class = iota // left-to-right
+	R                // right-to-left
+	AL               // right-to-left Arabic
+	EN               // European number
+	ES               // European number separator
+	ET               // European number terminator
+	AN               // Arabic number
+	CS               // common number separator
+	NSM              // nonspacing mark
+	BN               // boundary neutral
+	B                // paragraph separator
+	S                // segment separator
+	WS               // whitespace
+	ON               // other neutrals
+	LRE              // left-to-right embedding
+	LRO              // left-to-right override
+	RLE              // right-to-left embedding
+	RLO              // right-to-left override
+	PDF              // pop directional format
+	LRI              // left-to-right isolate
+	RLI              // right-to-left isolate
+	FSI              // first strong isolate
+	PDI              // pop directional isolate
+)
+
+// A Level is an embedding level. Text with an odd level is displayed from
+// right to left.
+type Level uint8
+
+// maxDepth is the maximum explicit embedding level.
+const maxDepth = 125
+
+// A Direction is the base direction of a paragraph.
+type Direction int
+
+const (
+	Auto        Direction = iota // determined by the first strong character
+	LeftToRight                  // base level 0
+	RightToLeft                  // base level 1
+)
+
+// Resolve returns the embedding level of every character of a paragraph
+// together with the paragraph's base level.
+func Resolve(text []rune, dir Direction) ([]Level, Level) {
+	p := &paragraph{
+		text:    text,
+		initial: make([]Class, len(text)),
+		types:   make([]Class, len(text)),
+		levels:  make([]Level, len(text)),
+	}
+	for i, r := range text {
+		p.initial[i] = LookupClass(r)
+	}
+	copy(p.types, p.initial)
+	p.matchIsolates()
+
+	switch dir {
+	case LeftToRight:
+		p.base = 0
+	case RightToLeft:
+		p.base = 1
+	default:
+		p.base = p.firstStrong(0, len(text))
+	}
+
+	p.explicitLevels()
+	for _, seq := range p.isolatingRunSequences() {
+		seq.resolveWeakTypes()
+		seq.resolvePairedBrackets()
+		seq.resolveNeutralTypes()
+		seq.resolveImplicitLevels()
+	}
+	p.assignRemovedLevels()
+	p.resetWhitespace()
+	return p.levels, p.base
+}
+
+// Reorder returns the visual order of a line of characters with the given
+// levels: the k-th displayed character is the order[k]-th logical one.
+func Reorder(levels []Level) []int {
+	order := make([]int, len(levels))
+	var highest, lowestOdd Level = 0, maxDepth + 2
+	for i, l := range levels {
+		order[i] = i
+		if l > highest {
+			highest = l
+		}
+		if l%2 == 1 && l < lowestOdd {
+			lowestOdd = l
+		}
+	}
+	for level := highest; level >= lowestOdd && level > 0; level-- {
+		for i := 0; i < len(levels); i++ {
+			if levels[order[i]] < level {
+				continue
+			}
+			j := i + 1
+			for j < len(levels) && levels[order[j]] >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				order[a], order[b] = order[b], order[a]
+			}
+			i = j
+		}
+	}
+	return order
+}
+
+type paragraph struct {
+	text    []rune
+	initial []Class // original types
+	types   []Class // resolved types
+	levels  []Level
+	base    Level
+
+	matchingPDI       []int // position of the matching PDI of an isolate initiator
+	matchingInitiator []int // position of the isolate initiator of a PDI
+}
+
+func isIsolateInitiator(c Class) bool {
+	return c == LRI || c == RLI || c == FSI
+}
+
+// isRemoved reports whether a character is ignored by X9.
+func isRemoved(c Class) bool {
+	switch c {
+	case LRE, RLE, LRO, RLO, PDF, BN:
+		return true
+	}
+	return false
+}
+
+// matchIsolates pairs isolate initiators with their PDIs (BD9).
+func (p *paragraph) matchIsolates() {
+	n := len(p.text)
+	p.matchingPDI = make([]int, n)
+	p.matchingInitiator = make([]int, n)
+	var stack []int
+	for i, c := range p.initial {
+		p.matchingPDI[i], p.matchingInitiator[i] = -1, -1
+		switch {
+		case isIsolateInitiator(c):
+			stack = append(stack, i)
+		case c == PDI && len(stack) > 0:
+			k := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			p.matchingPDI[k], p.matchingInitiator[i] = i, k
+		case c == B:
+			stack = stack[:0]
+		}
+	}
+	for _, k := range stack {
+		p.matchingPDI[k] = n
+	}
+}
+
+// firstStrong determines the level of the first strong character in the
+// range, skipping isolated text (P2, P3).
+func (p *paragraph) firstStrong(start, end int) Level {
+	for i := start; i < end; i++ {
+		switch p.initial[i] {
+		case L:
+			return 0
+		case R, AL:
+			return 1
+		case LRI, RLI, FSI:
+			if p.matchingPDI[i] < 0 {
+				return 0
+			}
+			i = p.matchingPDI[i]
+		case B:
+			return 0
+		}
+	}
+	return 0
+}
+
+type status struct {
+	level    Level
+	override Class // ON, L or R
+	isolate  bool
+}
+
+// explicitLevels applies the rules X1 to X8.
+func (p *paragraph) explicitLevels() {
+	stack := []status{{level: p.base, override: ON}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+	for i, c := range p.initial {
+		top := stack[len(stack)-1]
+		switch c {
+		case RLE, LRE, RLO, LRO:
+			level := nextEven(top.level)
+			if c == RLE || c == RLO {
+				level = nextOdd(top.level)
+			}
+			p.levels[i] = top.level
+			if level <= maxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				s := status{level: level, override: ON}
+				if c == LRO {
+					s.override = L
+				} else if c == RLO {
+					s.override = R
+				}
+				stack = append(stack, s)
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+		case RLI, LRI, FSI:
+			p.levels[i] = top.level
+			if top.override != ON {
+				p.types[i] = top.override
+			}
+			if c == FSI {
+				c = LRI
+				if p.firstStrong(i+1, p.matchingPDI[i]) == 1 {
+					c = RLI
+				}
+			}
+			level := nextEven(top.level)
+			if c == RLI {
+				level = nextOdd(top.level)
+			}
+			if level <= maxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, status{level: level, override: ON, isolate: true})
+			} else {
+				overflowIsolates++
+			}
+		case PDI:
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			top = stack[len(stack)-1]
+			p.levels[i] = top.level
+			if top.override != ON {
+				p.types[i] = top.override
+			}
+		case PDF:
+			switch {
+			case overflowIsolates > 0:
+			case overflowEmbeddings > 0:
+				overflowEmbeddings--
+			case !top.isolate && len(stack) >= 2:
+				stack = stack[:len(stack)-1]
+			}
+			p.levels[i] = top.level
+		case B:
+			p.levels[i] = p.base
+		case BN:
+			p.levels[i] = top.level
+		default:
+			p.levels[i] = top.level
+			if top.override != ON {
+				p.types[i] = top.override
+			}
+		}
+	}
+}
+
+func nextEven(l Level) Level {
+	return (l + 2) &^ 1
+}
+
+func nextOdd(l Level) Level {
+	return (l + 1) | 1
+}
+
+// A runSequence is an isolating run sequence (BD13). Its characters share
+// the same embedding level.
+type runSequence struct {
+	p       *paragraph
+	indexes []int
+	types   []Class
+	level   Level
+	sos     Class
+	eos     Class
+}
+
+// isolatingRunSequences splits the paragraph into level runs and connects
+// the runs which are separated by isolates (X10).
+func (p *paragraph) isolatingRunSequences() []*runSequence {
+	var runs [][]int
+	var run []int
+	for i, c := range p.initial {
+		if isRemoved(c) {
+			continue
+		}
+		if len(run) > 0 && p.levels[i] != p.levels[run[0]] {
+			runs = append(runs, run)
+			run = nil
+		}
+		run = append(run, i)
+	}
+	if len(run) > 0 {
+		runs = append(runs, run)
+	}
+
+	runOf := make(map[int]int)
+	for k, run := range runs {
+		runOf[run[0]] = k
+	}
+	var seqs []*runSequence
+	for _, run := range runs {
+		if first := run[0]; p.initial[first] == PDI && p.matchingInitiator[first] >= 0 {
+			continue // part of the sequence of its isolate initiator
+		}
+		var indexes []int
+		for {
+			indexes = append(indexes, run...)
+			last := run[len(run)-1]
+			if !isIsolateInitiator(p.initial[last]) {
+				break
+			}
+			next := p.matchingPDI[last]
+			k, ok := runOf[next]
+			if next >= len(p.text) || !ok {
+				break
+			}
+			run = runs[k]
+		}
+		seqs = append(seqs, p.newRunSequence(indexes))
+	}
+	return seqs
+}
+
+func (p *paragraph) newRunSequence(indexes []int) *runSequence {
+	s := &runSequence{p: p, indexes: indexes, level: p.levels[indexes[0]]}
+	s.types = make([]Class, len(indexes))
+	for k, i := range indexes {
+		s.types[k] = p.types[i]
+	}
+
+	first, last := indexes[0], indexes[len(indexes)-1]
+	prev := p.base
+	for i := first - 1; i >= 0; i-- {
+		if !isRemoved(p.initial[i]) {
+			prev = p.levels[i]
+			break
+		}
+	}
+	next := p.base
+	if !isIsolateInitiator(p.initial[last]) {
+		for i := last + 1; i < len(p.text); i++ {
+			if !isRemoved(p.initial[i]) {
+				next = p.levels[i]
+				break
+			}
+		}
+	}
+	s.sos = direction(maxLevel(prev, s.level))
+	s.eos = direction(maxLevel(next, s.level))
+	return s
+}
+
+func maxLevel(a, b Level) Level {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func direction(l Level) Class {
+	if l%2 == 1 {
+		return R
+	}
+	return L
+}
+
+// resolveWeakTypes applies the rules W1 to W7.
+func (s *runSequence) resolveWeakTypes() {
+	t := s.types
+
+	// W1: nonspacing marks get the type of the previous character
+	prev := s.sos
+	for i := range t {
+		if t[i] == NSM {
+			t[i] = prev
+			if isIsolateInitiator(prev) || prev == PDI {
+				t[i] = ON
+			}
+		}
+		prev = t[i]
+	}
+
+	// W2, W3: European numbers after Arabic letters are Arabic numbers
+	strong := s.sos
+	for i := range t {
+		switch t[i] {
+		case L, R:
+			strong = t[i]
+		case AL:
+			strong = AL
+			t[i] = R
+		case EN:
+			if strong == AL {
+				t[i] = AN
+			}
+		}
+	}
+
+	// W4: single separators between two numbers
+	for i := 1; i+1 < len(t); i++ {
+		switch {
+		case t[i] == ES && t[i-1] == EN && t[i+1] == EN:
+			t[i] = EN
+		case t[i] == CS && t[i-1] == EN && t[i+1] == EN:
+			t[i] = EN
+		case t[i] == CS && t[i-1] == AN && t[i+1] == AN:
+			t[i] = AN
+		}
+	}
+
+	// W5: terminators adjacent to European numbers
+	for i := 0; i < len(t); i++ {
+		if t[i] != ET {
+			continue
+		}
+		j := i
+		for j < len(t) && t[j] == ET {
+			j++
+		}
+		if (i > 0 && t[i-1] == EN) || (j < len(t) && t[j] == EN) {
+			for k := i; k < j; k++ {
+				t[k] = EN
+			}
+		}
+		i = j
+	}
+
+	// W6: remaining separators and terminators become neutral
+	for i := range t {
+		if t[i] == ES || t[i] == ET || t[i] == CS {
+			t[i] = ON
+		}
+	}
+
+	// W7: European numbers after left-to-right text
+	strong = s.sos
+	for i := range t {
+		switch t[i] {
+		case L, R:
+			strong = t[i]
+		case EN:
+			if strong == L {
+				t[i] = L
+			}
+		}
+	}
+}
+
+// strongType returns the strong direction of a type for the rules N0 to
+// N2, where numbers are treated as right-to-left.
+func strongType(c Class) Class {
+	switch c {
+	case L:
+		return L
+	case R, AL, EN, AN:
+		return R
+	}
+	return ON
+}
+
+// resolvePairedBrackets applies rule N0.
+func (s *runSequence) resolvePairedBrackets() {
+	type pair struct{ open, close int }
+	type opening struct {
+		closing rune
+		pos     int
+	}
+	var pairs []pair
+	var stack []opening
+	for k, i := range s.indexes {
+		if s.types[k] != ON {
+			continue
+		}
+		r := canonicalBracket(s.p.text[i])
+		if closing, ok := brackets[r]; ok {
+			if len(stack) == 63 {
+				break
+			}
+			stack = append(stack, opening{canonicalBracket(closing), k})
+			continue
+		}
+		for n := len(stack) - 1; n >= 0; n-- {
+			if stack[n].closing == r {
+				pairs = append(pairs, pair{stack[n].pos, k})
+				stack = stack[:n]
+				break
+			}
+		}
+	}
+	// pairs have to be processed in the order of their opening brackets
+	for i := 1; i < len(pairs); i++ {
+		for j := i; j > 0 && pairs[j].open < pairs[j-1].open; j-- {
+			pairs[j], pairs[j-1] = pairs[j-1], pairs[j]
+		}
+	}
+
+	embedding := direction(s.level)
+	for _, p := range pairs {
+		found, opposite := false, false
+		for k := p.open + 1; k < p.close; k++ {
+			switch strongType(s.types[k]) {
+			case embedding:
+				found = true
+			case L, R:
+				opposite = true
+			}
+		}
+		dir := ON
+		if found {
+			dir = embedding
+		} else if opposite {
+			context := s.sos
+			for k := p.open - 1; k >= 0; k-- {
+				if c := strongType(s.types[k]); c != ON {
+					context = c
+					break
+				}
+			}
+			dir = embedding
+			if context != embedding {
+				dir = context
+			}
+		}
+		if dir == ON {
+			continue
+		}
+		for _, k := range []int{p.open, p.close} {
+			s.types[k] = dir
+			for m := k + 1; m < len(s.types) && s.p.initial[s.indexes[m]] == NSM; m++ {
+				s.types[m] = dir
+			}
+		}
+	}
+}
+
+func isNeutral(c Class) bool {
+	switch c {
+	case B, S, WS, ON, LRI, RLI, FSI, PDI:
+		return true
+	}
+	return false
+}
+
+// resolveNeutralTypes applies the rules N1 and N2.
+func (s *runSequence) resolveNeutralTypes() {
+	t := s.types
+	embedding := direction(s.level)
+	for i := 0; i < len(t); i++ {
+		if !isNeutral(t[i]) {
+			continue
+		}
+		j := i
+		for j < len(t) && isNeutral(t[j]) {
+			j++
+		}
+		before, after := s.sos, s.eos
+		if i > 0 {
+			before = strongType(t[i-1])
+		}
+		if j < len(t) {
+			after = strongType(t[j])
+		}
+		dir := embedding
+		if before == after && before != ON {
+			dir = before
+		}
+		for k := i; k < j; k++ {
+			t[k] = dir
+		}
+		i = j
+	}
+}
+
+// resolveImplicitLevels applies the rules I1 and I2.
+func (s *runSequence) resolveImplicitLevels() {
+	for k, i := range s.indexes {
+		level := s.level
+		switch t := s.types[k]; {
+		case level%2 == 0 && t == R:
+			level++
+		case level%2 == 0 && (t == AN || t == EN):
+			level += 2
+		case level%2 == 1 && (t == L || t == EN || t == AN):
+			level++
+		}
+		s.p.levels[i] = level
+	}
+}
+
+// assignRemovedLevels gives characters removed by X9 the level of the
+// preceding character, so that they do not break runs.
+func (p *paragraph) assignRemovedLevels() {
+	for i, c := range p.initial {
+		if isRemoved(c) {
+			if i > 0 {
+				p.levels[i] = p.levels[i-1]
+			} else {
+				p.levels[i] = p.base
+			}
+		}
+	}
+}
+
+// resetWhitespace resets separators and trailing whitespace to the
+// paragraph level (L1).
+func (p *paragraph) resetWhitespace() {
+	trailing := true
+	for i := len(p.text) - 1; i >= 0; i-- {
+		switch c := p.initial[i]; {
+		case c == B || c == S:
+			p.levels[i] = p.base
+			trailing = true
+		case c == WS || isIsolateInitiator(c) || c == PDI || isRemoved(c):
+			if trailing {
+				p.levels[i] = p.base
+			}
+		default:
+			trailing = false
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package bidi
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// types maps the names of the bidirectional types to the types.
+var types = map[string]Class{
+	"L": L, "R": R, "AL": AL, "EN": EN, "ES": ES, "ET": ET, "AN": AN,
+	"CS": CS, "NSM": NSM, "BN": BN, "B": B, "S": S, "WS": WS, "ON": ON,
+	"LRE": LRE, "LRO": LRO, "RLE": RLE, "RLO": RLO, "PDF": PDF,
+	"LRI": LRI, "RLI": RLI, "FSI": FSI, "PDI": PDI,
+}
+
+// samples are characters of every bidirectional type.
+var samples = map[Class]rune{
+	L: 'a', R: '\u05d0', AL: '\u0627', EN: '1', ES: '+', ET: '$', AN: '\u0660',
+	CS: ',', NSM: '\u0300', BN: '\u00ad', B: '\u2029', S: '\t', WS: ' ', ON: '!',
+	LRE: '\u202a', LRO: '\u202d', RLE: '\u202b', RLO: '\u202e', PDF: '\u202c',
+	LRI: '\u2066', RLI: '\u2067', FSI: '\u2068', PDI: '\u2069',
+}
+
+// readTest calls fn with the fields of every line of a test file, which
+// are separated by semicolons. Parts starting with @ are passed as well.
+func readTest(t *testing.T, name string, fn func(n int, fields []string)) {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ";")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		fn(n, fields)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// check compares the levels and the visual order of a text with the
+// expected values, where x marks characters which are removed by rule X9.
+func check(text []rune, levels []Level, wantLevels, wantOrder string) string {
+	var got []string
+	var kept []Level
+	var index []int
+	for i, r := range text {
+		if isRemoved(LookupClass(r)) {
+			got = append(got, "x")
+			continue
+		}
+		got = append(got, strconv.Itoa(int(levels[i])))
+		kept = append(kept, levels[i])
+		index = append(index, i)
+	}
+	if s := strings.Join(got, " "); s != wantLevels {
+		return "levels " + s + ", want " + wantLevels
+	}
+	got = got[:0]
+	for _, k := range Reorder(kept) {
+		got = append(got, strconv.Itoa(index[k]))
+	}
+	if s := strings.Join(got, " "); s != wantOrder {
+		return "order " + s + ", want " + wantOrder
+	}
+	return ""
+}
+
+// TestBidiTest checks sequences of bidirectional types, which are
+// represented by a sample character of each type.
+func TestBidiTest(t *testing.T) {
+	for c, r := range samples {
+		if LookupClass(r) != c {
+			t.Fatalf("sample %U has the type %d, want %d", r, LookupClass(r), c)
+		}
+	}
+	var levels, order string
+	readTest(t, "testdata/BidiTest.txt", func(n int, fields []string) {
+		switch {
+		case strings.HasPrefix(fields[0], "@Levels:"):
+			levels = strings.TrimSpace(strings.TrimPrefix(fields[0], "@Levels:"))
+			return
+		case strings.HasPrefix(fields[0], "@Reorder:"):
+			order = strings.TrimSpace(strings.TrimPrefix(fields[0], "@Reorder:"))
+			return
+		}
+		if len(fields) != 2 {
+			t.Fatalf("line %d: got %d fields, want 2", n, len(fields))
+		}
+		var text []rune
+		for _, name := range strings.Fields(fields[0]) {
+			text = append(text, samples[types[name]])
+		}
+		bits, err := strconv.Atoi(fields[1])
+		if err != nil {
+			t.Fatalf("line %d: %v", n, err)
+		}
+		for i, dir := range []Direction{Auto, LeftToRight, RightToLeft} {
+			if bits&(1<<uint(i)) == 0 {
+				continue
+			}
+			got, _ := Resolve(text, dir)
+			if msg := check(text, got, levels, order); msg != "" {
+				t.Errorf("line %d: %s with direction %d: %s", n, fields[0], dir, msg)
+			}
+		}
+	})
+}
+
+// TestBidiCharacterTest checks texts including paired brackets.
+func TestBidiCharacterTest(t *testing.T) {
+	readTest(t, "testdata/BidiCharacterTest.txt", func(n int, fields []string) {
+		if len(fields) != 5 {
+			t.Fatalf("line %d: got %d fields, want 5", n, len(fields))
+		}
+		var text []rune
+		for _, s := range strings.Fields(fields[0]) {
+			r, err := strconv.ParseUint(s, 16, 32)
+			if err != nil {
+				t.Fatalf("line %d: %v", n, err)
+			}
+			text = append(text, rune(r))
+		}
+		dir := []Direction{LeftToRight, RightToLeft, Auto}[fields[1][0]-'0']
+		levels, base := Resolve(text, dir)
+		if got := strconv.Itoa(int(base)); got != fields[2] {
+			t.Errorf("line %d: paragraph level %s, want %s", n, got, fields[2])
+		}
+		if msg := check(text, levels, fields[3], fields[4]); msg != "" {
+			t.Errorf("line %d: %q: %s", n, string(text), msg)
+		}
+	})
+}
+
+func TestMirror(t *testing.T) {
+	tests := map[rune]rune{
+		'(': ')', ')': '(', '<': '>', '«': '»', '≤': '≥', '〈': '〉',
+		'\u2e55': '\u2e56', 'a': 0, '"': 0,
+	}
+	for r, want := range tests {
+		if m, ok := Mirror(r); m != want || ok != (want != 0) {
+			t.Errorf("Mirror(%q) = %q, %v, want %q", r, m, ok, want)
+		}
+	}
+}
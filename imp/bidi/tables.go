@@ -0,0 +1,469 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package bidi
+
+import (
+	"sort"
+	"unicode"
+)
+
+// LookupClass returns the bidirectional character type of a rune.
+func LookupClass(r rune) Class {
+	if c, ok := searchClass(classes, r); ok {
+		return c
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me) {
+		return NSM
+	}
+	if c, ok := searchClass(rtlRanges, r); ok {
+		return c
+	}
+	switch {
+	case unicode.Is(unicode.Cf, r):
+		return BN
+	case unicode.Is(unicode.Zs, r):
+		return WS
+	case unicode.Is(unicode.Sc, r):
+		return ET
+	case unicode.In(r, unicode.P, unicode.S):
+		return ON
+	}
+	return L
+}
+
+type classRange struct {
+	lo, hi rune
+	class  Class
+}
+
+func searchClass(table []classRange, r rune) (Class, bool) {
+	k := sort.Search(len(table), func(i int) bool { return table[i].hi >= r })
+	if k < len(table) && table[k].lo <= r {
+		return table[k].class, true
+	}
+	return L, false
+}
+
+// classes lists characters whose type differs from the default derived
+// from their general category.
+var classes = []classRange{
+	{0x0000, 0x0008, BN},
+	{0x0009, 0x0009, S},
+	{0x000A, 0x000A, B},
+	{0x000B, 0x000B, S},
+	{0x000C, 0x000C, WS},
+	{0x000D, 0x000D, B},
+	{0x000E, 0x001B, BN},
+	{0x001C, 0x001E, B},
+	{0x001F, 0x001F, S},
+	{0x0023, 0x0023, ET},
+	{0x0025, 0x0025, ET},
+	{0x002B, 0x002B, ES},
+	{0x002C, 0x002C, CS},
+	{0x002D, 0x002D, ES},
+	{0x002E, 0x002F, CS},
+	{0x0030, 0x0039, EN},
+	{0x003A, 0x003A, CS},
+	{0x007F, 0x0084, BN},
+	{0x0085, 0x0085, B},
+	{0x0086, 0x009F, BN},
+	{0x00A0, 0x00A0, CS},
+	{0x00B0, 0x00B1, ET},
+	{0x00B2, 0x00B3, EN},
+	{0x00B9, 0x00B9, EN},
+	{0x00BC, 0x00BE, ON},
+	{0x02B9, 0x02BA, ON},
+	{0x02C6, 0x02CF, ON},
+	{0x02EC, 0x02EC, ON},
+	{0x0374, 0x0374, ON},
+	{0x0482, 0x0482, L},
+	{0x055A, 0x055F, L},
+	{0x0589, 0x0589, L},
+	{0x0600, 0x0605, AN},
+	{0x0606, 0x0607, ON},
+	{0x0609, 0x060A, ET},
+	{0x060C, 0x060C, CS},
+	{0x060E, 0x060F, ON},
+	{0x0660, 0x0669, AN},
+	{0x066A, 0x066A, ET},
+	{0x066B, 0x066C, AN},
+	{0x06DD, 0x06DD, AN},
+	{0x06DE, 0x06DE, ON},
+	{0x06E9, 0x06E9, ON},
+	{0x06F0, 0x06F9, EN},
+	{0x07F6, 0x07F9, ON},
+	{0x0890, 0x0891, AN},
+	{0x08E2, 0x08E2, AN},
+	{0x0964, 0x0965, L},
+	{0x0970, 0x0970, L},
+	{0x09FA, 0x09FA, L},
+	{0x09FD, 0x09FD, L},
+	{0x0A76, 0x0A76, L},
+	{0x0AF0, 0x0AF0, L},
+	{0x0B70, 0x0B70, L},
+	{0x0C77, 0x0C77, L},
+	{0x0C78, 0x0C7E, ON},
+	{0x0C7F, 0x0C7F, L},
+	{0x0C84, 0x0C84, L},
+	{0x0CBF, 0x0CBF, L},
+	{0x0CC6, 0x0CC6, L},
+	{0x0D4F, 0x0D4F, L},
+	{0x0D79, 0x0D79, L},
+	{0x0DF4, 0x0DF4, L},
+	{0x0E4F, 0x0E4F, L},
+	{0x0E5A, 0x0E5B, L},
+	{0x0F01, 0x0F17, L},
+	{0x0F1A, 0x0F1F, L},
+	{0x0F34, 0x0F34, L},
+	{0x0F36, 0x0F36, L},
+	{0x0F38, 0x0F38, L},
+	{0x0F85, 0x0F85, L},
+	{0x0FBE, 0x0FC5, L},
+	{0x0FC7, 0x0FCC, L},
+	{0x0FCE, 0x0FDA, L},
+	{0x104A, 0x104F, L},
+	{0x109E, 0x109F, L},
+	{0x10FB, 0x10FB, L},
+	{0x1360, 0x1368, L},
+	{0x166D, 0x166E, L},
+	{0x16EB, 0x16ED, L},
+	{0x1735, 0x1736, L},
+	{0x17D4, 0x17D6, L},
+	{0x17D8, 0x17DA, L},
+	{0x17F0, 0x17F9, ON},
+	{0x1A1E, 0x1A1F, L},
+	{0x1AA0, 0x1AA6, L},
+	{0x1AA8, 0x1AAD, L},
+	{0x1B5A, 0x1B6A, L},
+	{0x1B74, 0x1B7E, L},
+	{0x1BFC, 0x1BFF, L},
+	{0x1C3B, 0x1C3F, L},
+	{0x1C7E, 0x1C7F, L},
+	{0x1CC0, 0x1CC7, L},
+	{0x1CD3, 0x1CD3, L},
+	{0x200E, 0x200E, L},
+	{0x200F, 0x200F, R},
+	{0x2028, 0x2028, WS},
+	{0x2029, 0x2029, B},
+	{0x202A, 0x202A, LRE},
+	{0x202B, 0x202B, RLE},
+	{0x202C, 0x202C, PDF},
+	{0x202D, 0x202D, LRO},
+	{0x202E, 0x202E, RLO},
+	{0x202F, 0x202F, CS},
+	{0x2030, 0x2034, ET},
+	{0x2044, 0x2044, CS},
+	{0x2065, 0x2065, BN},
+	{0x2066, 0x2066, LRI},
+	{0x2067, 0x2067, RLI},
+	{0x2068, 0x2068, FSI},
+	{0x2069, 0x2069, PDI},
+	{0x2070, 0x2070, EN},
+	{0x2074, 0x2079, EN},
+	{0x207A, 0x207B, ES},
+	{0x2080, 0x2089, EN},
+	{0x208A, 0x208B, ES},
+	{0x20C2, 0x20CF, ET},
+	{0x212E, 0x212E, ET},
+	{0x214F, 0x214F, L},
+	{0x2150, 0x215F, ON},
+	{0x2189, 0x2189, ON},
+	{0x2212, 0x2212, ES},
+	{0x2213, 0x2213, ET},
+	{0x2336, 0x237A, L},
+	{0x2395, 0x2395, L},
+	{0x2460, 0x2487, ON},
+	{0x2488, 0x249B, EN},
+	{0x249C, 0x24E9, L},
+	{0x24EA, 0x24FF, ON},
+	{0x26AC, 0x26AC, L},
+	{0x2776, 0x2793, ON},
+	{0x2800, 0x28FF, L},
+	{0x2CFD, 0x2CFD, ON},
+	{0x2D70, 0x2D70, L},
+	{0x2E2F, 0x2E2F, ON},
+	{0x3190, 0x3191, L},
+	{0x3196, 0x319F, L},
+	{0x3200, 0x321C, L},
+	{0x322A, 0x3247, L},
+	{0x3251, 0x325F, ON},
+	{0x3260, 0x327B, L},
+	{0x327F, 0x327F, L},
+	{0x328A, 0x32B0, L},
+	{0x32B1, 0x32BF, ON},
+	{0x32C0, 0x32CB, L},
+	{0x32D0, 0x3376, L},
+	{0x337B, 0x33DD, L},
+	{0x33E0, 0x33FE, L},
+	{0xA4FE, 0xA4FF, L},
+	{0xA67F, 0xA67F, ON},
+	{0xA6F2, 0xA6F7, L},
+	{0xA717, 0xA71F, ON},
+	{0xA788, 0xA788, ON},
+	{0xA789, 0xA78A, L},
+	{0xA836, 0xA837, L},
+	{0xA839, 0xA839, ET},
+	{0xA8CE, 0xA8CF, L},
+	{0xA8F8, 0xA8FA, L},
+	{0xA8FC, 0xA8FC, L},
+	{0xA92E, 0xA92F, L},
+	{0xA95F, 0xA95F, L},
+	{0xA9C1, 0xA9CD, L},
+	{0xA9DE, 0xA9DF, L},
+	{0xAA5C, 0xAA5F, L},
+	{0xAA77, 0xAA79, L},
+	{0xAADE, 0xAADF, L},
+	{0xAAF0, 0xAAF1, L},
+	{0xAB5B, 0xAB5B, L},
+	{0xABEB, 0xABEB, L},
+	{0xFB29, 0xFB29, ES},
+	{0xFD3E, 0xFD4F, ON},
+	{0xFDCF, 0xFDCF, ON},
+	{0xFDD0, 0xFDEF, BN},
+	{0xFDFD, 0xFDFF, ON},
+	{0xFE50, 0xFE50, CS},
+	{0xFE52, 0xFE52, CS},
+	{0xFE55, 0xFE55, CS},
+	{0xFE5F, 0xFE5F, ET},
+	{0xFE62, 0xFE63, ES},
+	{0xFE6A, 0xFE6A, ET},
+	{0xFEFF, 0xFEFF, BN},
+	{0xFF03, 0xFF03, ET},
+	{0xFF05, 0xFF05, ET},
+	{0xFF0B, 0xFF0B, ES},
+	{0xFF0C, 0xFF0C, CS},
+	{0xFF0D, 0xFF0D, ES},
+	{0xFF0E, 0xFF0F, CS},
+	{0xFF10, 0xFF19, EN},
+	{0xFF1A, 0xFF1A, CS},
+	{0xFFF0, 0xFFF8, BN},
+	{0xFFF9, 0xFFFB, ON},
+	{0xFFFE, 0xFFFF, BN},
+	{0x10100, 0x10100, L},
+	{0x10102, 0x10102, L},
+	{0x10137, 0x1013F, L},
+	{0x10140, 0x10178, ON},
+	{0x1018A, 0x1018B, ON},
+	{0x1018D, 0x1018E, L},
+	{0x101D0, 0x101FC, L},
+	{0x102E1, 0x102FB, EN},
+	{0x1039F, 0x1039F, L},
+	{0x103D0, 0x103D0, L},
+	{0x1056F, 0x1056F, L},
+	{0x1091F, 0x1091F, ON},
+	{0x10B39, 0x10B3F, ON},
+	{0x10D00, 0x10D23, AL},
+	{0x10D28, 0x10D2F, AL},
+	{0x10D30, 0x10D39, AN},
+	{0x10D3A, 0x10D3F, AL},
+	{0x10E60, 0x10E7E, AN},
+	{0x10EC0, 0x10EC1, AL},
+	{0x10EC8, 0x10ECF, AL},
+	{0x10ED9, 0x10EF9, AL},
+	{0x10F30, 0x10F45, AL},
+	{0x10F51, 0x10F6F, AL},
+	{0x11047, 0x1104D, L},
+	{0x11052, 0x11065, ON},
+	{0x110BB, 0x110C1, L},
+	{0x110CD, 0x110CD, L},
+	{0x11140, 0x11143, L},
+	{0x11174, 0x11175, L},
+	{0x111C5, 0x111C8, L},
+	{0x111CD, 0x111CD, L},
+	{0x111DB, 0x111DB, L},
+	{0x111DD, 0x111DF, L},
+	{0x11238, 0x1123D, L},
+	{0x112A9, 0x112A9, L},
+	{0x1144B, 0x1144F, L},
+	{0x1145A, 0x1145B, L},
+	{0x1145D, 0x1145D, L},
+	{0x114C6, 0x114C6, L},
+	{0x115C1, 0x115D7, L},
+	{0x11641, 0x11643, L},
+	{0x116B9, 0x116B9, L},
+	{0x1171E, 0x1171E, NSM},
+	{0x1173C, 0x1173F, L},
+	{0x1183B, 0x1183B, L},
+	{0x11944, 0x11946, L},
+	{0x119E2, 0x119E2, L},
+	{0x11A07, 0x11A08, L},
+	{0x11A3F, 0x11A46, L},
+	{0x11A9A, 0x11A9C, L},
+	{0x11A9E, 0x11AA2, L},
+	{0x11B00, 0x11B09, L},
+	{0x11C3F, 0x11C3F, L},
+	{0x11C41, 0x11C45, L},
+	{0x11C70, 0x11C71, L},
+	{0x11EF7, 0x11EF8, L},
+	{0x11F43, 0x11F4F, L},
+	{0x11FFF, 0x11FFF, L},
+	{0x12470, 0x12474, L},
+	{0x12FF1, 0x12FF2, L},
+	{0x13430, 0x1343F, L},
+	{0x16A6E, 0x16A6F, L},
+	{0x16AF5, 0x16AF5, L},
+	{0x16B37, 0x16B3F, L},
+	{0x16B44, 0x16B45, L},
+	{0x16E97, 0x16E9A, L},
+	{0x1BC9C, 0x1BC9C, L},
+	{0x1BC9F, 0x1BC9F, L},
+	{0x1CF50, 0x1CFC3, L},
+	{0x1D000, 0x1D0F5, L},
+	{0x1D100, 0x1D126, L},
+	{0x1D129, 0x1D164, L},
+	{0x1D16A, 0x1D16C, L},
+	{0x1D183, 0x1D184, L},
+	{0x1D18C, 0x1D1A9, L},
+	{0x1D1AE, 0x1D1E8, L},
+	{0x1D6C1, 0x1D6C1, L},
+	{0x1D6FB, 0x1D6FB, L},
+	{0x1D735, 0x1D735, L},
+	{0x1D76F, 0x1D76F, L},
+	{0x1D7A9, 0x1D7A9, L},
+	{0x1D7CE, 0x1D7FF, EN},
+	{0x1D800, 0x1D9FF, L},
+	{0x1DA37, 0x1DA3A, L},
+	{0x1DA6D, 0x1DA74, L},
+	{0x1DA76, 0x1DA83, L},
+	{0x1DA85, 0x1DA8B, L},
+	{0x1E14F, 0x1E14F, L},
+	{0x1EC70, 0x1ECBF, AL},
+	{0x1ED00, 0x1ED4F, AL},
+	{0x1EEF0, 0x1EEF1, ON},
+	{0x1F100, 0x1F10A, EN},
+	{0x1F10B, 0x1F10C, ON},
+	{0x1F110, 0x1F12E, L},
+	{0x1F130, 0x1F169, L},
+	{0x1F170, 0x1F1AC, L},
+	{0x1F1E6, 0x1F202, L},
+	{0x1F210, 0x1F23B, L},
+	{0x1F240, 0x1F248, L},
+	{0x1F250, 0x1F251, L},
+	{0x1FBF0, 0x1FBF9, EN},
+	{0x1FFFE, 0x1FFFF, BN},
+	{0x2FFFE, 0x2FFFF, BN},
+	{0x3FFFE, 0x3FFFF, BN},
+	{0x4FFFE, 0x4FFFF, BN},
+	{0x5FFFE, 0x5FFFF, BN},
+	{0x6FFFE, 0x6FFFF, BN},
+	{0x7FFFE, 0x7FFFF, BN},
+	{0x8FFFE, 0x8FFFF, BN},
+	{0x9FFFE, 0x9FFFF, BN},
+	{0xAFFFE, 0xAFFFF, BN},
+	{0xBFFFE, 0xBFFFF, BN},
+	{0xCFFFE, 0xCFFFF, BN},
+	{0xDFFFE, 0xE0000, BN},
+	{0xE0002, 0xE001F, BN},
+	{0xE0080, 0xE00FF, BN},
+	{0xE01F0, 0xE0FFF, BN},
+	{0xEFFFE, 0xEFFFF, BN},
+	{0xFFFFE, 0xFFFFF, BN},
+	{0x10FFFE, 0x10FFFF, BN},
+}
+
+// rtlRanges are the blocks of the right-to-left scripts.
+var rtlRanges = []classRange{
+	{0x0590, 0x05FF, R},
+	{0x0600, 0x07BF, AL},
+	{0x07C0, 0x085F, R},
+	{0x0860, 0x08FF, AL},
+	{0xFB1D, 0xFB4F, R},
+	{0xFB50, 0xFDCF, AL},
+	{0xFDF0, 0xFDFF, AL},
+	{0xFE70, 0xFEFF, AL},
+	{0x10800, 0x10FFF, R},
+	{0x1E800, 0x1EDFF, R},
+	{0x1EE00, 0x1EEFF, AL},
+	{0x1EF00, 0x1EFFF, R},
+}
+
+// Mirror returns the mirrored counterpart of a character, e.g. ")" for
+// "(", which is displayed in right-to-left text.
+func Mirror(r rune) (rune, bool) {
+	m, ok := mirrors[r]
+	return m, ok
+}
+
+var mirrors = make(map[rune]rune)
+
+// mirrorPairs are pairs of characters with the Bidi_Mirrored property.
+var mirrorPairs = [][2]rune{
+	{0x0028, 0x0029}, {0x003C, 0x003E}, {0x005B, 0x005D}, {0x007B, 0x007D},
+	{0x00AB, 0x00BB}, {0x0F3A, 0x0F3B}, {0x0F3C, 0x0F3D}, {0x169B, 0x169C},
+	{0x2039, 0x203A}, {0x2045, 0x2046}, {0x207D, 0x207E}, {0x208D, 0x208E},
+	{0x2208, 0x220B}, {0x2209, 0x220C}, {0x220A, 0x220D}, {0x2215, 0x29F5},
+	{0x221F, 0x2BFE}, {0x2220, 0x29A3}, {0x2221, 0x299B}, {0x2222, 0x29A0},
+	{0x2224, 0x2AEE}, {0x223C, 0x223D}, {0x2243, 0x22CD}, {0x2245, 0x224C},
+	{0x2252, 0x2253}, {0x2254, 0x2255}, {0x2264, 0x2265}, {0x2266, 0x2267},
+	{0x2268, 0x2269}, {0x226A, 0x226B}, {0x226E, 0x226F}, {0x2270, 0x2271},
+	{0x2272, 0x2273}, {0x2274, 0x2275}, {0x2276, 0x2277}, {0x2278, 0x2279},
+	{0x227A, 0x227B}, {0x227C, 0x227D}, {0x227E, 0x227F}, {0x2280, 0x2281},
+	{0x2282, 0x2283}, {0x2284, 0x2285}, {0x2286, 0x2287}, {0x2288, 0x2289},
+	{0x228A, 0x228B}, {0x228F, 0x2290}, {0x2291, 0x2292}, {0x2298, 0x29B8},
+	{0x22A2, 0x22A3}, {0x22A6, 0x2ADE}, {0x22A8, 0x2AE4}, {0x22A9, 0x2AE3},
+	{0x22AB, 0x2AE5}, {0x22B0, 0x22B1}, {0x22B2, 0x22B3}, {0x22B4, 0x22B5},
+	{0x22B6, 0x22B7}, {0x22B8, 0x27DC}, {0x22C9, 0x22CA}, {0x22CB, 0x22CC},
+	{0x22D0, 0x22D1}, {0x22D6, 0x22D7}, {0x22D8, 0x22D9}, {0x22DA, 0x22DB},
+	{0x22DC, 0x22DD}, {0x22DE, 0x22DF}, {0x22E0, 0x22E1}, {0x22E2, 0x22E3},
+	{0x22E4, 0x22E5}, {0x22E6, 0x22E7}, {0x22E8, 0x22E9}, {0x22EA, 0x22EB},
+	{0x22EC, 0x22ED}, {0x22F0, 0x22F1}, {0x22F2, 0x22FA}, {0x22F3, 0x22FB},
+	{0x22F4, 0x22FC}, {0x22F6, 0x22FD}, {0x22F7, 0x22FE}, {0x2308, 0x2309},
+	{0x230A, 0x230B}, {0x2329, 0x232A}, {0x2768, 0x2769}, {0x276A, 0x276B},
+	{0x276C, 0x276D}, {0x276E, 0x276F}, {0x2770, 0x2771}, {0x2772, 0x2773},
+	{0x2774, 0x2775}, {0x27C3, 0x27C4}, {0x27C5, 0x27C6}, {0x27C8, 0x27C9},
+	{0x27CB, 0x27CD}, {0x27D5, 0x27D6}, {0x27DD, 0x27DE}, {0x27E2, 0x27E3},
+	{0x27E4, 0x27E5}, {0x27E6, 0x27E7}, {0x27E8, 0x27E9}, {0x27EA, 0x27EB},
+	{0x27EC, 0x27ED}, {0x27EE, 0x27EF}, {0x2983, 0x2984}, {0x2985, 0x2986},
+	{0x2987, 0x2988}, {0x2989, 0x298A}, {0x298B, 0x298C}, {0x298D, 0x2990},
+	{0x298F, 0x298E}, {0x2991, 0x2992}, {0x2993, 0x2994}, {0x2995, 0x2996},
+	{0x2997, 0x2998}, {0x29A4, 0x29A5}, {0x29A8, 0x29A9}, {0x29AA, 0x29AB},
+	{0x29AC, 0x29AD}, {0x29AE, 0x29AF}, {0x29C0, 0x29C1}, {0x29C4, 0x29C5},
+	{0x29CF, 0x29D0}, {0x29D1, 0x29D2}, {0x29D4, 0x29D5}, {0x29D8, 0x29D9},
+	{0x29DA, 0x29DB}, {0x29E8, 0x29E9}, {0x29F8, 0x29F9}, {0x29FC, 0x29FD},
+	{0x2A2B, 0x2A2C}, {0x2A2D, 0x2A2E}, {0x2A34, 0x2A35}, {0x2A3C, 0x2A3D},
+	{0x2A64, 0x2A65}, {0x2A79, 0x2A7A}, {0x2A7B, 0x2A7C}, {0x2A7D, 0x2A7E},
+	{0x2A7F, 0x2A80}, {0x2A81, 0x2A82}, {0x2A83, 0x2A84}, {0x2A85, 0x2A86},
+	{0x2A87, 0x2A88}, {0x2A89, 0x2A8A}, {0x2A8B, 0x2A8C}, {0x2A8D, 0x2A8E},
+	{0x2A8F, 0x2A90}, {0x2A91, 0x2A92}, {0x2A93, 0x2A94}, {0x2A95, 0x2A96},
+	{0x2A97, 0x2A98}, {0x2A99, 0x2A9A}, {0x2A9B, 0x2A9C}, {0x2A9D, 0x2A9E},
+	{0x2A9F, 0x2AA0}, {0x2AA1, 0x2AA2}, {0x2AA6, 0x2AA7}, {0x2AA8, 0x2AA9},
+	{0x2AAA, 0x2AAB}, {0x2AAC, 0x2AAD}, {0x2AAF, 0x2AB0}, {0x2AB1, 0x2AB2},
+	{0x2AB3, 0x2AB4}, {0x2AB5, 0x2AB6}, {0x2AB7, 0x2AB8}, {0x2AB9, 0x2ABA},
+	{0x2ABB, 0x2ABC}, {0x2ABD, 0x2ABE}, {0x2ABF, 0x2AC0}, {0x2AC1, 0x2AC2},
+	{0x2AC3, 0x2AC4}, {0x2AC5, 0x2AC6}, {0x2AC7, 0x2AC8}, {0x2AC9, 0x2ACA},
+	{0x2ACB, 0x2ACC}, {0x2ACD, 0x2ACE}, {0x2ACF, 0x2AD0}, {0x2AD1, 0x2AD2},
+	{0x2AD3, 0x2AD4}, {0x2AD5, 0x2AD6}, {0x2AEC, 0x2AED}, {0x2AF7, 0x2AF8},
+	{0x2AF9, 0x2AFA}, {0x2E02, 0x2E03}, {0x2E04, 0x2E05}, {0x2E09, 0x2E0A},
+	{0x2E0C, 0x2E0D}, {0x2E1C, 0x2E1D}, {0x2E20, 0x2E21}, {0x2E22, 0x2E23},
+	{0x2E24, 0x2E25}, {0x2E26, 0x2E27}, {0x2E28, 0x2E29}, {0x2E55, 0x2E56},
+	{0x2E57, 0x2E58}, {0x2E59, 0x2E5A}, {0x2E5B, 0x2E5C}, {0x3008, 0x3009},
+	{0x300A, 0x300B}, {0x300C, 0x300D}, {0x300E, 0x300F}, {0x3010, 0x3011},
+	{0x3014, 0x3015}, {0x3016, 0x3017}, {0x3018, 0x3019}, {0x301A, 0x301B},
+	{0xFE59, 0xFE5A}, {0xFE5B, 0xFE5C}, {0xFE5D, 0xFE5E}, {0xFE64, 0xFE65},
+	{0xFF08, 0xFF09}, {0xFF1C, 0xFF1E}, {0xFF3B, 0xFF3D}, {0xFF5B, 0xFF5D},
+	{0xFF5F, 0xFF60}, {0xFF62, 0xFF63},
+}
+
+// brackets maps the opening paired brackets to their closing counterparts.
+var brackets = make(map[rune]rune)
+
+func init() {
+	for _, p := range mirrorPairs {
+		mirrors[p[0]], mirrors[p[1]] = p[1], p[0]
+		if unicode.Is(unicode.Ps, p[0]) && unicode.Is(unicode.Pe, p[1]) {
+			brackets[p[0]] = p[1]
+		}
+	}
+}
+
+// canonicalBracket maps brackets to their canonical equivalent.
+func canonicalBracket(r rune) rune {
+	switch r {
+	case 0x2329:
+		return 0x3008
+	case 0x232A:
+		return 0x3009
+	}
+	return r
+}
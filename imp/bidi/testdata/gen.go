@@ -0,0 +1,319 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+//go:build ignore
+// +build ignore
+
+// Gen writes BidiTest.txt and BidiCharacterTest.txt with the levels and
+// the visual order which ICU computes for a list of texts. It needs the
+// ICU development files and is run in this directory with
+//
+//	go run gen.go
+//
+// ICU does not raise the levels of text which only contains characters of
+// the paragraph direction, for example text in a left-to-right embedding
+// or Arabic digits in a left-to-right paragraph. This does not change the
+// order, but the levels differ from the Unicode Bidirectional Algorithm.
+// Cases in which ICU gives all characters the paragraph level although
+// the text contains a character of type AN or characters after an
+// embedding, override or isolate initiator are therefore left out.
+package main
+
+/*
+#cgo pkg-config: icu-uc
+#include <stdlib.h>
+#include <unicode/ubidi.h>
+#include <unicode/uchar.h>
+#include <unicode/uversion.h>
+
+// The ICU functions are renamed with the version by macros, which cgo
+// cannot call.
+
+static int resolve(const UChar *text, int n, int dir, UBiDiLevel *levels, int *order) {
+	UErrorCode err = U_ZERO_ERROR;
+	UBiDi *b = ubidi_open();
+	UBiDiLevel level = dir == 0 ? 0 : dir == 1 ? 1 : UBIDI_DEFAULT_LTR;
+	ubidi_setPara(b, text, n, level, NULL, &err);
+	const UBiDiLevel *l = ubidi_getLevels(b, &err);
+	if (U_SUCCESS(err)) {
+		for (int i = 0; i < n; i++) {
+			levels[i] = l[i];
+		}
+		ubidi_getVisualMap(b, order, &err);
+	}
+	int para = ubidi_getParaLevel(b);
+	ubidi_close(b);
+	return U_SUCCESS(err) ? para : -1;
+}
+
+static int direction(UChar32 r) {
+	return u_charDirection(r);
+}
+
+static void version(char *s) {
+	UVersionInfo v;
+	u_getVersion(v);
+	u_versionToString(v, s);
+}
+*/
+import "C"
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// samples are characters of every bidirectional type, like in bidi_test.go.
+var samples = map[string]rune{
+	"L": 'a', "R": '\u05d0', "AL": '\u0627', "EN": '1', "ES": '+', "ET": '$', "AN": '\u0660',
+	"CS": ',', "NSM": '\u0300', "BN": '\u00ad', "B": '\u2029', "S": '\t', "WS": ' ', "ON": '!',
+	"LRE": '\u202a', "LRO": '\u202d', "RLE": '\u202b', "RLO": '\u202e', "PDF": '\u202c',
+	"LRI": '\u2066', "RLI": '\u2067', "FSI": '\u2068', "PDI": '\u2069',
+}
+
+var names = []string{
+	"L", "R", "AL", "EN", "ES", "ET", "AN", "CS", "NSM", "BN", "B", "S", "WS", "ON",
+	"LRE", "LRO", "RLE", "RLO", "PDF", "LRI", "RLI", "FSI", "PDI",
+}
+
+// sequences are longer sequences of types which are added to all sequences
+// of one and two types.
+var sequences = []string{
+	"AL EN", "AL ET EN", "L ET EN", "EN ET ET", "ET ET EN", "AL ET ET EN",
+	"EN ES EN", "EN CS EN", "AN CS AN", "AN CS EN", "AN ES AN", "L CS EN",
+	"R EN ES EN L", "R EN CS EN ET", "BN EN BN ET", "L NSM NSM", "R BN NSM",
+	"LRI NSM", "L BN BN R", "R WS L", "R ON R", "L ON R", "R ON EN",
+	"AL ON AN", "ON ON R ON ON", "WS R WS", "EN WS R", "R WS EN WS L",
+	"L WS WS B", "R S L", "R S L WS B", "RLE L PDF L", "LRE R PDF L",
+	"LRO R R PDF", "RLO L L PDF", "RLE PDF R", "LRE LRE LRE R PDF PDF PDF",
+	"L RLE L LRE R PDF PDF L", "LRE R PDF LRE R PDF", "RLI L PDI R",
+	"LRI R PDI L", "FSI R L PDI", "FSI L R PDI", "FSI EN R PDI",
+	"R LRI ON PDI R", "RLI L EN PDI", "LRI RLI PDI PDI",
+	"FSI FSI R PDI L PDI", "PDI L", "RLI PDF L PDI",
+	"RLE LRI R PDF PDI L", "R LRI L RLE AN PDF PDI EN",
+}
+
+// texts cover paired brackets, numbers, mirrored characters and explicit
+// formatting characters in Hebrew and Arabic text.
+var texts = []string{
+	"abc (אבג) def", "אבג (abc) דהו", "אבג [abc דהו] זחט",
+	"אב(גד[&ef]!)gh", "smith (fabrikam العربية) עברית", "العربية book(s)",
+	"a(b[c)d]e", "א(ב[ג)ד]ה", "a (b", "א (b", "a ]א[ c", "א)b(ג",
+	"א\u3008b\u3009", "א\u2329b\u3009", "a\u3008א\u232ab",
+	"א(b)\u0301c", "a(א)\u0301b", "א (\u0301b) ג",
+	"א 12.5%", "ع \u0661\u0662\u0663 456", "$12 א", "א 1-2", "a 1/2 א",
+	"א +1,000.50 $", "عدد: 12,5", "a \u0661\u0662\u0663 b",
+	"\u0661\u0662\u0663,\u0664\u0665\u0666", "א 1:2:3",
+	"a \u2067אב\u2069 c", "א \u2066ab\u2069 ג", "\u2068אב\u2069 c",
+	"\u2068ab\u2069 א", "a \u2067b\u2069 c", "א \u2067ב (c\u2069 ד",
+	"\u202babc\u202c d", "\u202eabc\u202c d", "a \u202dאב\u202c c", "א\u202aבג\u202cד",
+	"א < ב", "א ≤ ב", "א « ב »", "a « ב » c",
+	"abc", "אבג", "a\tב c", "א  ", "a \u00adב", "א\u200dב",
+}
+
+// result is the outcome of ICU for a text and a paragraph direction.
+type result struct {
+	para          int
+	levels, order string
+}
+
+// resolve returns the levels and the visual order of the text, where x
+// marks the characters which are removed by rule X9. Dir is 0 for
+// left-to-right, 1 for right-to-left and 2 for auto. It reports false if
+// the case is left out.
+func resolve(text []rune, dir int) (result, bool) {
+	u := utf16.Encode(text)
+	index := make([]int, 0, len(u)) // index of the rune of a code unit
+	for i, r := range text {
+		index = append(index, i)
+		if r >= 0x10000 {
+			index = append(index, i)
+		}
+	}
+	levels := make([]C.UBiDiLevel, len(u))
+	order := make([]C.int, len(u))
+	para := C.resolve((*C.UChar)(unsafe.Pointer(&u[0])), C.int(len(u)), C.int(dir), &levels[0], &order[0])
+	if para < 0 {
+		log.Fatalf("%q: ICU failed", string(text))
+	}
+
+	var ls, os []string
+	removed := make([]bool, len(text))
+	raise := false // whether the algorithm raises the level of some text
+	same := true   // whether ICU gives all characters the paragraph level
+	open := false  // whether an embedding or isolate was started
+	for k, i := range index {
+		if k > 0 && index[k-1] == i {
+			continue
+		}
+		switch C.direction(C.UChar32(text[i])) {
+		case C.U_BOUNDARY_NEUTRAL, C.U_POP_DIRECTIONAL_FORMAT:
+			removed[i] = true
+		case C.U_LEFT_TO_RIGHT_EMBEDDING, C.U_LEFT_TO_RIGHT_OVERRIDE,
+			C.U_RIGHT_TO_LEFT_EMBEDDING, C.U_RIGHT_TO_LEFT_OVERRIDE:
+			removed[i] = true
+			open = true
+		case C.U_LEFT_TO_RIGHT_ISOLATE, C.U_RIGHT_TO_LEFT_ISOLATE, C.U_FIRST_STRONG_ISOLATE:
+			open = true
+		case C.U_POP_DIRECTIONAL_ISOLATE:
+		case C.U_BLOCK_SEPARATOR:
+			open = false
+		case C.U_ARABIC_NUMBER:
+			raise = true
+		default:
+			raise = raise || open
+		}
+		if removed[i] {
+			ls = append(ls, "x")
+			continue
+		}
+		ls = append(ls, strconv.Itoa(int(levels[k])))
+		same = same && int(levels[k]) == int(para)
+	}
+	last := -1
+	for _, k := range order {
+		if i := index[k]; !removed[i] && i != last {
+			os = append(os, strconv.Itoa(i))
+			last = i
+		}
+	}
+	if same && raise {
+		return result{}, false
+	}
+	return result{int(para), strings.Join(ls, " "), strings.Join(os, " ")}, true
+}
+
+func main() {
+	var v [C.U_MAX_VERSION_STRING_LENGTH]C.char
+	C.version(&v[0])
+	version := C.GoString(&v[0])
+	if err := writeBidiTest(version); err != nil {
+		log.Fatal(err)
+	}
+	if err := writeBidiCharacterTest(version); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeBidiTest(version string) error {
+	var seqs [][]string
+	for _, a := range names {
+		seqs = append(seqs, []string{a})
+	}
+	for _, a := range names {
+		for _, b := range names {
+			if a != "B" {
+				seqs = append(seqs, []string{a, b})
+			}
+		}
+	}
+	for _, s := range sequences {
+		seqs = append(seqs, strings.Fields(s))
+	}
+
+	// the sequences are grouped by their levels and order
+	type key struct{ levels, order string }
+	var keys []key
+	groups := make(map[key][]string)
+	for _, seq := range seqs {
+		var text []rune
+		for _, name := range seq {
+			text = append(text, samples[name])
+		}
+		bits := make(map[key]int)
+		var order []key
+		for dir, bit := range []int{2, 4, 1} {
+			res, ok := resolve(text, dir)
+			if !ok {
+				continue
+			}
+			k := key{res.levels, res.order}
+			if _, ok := bits[k]; !ok {
+				order = append(order, k)
+			}
+			bits[k] |= bit
+		}
+		for _, k := range order {
+			if groups[k] == nil {
+				keys = append(keys, k)
+			}
+			groups[k] = append(groups[k], fmt.Sprintf("%s; %d", strings.Join(seq, " "), bits[k]))
+		}
+	}
+
+	return writeFile("BidiTest.txt", func(w *bufio.Writer) {
+		fmt.Fprintf(w, `# Test cases for the Unicode Bidirectional Algorithm in the format of
+# BidiTest.txt of the Unicode Character Database, which can be used
+# instead of this file.
+#
+# This file was generated by gen.go with ICU %s. It covers all sequences
+# of one and two bidirectional character types and a few longer sequences.
+# See gen.go for the cases which are left out.
+#
+# @Levels: the resolved levels, x for characters removed by rule X9
+# @Reorder: the visual order of the characters which are not removed
+# Data lines: the character types; a bitset of the paragraph directions
+#   1 = auto, 2 = left-to-right, 4 = right-to-left
+`, version)
+		for _, k := range keys {
+			fmt.Fprintf(w, "\n@Levels:\t%s\n@Reorder:\t%s\n", k.levels, k.order)
+			for _, line := range groups[k] {
+				fmt.Fprintln(w, line)
+			}
+		}
+	})
+}
+
+func writeBidiCharacterTest(version string) error {
+	return writeFile("BidiCharacterTest.txt", func(w *bufio.Writer) {
+		fmt.Fprintf(w, `# Test cases for the Unicode Bidirectional Algorithm in the format of
+# BidiCharacterTest.txt of the Unicode Character Database, which can be
+# used instead of this file.
+#
+# This file was generated by gen.go with ICU %s. The cases cover paired
+# brackets, numbers, mirrored characters and explicit formatting
+# characters in Hebrew and Arabic text. See gen.go for the cases which are
+# left out.
+#
+# Field 0: the code points of the text
+# Field 1: the paragraph direction, 0 = left-to-right, 1 = right-to-left
+#   and 2 = auto
+# Field 2: the resolved paragraph level
+# Field 3: the resolved levels, x for characters removed by rule X9
+# Field 4: the visual order of the characters which are not removed
+
+`, version)
+		for _, s := range texts {
+			text := []rune(s)
+			var cps []string
+			for _, r := range text {
+				cps = append(cps, fmt.Sprintf("%04X", r))
+			}
+			for dir := 0; dir < 3; dir++ {
+				if res, ok := resolve(text, dir); ok {
+					fmt.Fprintf(w, "%s;%d;%d;%s;%s\n", strings.Join(cps, " "), dir, res.para, res.levels, res.order)
+				}
+			}
+		}
+	})
+}
+
+func writeFile(name string, fn func(w *bufio.Writer)) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fn(w)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
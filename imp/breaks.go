@@ -0,0 +1,73 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import "github.com/tux21b/imp/imp/linebreak"
+
+// FindBreaks inserts the break opportunities of the Unicode Line Breaking
+// Algorithm (UAX #14) within words, e.g. between Chinese ideographs or
+// after a slash. A word is a run of text which may contain changes of the
+// style. Breaks at spaces and hyphens are already found by Lex and
+// Hyphenate.
+func (m *Imp) FindBreaks(tokens []Token) []Token {
+	ntokens := make([]Token, 0, len(tokens))
+	for start := 0; start < len(tokens); {
+		end := start
+		for end < len(tokens) && inWord(tokens[end]) {
+			end++
+		}
+		if end == start {
+			ntokens = append(ntokens, tokens[start])
+			start++
+			continue
+		}
+		ntokens = appendWord(ntokens, tokens[start:end])
+		start = end
+	}
+	return ntokens
+}
+
+// inWord reports whether t is part of a word.
+func inWord(t Token) bool {
+	switch t.(type) {
+	case Text, Pos, SetFont, SetTextColor, StateAction, BeginGroup, EndGroup:
+		return true
+	}
+	return false
+}
+
+// appendWord appends the tokens of a word and the break opportunities
+// within it.
+func appendWord(tokens []Token, word []Token) []Token {
+	var runes []rune
+	for _, tok := range word {
+		if t, ok := tok.(Text); ok {
+			runes = append(runes, []rune(string(t))...)
+		}
+	}
+	breaks := linebreak.Breaks(runes)
+	k := 0
+	for _, tok := range word {
+		t, ok := tok.(Text)
+		if !ok {
+			tokens = append(tokens, tok)
+			continue
+		}
+		start := 0
+		for i := range string(t) {
+			if breaks[k] != linebreak.NoBreak {
+				if i > start {
+					tokens = append(tokens, t[start:i])
+				}
+				tokens = append(tokens, CanBreak{})
+				start = i
+			}
+			k++
+		}
+		if start < len(t) {
+			tokens = append(tokens, t[start:])
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var languages = map[string]string{
+	"english": "en",
+	"german":  "de",
+	"turkish": "tr",
+	"greek":   "el",
+}
+
+// The built-in macros are registered like any other plug-in.
+func init() {
+	token := func(name string, t Token) {
+		RegisterMacro(name, 0, func([][]Token) ([]Token, error) {
+			return []Token{t}, nil
+		})
+	}
+	action := func(name string, fn func(s *State)) {
+		token(name, StateAction(fn))
+	}
+	number := func(name string, fn func(s *State, n float64)) {
+		RegisterMacro(name, 1, func(args [][]Token) ([]Token, error) {
+			n, err := strconv.ParseFloat(PlainText(args[0]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", PlainText(args[0]))
+			}
+			return []Token{StateAction(func(s *State) { fn(s, n) })}, nil
+		})
+	}
+
+	for _, c := range []string{"{", "}", "#", "\\"} {
+		token(c, Text(c))
+	}
+	token("par", ParagraphBreak{})
+	token("break", LineBreak{Forced: true})
+	token("nextcolumn", ColBreak{})
+	token("Large", SetFont{Size: 24})
+	token("large", SetFont{Size: 14})
+	token("normalsize", SetFont{Size: 12})
+	token("blue", SetTextColor{1, .34, 0, .21})
+	token("black", SetTextColor{0, 0, 0, 1})
+	action("smcpon", func(s *State) {
+		s.SetFeature("smcp", true)
+	})
+	action("smcpoff", func(s *State) {
+		s.SetFeature("smcp", false)
+	})
+	for name, lang := range languages {
+		lang := lang
+		action(name, func(s *State) {
+			s.Language = lang
+		})
+	}
+	action("justify", func(s *State) {
+		s.Justify = true
+	})
+	action("raggedright", func(s *State) {
+		s.Justify = false
+	})
+	action("column", func(s *State) {
+		s.setColumns(2)
+	})
+	RegisterMacro("columns", 1, func(args [][]Token) ([]Token, error) {
+		n, err := strconv.Atoi(PlainText(args[0]))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid number of columns %q", PlainText(args[0]))
+		}
+		return []Token{StateAction(func(s *State) { s.setColumns(n) })}, nil
+	})
+	action("keepnext", func(s *State) {
+		s.KeepWithNext = true
+	})
+	action("hyphenon", func(s *State) {
+		s.Hyphenate = true
+	})
+	action("hyphenoff", func(s *State) {
+		s.Hyphenate = false
+	})
+	number("tolerance", func(s *State, n float64) {
+		s.Tolerance = n
+	})
+	number("looseness", func(s *State, n float64) {
+		s.Looseness = int(n)
+	})
+	number("widowpenalty", func(s *State, n float64) {
+		s.WidowPenalty = n
+	})
+	number("orphanpenalty", func(s *State, n float64) {
+		s.OrphanPenalty = n
+	})
+	RegisterMacro("hyphenation", 1, func(args [][]Token) ([]Token, error) {
+		return []Token{hyphenation(strings.Fields(PlainText(args[0])))}, nil
+	})
+}
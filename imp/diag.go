@@ -0,0 +1,37 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import "fmt"
+
+// A Diagnostic reports a problem in the source of a document, like an
+// unknown macro or a line which is too wide.
+type Diagnostic struct {
+	Pos     Pos
+	Message string
+}
+
+// Error returns the message of the diagnostic. Use Document.Position to
+// locate it.
+func (d Diagnostic) Error() string {
+	return d.Message
+}
+
+func (m *Imp) errorf(pos Pos, format string, args ...interface{}) {
+	m.Diagnostics = append(m.Diagnostics, Diagnostic{pos, fmt.Sprintf(format, args...)})
+}
+
+// A Position is a location in a source file. Lines and columns start at 1
+// and columns are counted in characters.
+type Position struct {
+	File      string
+	Line, Col int
+}
+
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Col)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
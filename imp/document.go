@@ -0,0 +1,611 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/tux21b/imp/imp/otf"
+	"github.com/tux21b/imp/imp/pdf"
+)
+
+// A Document is a marked up text which is typeset and rendered as PDF.
+type Document struct {
+	Title string
+	Page  *Box        // size and padding of the pages
+	Image image.Image // optional image at the bottom of the first page
+
+	Compress      bool // compress the streams of the PDF file
+	ObjectStreams bool // write a PDF 1.5 file with object streams
+
+	// Markdown are the styles of text added by AddMarkdown.
+	Markdown MarkdownStyles
+
+	// Fallbacks are the fonts, in order, which are used for characters
+	// without a glyph in the selected font.
+	Fallbacks []*otf.Font
+
+	// Diagnostics lists the problems found by the last call of Render.
+	Diagnostics []Diagnostic
+
+	fonts map[string]*otf.Font
+	text  bytes.Buffer
+	files []sourceFile
+}
+
+// A sourceFile is a part of the text which was added by AddFile or
+// AddMarkdown.
+type sourceFile struct {
+	name     string
+	start    int
+	markdown bool
+}
+
+// NewDocument returns an empty A4 document.
+func NewDocument() *Document {
+	return &Document{
+		Page: &Box{
+			Width:         MustParseLength("160mm"),
+			Height:        MustParseLength("252mm"),
+			PaddingTop:    MustParseLength("25mm"),
+			PaddingRight:  MustParseLength("25mm"),
+			PaddingBottom: MustParseLength("20mm"),
+			PaddingLeft:   MustParseLength("25mm"),
+		},
+		Compress: true,
+		Markdown: DefaultMarkdownStyles(),
+		fonts:    make(map[string]*otf.Font),
+	}
+}
+
+// AddFont registers a font which is selected by the macro \name. The font
+// called "normal" is used by default.
+func (d *Document) AddFont(name string, f *otf.Font) {
+	d.fonts[name] = f
+}
+
+// AddText appends marked up text to the document.
+func (d *Document) AddText(text string) {
+	d.AddFile("", text)
+}
+
+// AddFile appends marked up text which was read from the named file. The
+// name is used to report positions.
+func (d *Document) AddFile(name string, text string) {
+	d.files = append(d.files, sourceFile{name, d.text.Len(), false})
+	d.text.WriteString(text)
+}
+
+// AddMarkdown appends a Markdown document which was read from the named
+// file. See LexMarkdown for the supported syntax.
+func (d *Document) AddMarkdown(name string, text string) {
+	d.files = append(d.files, sourceFile{name, d.text.Len(), true})
+	d.text.WriteString(text)
+}
+
+// Position returns the file, line and column of a position.
+func (d *Document) Position(pos Pos) Position {
+	p := Position{Line: 1, Col: 1}
+	start := 0
+	for _, f := range d.files {
+		if f.start <= int(pos) {
+			p.File, start = f.name, f.start
+		}
+	}
+	text := d.text.Bytes()
+	if int(pos) > len(text) {
+		pos = Pos(len(text))
+	}
+	for _, r := range string(text[start:pos]) {
+		if r == '\n' {
+			p.Line++
+			p.Col = 1
+		} else {
+			p.Col++
+		}
+	}
+	return p
+}
+
+// runePos returns the position of the byte i of a text which originates
+// from the word at pos. The text can be a part of the word, e.g. after
+// hyphenation. Texts which are not found in the word, like the results of
+// macros, are reported at pos.
+func (d *Document) runePos(pos Pos, text string, i int) Pos {
+	src := d.text.String()
+	if pos < 0 || int(pos) >= len(src) {
+		return pos
+	}
+	word := src[pos:]
+	if end := strings.IndexFunc(word, isBreakingSpace); end >= 0 {
+		word = word[:end]
+	}
+	if k := strings.Index(word, text); k >= 0 {
+		return pos + Pos(k+i)
+	}
+	return pos
+}
+
+// Render typesets the document and writes it as PDF. Problems which do not
+// prevent the output are stored in Diagnostics.
+func (d *Document) Render(out io.Writer) error {
+	d.Diagnostics = nil
+	font := d.fonts["normal"]
+	if font == nil {
+		return errors.New("imp: no normal font")
+	}
+	m := &Imp{
+		State: &State{
+			Font:       font,
+			Fallbacks:  d.Fallbacks,
+			Size:       12,
+			Features:   []string{"ccmp", "locl", "liga", "kern", "mark", "mkmk"},
+			Color:      SetTextColor{0, 0, 0, 1},
+			LineHeight: 1.4,
+			ParSkip:    1.8,
+			MaxWidth:   float64(d.Page.Width.Computed),
+			TextWidth:  float64(d.Page.Width.Computed),
+			Tolerance:  200,
+			Hyphenate:  true,
+
+			WidowPenalty:  150,
+			OrphanPenalty: 150,
+		},
+	}
+
+	defer func() {
+		sort.SliceStable(m.Diagnostics, func(i, j int) bool {
+			return m.Diagnostics[i].Pos < m.Diagnostics[j].Pos
+		})
+		d.Diagnostics = m.Diagnostics
+	}()
+
+	w := pdf.NewPDFWriter(out)
+	w.Compress = d.Compress
+	w.ObjectStreams = d.ObjectStreams
+	w.WriteHeader()
+
+	var (
+		info     = w.NextID()
+		root     = w.NextID()
+		pages    = w.NextID()
+		page     = w.NextID()
+		contents = w.NextID()
+		imgId    int
+	)
+	if d.Image != nil {
+		imgId = w.NextID()
+	}
+	pageB := d.Page
+
+	tokens, err := d.tokens(m)
+	if err != nil {
+		if diag, ok := err.(Diagnostic); ok {
+			return fmt.Errorf("%s: %s", d.Position(diag.Pos), diag.Message)
+		}
+		return err
+	}
+	tokens = m.Hyphenate(tokens)
+	tokens = m.FindBreaks(tokens)
+	tokens = m.ResolveBidi(tokens)
+	tokens = m.SplitLines(tokens, 0)
+	tokens = m.ReorderLines(tokens)
+
+	infoDict := pdf.Dict{}
+	if d.Title != "" {
+		infoDict["Title"] = pdf.TextString(d.Title)
+	}
+	w.WriteObject(info, infoDict)
+	w.WriteObject(root, pdf.Dict{"Type": pdf.Name("Catalog"), "Pages": pdf.Ref(pages)})
+
+	w.WriteObject(page, newPageObject(pages, contents))
+	pageIds := []int{page}
+
+	firstBottom := float64(pageB.PaddingBottom.Computed)
+	var imgB *ImageBox
+	if d.Image != nil {
+		imgS := d.Image.Bounds().Size()
+		imgB = &ImageBox{
+			B: Bounds{
+				X: float64(pageB.PaddingLeft.Computed),
+				Y: float64(pageB.PaddingBottom.Computed),
+				W: float64(pageB.Width.Computed),
+				H: float64(imgS.Y) * float64(pageB.Width.Computed) / float64(imgS.X),
+			},
+			Img: d.Image,
+		}
+		firstBottom = imgB.B.Y + imgB.B.H
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, ".5 w .9 G %.4f %.4f %.4f %.4f re S\n",
+		pageB.PaddingLeft.Computed,
+		pageB.PaddingBottom.Computed,
+		pageB.Width.Computed,
+		pageB.Height.Computed)
+	top := float64(pageB.PaddingBottom.Computed + pageB.Height.Computed)
+	tokens = m.BreakPages(tokens, top, func(page int) float64 {
+		if page == 0 {
+			return firstBottom
+		}
+		return float64(pageB.PaddingBottom.Computed)
+	})
+	xPos := float64(pageB.PaddingLeft.Computed)
+	m.State.YPos = top - m.CalcMaxAscent(tokens)
+	fmt.Fprintf(buf, "BT %s %.4f Tf\n1.4 TL\n%.4f %.4f Td\n",
+		m.GetFontId(m.State.Font), m.State.Size, xPos, m.State.YPos)
+
+	inTJ := false
+	finishPage := func() {
+		if inTJ {
+			buf.WriteString("] TJ\n")
+			inTJ = false
+		}
+		buf.WriteString("ET\n")
+		if len(pageIds) == 1 && imgB != nil {
+			fmt.Fprintf(buf, `q 1 0 0 1 %.4f %.4f cm %.4f 0 0 %.4f 0 0 cm /I1 Do Q `,
+				imgB.B.X, imgB.B.Y, imgB.B.W, imgB.B.H)
+		}
+		w.WriteObject(contents, &pdf.Stream{Data: buf.Bytes()})
+		buf.Reset()
+	}
+	newPage := func(rest []Token) {
+		finishPage()
+		page, contents = w.NextID(), w.NextID()
+		w.WriteObject(page, newPageObject(pages, contents))
+		pageIds = append(pageIds, page)
+
+		s := m.State
+		xPos = float64(pageB.PaddingLeft.Computed)
+		s.Column = 0
+		fmt.Fprintf(buf, ".5 w .9 G %.4f %.4f %.4f %.4f re S\n",
+			pageB.PaddingLeft.Computed,
+			pageB.PaddingBottom.Computed,
+			pageB.Width.Computed,
+			pageB.Height.Computed)
+		s.YPos = top - m.CalcMaxAscent(rest)
+		s.ColStart = s.YPos
+		fmt.Fprintf(buf, "BT %s %.4f Tf\n%.4f %.4f %.4f %.4f k\n1.4 TL\n%.4f %.4f Td\n",
+			m.GetFontId(s.Font), s.Size, s.Color.C, s.Color.M, s.Color.Y, s.Color.K,
+			xPos, s.YPos)
+	}
+
+	wordSpacing := 0.0
+	updateSpacing := -1
+	yMin := 0.0
+	lineX := 0.0 // position within the current line
+	srcPos := Pos(0)
+	missing := make(map[*otf.Font]map[rune]bool)
+	for pos, token := range tokens {
+		if pos >= updateSpacing {
+			width := 0.0
+			numSpaces := 0
+			wordSpacing = 0
+			updateSpacing = len(tokens)
+			s := m.State.Clone()
+			for i := pos; i < len(tokens); i++ {
+				w := GetWidth(s, tokens[i])
+				switch t := tokens[i].(type) {
+				case LineBreak:
+					if s.Justify && !t.Forced {
+						wordSpacing = (s.MaxWidth - width) / float64(numSpaces)
+					} else {
+						wordSpacing = 0
+					}
+					updateSpacing = i + 1
+					i = len(tokens)
+				case ParagraphBreak:
+					updateSpacing = i + 1
+					i = len(tokens)
+				case Space:
+					numSpaces++
+				}
+				width += w
+			}
+		}
+
+		switch x := token.(type) {
+		case Text:
+			lineX += GetWidth(m.State, x)
+			primary := m.State.Font
+			for i, r := range string(x) {
+				if unicode.IsGraphic(r) && m.State.fontFor(r) == nil && !missing[primary][r] {
+					if missing[primary] == nil {
+						missing[primary] = make(map[rune]bool)
+					}
+					missing[primary][r] = true
+					p := d.runePos(srcPos, string(x), i)
+					if len(m.State.Fallbacks) == 0 {
+						m.errorf(p, "font %s has no glyph for %q", primary.PostscriptName, r)
+					} else {
+						m.errorf(p, "font %s and its fallbacks have no glyph for %q", primary.PostscriptName, r)
+					}
+				}
+			}
+			// runs set in a fallback font switch the font temporarily
+			font := primary
+			for _, run := range m.State.fontRuns(string(x)) {
+				if run.font != font {
+					if inTJ {
+						buf.WriteString("] TJ\n")
+						inTJ = false
+					}
+					font = run.font
+					fmt.Fprintf(buf, "%s %.4f Tf\n", m.GetFontId(font), m.State.Size)
+				}
+				if !inTJ {
+					buf.WriteString("[")
+					inTJ = true
+				}
+				glyphs := m.State.shape(font, run.text)
+				adjust, rise := 0, 0
+				buf.WriteString("<")
+				for _, g := range glyphs {
+					m.UseGlyphs(font, g.Index)
+					if g.YOffset != rise {
+						rise = g.YOffset
+						fmt.Fprintf(buf, "> ] TJ\n%.4f Ts\n[<",
+							float64(rise)/float64(font.UnitsPerEm)*m.State.Size)
+					}
+					adjust += g.XOffset
+					if kern := font.Scale(adjust, 1000); kern != 0 {
+						fmt.Fprintf(buf, "> %d <", -kern)
+					}
+					fmt.Fprintf(buf, "%04x", g.Index)
+					adjust = g.XAdvance - font.HMetric(g.Index).Width - g.XOffset
+				}
+				buf.WriteString("> ")
+				if kern := font.Scale(adjust, 1000); kern != 0 {
+					fmt.Fprintf(buf, "%d ", -kern)
+				}
+				if rise != 0 {
+					buf.WriteString("] TJ\n0 Ts\n[")
+				}
+			}
+			if font != primary {
+				buf.WriteString("] TJ\n")
+				inTJ = false
+				fmt.Fprintf(buf, "%s %.4f Tf\n", m.GetFontId(primary), m.State.Size)
+			}
+		case Space:
+			if !inTJ {
+				buf.WriteString("[")
+				inTJ = true
+			}
+			space := m.State.Font.Index(' ')
+			m.UseGlyphs(m.State.Font, space)
+			fmt.Fprintf(buf, "<%04x> ", space)
+			lineX += GetWidth(m.State, x)
+			if wordSpacing != 0 {
+				kern := -int(wordSpacing / m.State.Size * 1000)
+				fmt.Fprintf(buf, "%d ", kern)
+				lineX -= float64(kern) / 1000 * m.State.Size
+			}
+		case Inline:
+			if inTJ {
+				buf.WriteString("] TJ\n")
+				inTJ = false
+			}
+			fmt.Fprintf(buf, "ET\nq 1 0 0 1 %.4f %.4f cm\n", xPos+lineX, m.State.YPos)
+			x.Draw(m.State, buf)
+			lineX += x.Width(m.State)
+			fmt.Fprintf(buf, "Q\nBT\n%.4f %.4f Td\n[%d] TJ\n",
+				xPos, m.State.YPos, -int(lineX/m.State.Size*1000))
+		case LineBreak:
+			lineX = 0
+			if inTJ {
+				buf.WriteString("] TJ\n")
+				inTJ = false
+			}
+			fmt.Fprintf(buf, "0 %.4f Td\n", -m.State.LineHeight*m.State.Size)
+			m.State.YPos += -m.State.LineHeight * float64(m.State.Size)
+		case ParagraphBreak:
+			lineX = 0
+			if inTJ {
+				buf.WriteString("] TJ\n")
+				inTJ = false
+			}
+			fmt.Fprintf(buf, "0 %.4f Td\n", -m.State.LineHeight*m.State.Size*m.State.ParSkip)
+			m.State.YPos += -m.State.LineHeight * float64(m.State.Size) * m.State.ParSkip
+			m.State.KeepWithNext = false
+		case ColBreak:
+			lineX = 0
+			if inTJ {
+				buf.WriteString("] TJ\n")
+				inTJ = false
+			}
+			yOff := m.State.ColStart - m.State.YPos
+			xOff := (float64(pageB.Width.Computed) - m.State.MaxWidth) / float64(m.State.Columns-1)
+			fmt.Fprintf(buf, "%.4f %.4f Td\n", xOff, yOff)
+			xPos += xOff
+			yMin = m.State.YPos
+			m.State.nextColumn()
+		case PageBreak:
+			lineX = 0
+			newPage(tokens[pos+1:])
+		case SetFont:
+			if inTJ {
+				buf.WriteString("] TJ\n")
+				inTJ = false
+			}
+			if x.Font != nil {
+				m.State.Font = x.Font
+			}
+			if x.Size != 0 {
+				m.State.Size = float64(x.Size)
+			}
+			id := m.GetFontId(m.State.Font)
+			fmt.Fprintf(buf, "%s %.4f Tf\n", id, m.State.Size)
+		case SetTextColor:
+			if inTJ {
+				buf.WriteString("] TJ\n")
+				inTJ = false
+			}
+			fmt.Fprintf(buf, "%.4f %.4f %.4f %.4f k\n", x.C, x.M, x.Y, x.K)
+			m.State.Color = x
+		case StateAction:
+			x(m.State)
+		case Pos:
+			srcPos = x
+		case BeginGroup:
+			m.State.beginGroup()
+		case EndGroup:
+			prev := m.State.Clone()
+			m.State.endGroup()
+			s := m.State
+			if inTJ && (s.Font != prev.Font || s.Size != prev.Size || s.Color != prev.Color) {
+				buf.WriteString("] TJ\n")
+				inTJ = false
+			}
+			if s.Font != prev.Font || s.Size != prev.Size {
+				fmt.Fprintf(buf, "%s %.4f Tf\n", m.GetFontId(s.Font), s.Size)
+			}
+			if s.Color != prev.Color {
+				fmt.Fprintf(buf, "%.4f %.4f %.4f %.4f k\n", s.Color.C, s.Color.M, s.Color.Y, s.Color.K)
+			}
+			if s.Columns != prev.Columns {
+				// continue in the first column below the columns of the group
+				if inTJ {
+					buf.WriteString("] TJ\n")
+					inTJ = false
+				}
+				left := float64(pageB.PaddingLeft.Computed)
+				fmt.Fprintf(buf, "%.4f %.4f Td\n", left-xPos, s.YPos-prev.YPos)
+				xPos = left
+			}
+		}
+	}
+	finishPage()
+
+	if y := m.State.YPos; y < yMin {
+		yMin = y
+	}
+
+	fonts := make(pdf.Dict)
+	fontIds := make([]int, len(m.Fonts))
+	for i := range m.Fonts {
+		fontIds[i] = w.NextID()
+		fonts[pdf.Name(fmt.Sprintf("F%d", i+1))] = pdf.Ref(fontIds[i])
+	}
+	kids := make(pdf.Array, len(pageIds))
+	for i, id := range pageIds {
+		kids[i] = pdf.Ref(id)
+	}
+	resources := pdf.Dict{
+		"Font": fonts,
+		"ProcSet": pdf.Array{pdf.Name("PDF"), pdf.Name("Text"),
+			pdf.Name("ImageB"), pdf.Name("ImageC"), pdf.Name("ImageI")},
+	}
+	if d.Image != nil {
+		resources["XObject"] = pdf.Dict{"I1": pdf.Ref(imgId)}
+	}
+	w.WriteObject(pages, pdf.Dict{
+		"Type": pdf.Name("Pages"),
+		"MediaBox": pdf.Array{pdf.Number(0), pdf.Number(0),
+			pdf.Number(pageB.TotalWidth()), pdf.Number(pageB.TotalHeight())},
+		"Resources": resources,
+		"Kids":      kids,
+		"Count":     pdf.Number(len(pageIds)),
+	})
+
+	for i := range m.Fonts {
+		w.WriteFontEmbedded(fontIds[i], m.Fonts[i], m.UsedGlyphs(m.Fonts[i]))
+	}
+	if d.Image != nil {
+		w.WriteImageJPEG(imgId, d.Image)
+	}
+
+	w.WriteFooter(root, info)
+	return w.Err()
+}
+
+// tokens converts the text of the document into tokens.
+func (d *Document) tokens(m *Imp) ([]Token, error) {
+	var tokens []Token
+	src := d.text.String()
+	for i := 0; i < len(d.files); {
+		f, j := d.files[i], i+1
+		for j < len(d.files) && d.files[j].markdown == f.markdown {
+			j++
+		}
+		end := len(src)
+		if j < len(d.files) {
+			end = d.files[j].start
+		}
+		var lexed []Token
+		if f.markdown {
+			lexed = LexMarkdown(src[f.start:end], &d.Markdown)
+		} else {
+			lexed = Lex(src[f.start:end])
+		}
+		for _, tok := range lexed {
+			if p, ok := tok.(Pos); ok {
+				tok = p + Pos(f.start)
+			}
+			tokens = append(tokens, tok)
+		}
+		i = j
+	}
+	if len(tokens) > 0 && isSpace(tokens[0]) {
+		tokens = tokens[1:]
+	}
+	if len(tokens) > 0 && isSpace(tokens[len(tokens)-1]) {
+		tokens = tokens[:len(tokens)-1]
+	}
+	tokens, err := m.ExpandMacros(tokens)
+	if err != nil {
+		return nil, err
+	}
+	pos := Pos(0)
+	for i := 0; i < len(tokens); i++ {
+		switch tok := tokens[i].(type) {
+		case Pos:
+			pos = tok
+		case Macro:
+			if f := d.fonts[string(tok[1:])]; f != nil {
+				tokens[i] = SetFont{Font: f}
+				break
+			}
+			m.errorf(pos, "unknown macro %s", tok)
+			tokens = append(tokens[:i], tokens[i+1:]...)
+			i--
+		case Space:
+			if i > 0 && isParagraphBreak(tokens[i-1]) {
+				// spaces after an expanded \par are ignored
+				tokens = append(tokens[:i], tokens[i+1:]...)
+				i--
+			} else if tok.paragraph() {
+				tokens[i] = ParagraphBreak{}
+			} else {
+				tokens[i] = CanBreak{NoBreak: tok}
+			}
+		}
+	}
+	return tokens, nil
+}
+
+func isSpace(t Token) bool {
+	_, ok := t.(Space)
+	return ok
+}
+
+func isParagraphBreak(t Token) bool {
+	_, ok := t.(ParagraphBreak)
+	return ok
+}
+
+func newPageObject(parent, contents int) pdf.Dict {
+	return pdf.Dict{
+		"Type":     pdf.Name("Page"),
+		"Parent":   pdf.Ref(parent),
+		"Contents": pdf.Ref(contents),
+	}
+}
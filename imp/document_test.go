@@ -0,0 +1,349 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tux21b/imp/imp/otf"
+)
+
+// newTestDocument returns an uncompressed document which uses the regular
+// font of the repository.
+func newTestDocument(t *testing.T) *Document {
+	f, err := otf.Open("../fonts/SourceSansPro-Regular.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDocument()
+	d.AddFont("normal", f)
+	d.Compress = false
+	return d
+}
+
+var objectPattern = regexp.MustCompile(`(?s)(\d+) 0 obj\n(.*?)\nendobj\n`)
+
+// pdfObjects returns the indirect objects of a document which is written
+// without object streams.
+func pdfObjects(data []byte) map[int]string {
+	objects := make(map[int]string)
+	for _, m := range objectPattern.FindAllSubmatch(data, -1) {
+		id, _ := strconv.Atoi(string(m[1]))
+		objects[id] = string(m[2])
+	}
+	return objects
+}
+
+// refs returns the ids of the objects referenced by the given key of a
+// dictionary, e.g. of /Contents 5 0 R or /Kids [4 0 R 6 0 R].
+func refs(obj string, key string) []int {
+	m := regexp.MustCompile(`/` + key + ` (\[[^\]]*\]|\d+ 0 R)`).FindStringSubmatch(obj)
+	if m == nil {
+		return nil
+	}
+	var ids []int
+	for _, r := range regexp.MustCompile(`(\d+) 0 R`).FindAllStringSubmatch(m[1], -1) {
+		id, _ := strconv.Atoi(r[1])
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// streamData returns the data of a stream object and checks its length.
+func streamData(t *testing.T, obj string) string {
+	i, j := strings.Index(obj, "\nstream\n"), strings.LastIndex(obj, "\nendstream")
+	if i < 0 || j < i {
+		t.Fatalf("not a stream: %.40q", obj)
+	}
+	data := obj[i+len("\nstream\n") : j]
+	if want := fmt.Sprintf("/Length %d ", len(data)); !strings.Contains(obj[:i], want) {
+		t.Errorf("the dictionary %q of a stream of %d bytes has the wrong length", obj[:i], len(data))
+	}
+	return data
+}
+
+func TestDocumentTitle(t *testing.T) {
+	for _, title := range []string{"", "Hello"} {
+		d := newTestDocument(t)
+		d.Title = title
+		d.AddText("Hello World")
+		var buf bytes.Buffer
+		if err := d.Render(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := bytes.Contains(buf.Bytes(), []byte("/Title")); got != (title != "") {
+			t.Errorf("title %q: /Title written = %v", title, got)
+		}
+	}
+}
+
+// withoutGlyphs returns a copy of the regular font of the repository whose
+// cmap does not map the given runes.
+func withoutGlyphs(t *testing.T, runes string) *otf.Font {
+	data, err := ioutil.ReadFile("../fonts/SourceSansPro-Regular.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := otf.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a format 12 subtable with a group for every run of mapped runes
+	var groups []uint32
+	for r := rune(0); r <= 0xffff; r++ {
+		g := f.Index(r)
+		if g == 0 || strings.ContainsRune(runes, r) {
+			continue
+		}
+		n := len(groups)
+		if n > 0 && groups[n-2] == uint32(r-1) && groups[n-1]+uint32(r)-groups[n-3] == uint32(g) {
+			groups[n-2] = uint32(r)
+		} else {
+			groups = append(groups, uint32(r), uint32(r), uint32(g))
+		}
+	}
+	cmap := []uint32{12 << 16, uint32(16 + 4*len(groups)), 0, uint32(len(groups) / 3)}
+	cmap = append(cmap, groups...)
+	table := &bytes.Buffer{}
+	binary.Write(table, binary.BigEndian, []uint16{0, 1, 3, 10, 0, 12})
+	binary.Write(table, binary.BigEndian, cmap)
+
+	// replace the cmap table in the table directory
+	n := int(binary.BigEndian.Uint16(data[4:]))
+	out := append([]byte(nil), data...)
+	for i := 0; i < n; i++ {
+		x := 12 + 16*i
+		if string(data[x:x+4]) == "cmap" {
+			binary.BigEndian.PutUint32(out[x+8:], uint32(len(out)))
+			binary.BigEndian.PutUint32(out[x+12:], uint32(table.Len()))
+		}
+	}
+	out = append(out, table.Bytes()...)
+	if f, err = otf.Parse(out); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFallbacks(t *testing.T) {
+	d := newTestDocument(t)
+	regular := d.fonts["normal"]
+	d.AddFont("normal", withoutGlyphs(t, "ß™"))
+	d.Fallbacks = []*otf.Font{regular}
+	d.AddFile("x.imp", "Straße Imp™ ☃")
+	var buf bytes.Buffer
+	if err := d.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// ß and ™ are set in the fallback font and the font is switched back
+	if n := bytes.Count(buf.Bytes(), []byte("/F2 12.0000 Tf")); n != 2 {
+		t.Errorf("got %d switches to the fallback font, want 2", n)
+	}
+	if n := bytes.Count(buf.Bytes(), []byte("/F1 12.0000 Tf")); n != 3 {
+		t.Errorf("got %d switches to the primary font, want 3", n)
+	}
+	var diags []string
+	for _, diag := range d.Diagnostics {
+		diags = append(diags, fmt.Sprintf("%s: %s", d.Position(diag.Pos), diag.Message))
+	}
+	want := []string{"x.imp:1:13: font SourceSansPro-Regular and its fallbacks have no glyph for '☃'"}
+	if !reflect.DeepEqual(diags, want) {
+		t.Errorf("got diagnostics %q, want %q", diags, want)
+	}
+}
+
+func TestMissingGlyphPos(t *testing.T) {
+	d := newTestDocument(t)
+	d.AddFile("x.imp", "abc def\nghi jkl אב\n")
+	if err := d.Render(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	var diags []string
+	for _, diag := range d.Diagnostics {
+		diags = append(diags, d.Position(diag.Pos).String())
+	}
+	if want := []string{"x.imp:2:9", "x.imp:2:10"}; !reflect.DeepEqual(diags, want) {
+		t.Errorf("missing glyphs are reported at %q, want %q", diags, want)
+	}
+}
+
+func TestPages(t *testing.T) {
+	d := newTestDocument(t)
+	d.AddText(strings.Repeat("Paragraph\n\n", 100))
+	var buf bytes.Buffer
+	if err := d.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	objects := pdfObjects(buf.Bytes())
+	var pages int
+	for id, obj := range objects {
+		if strings.HasPrefix(obj, "<< /Type /Pages ") {
+			pages = id
+		}
+	}
+	kids := refs(objects[pages], "Kids")
+	count := regexp.MustCompile(`/Count (\d+)`).FindStringSubmatch(objects[pages])
+	if len(kids) < 2 || count == nil || count[1] != strconv.Itoa(len(kids)) {
+		t.Fatalf("got the page tree %q, want more than one page", objects[pages])
+	}
+
+	// every page has its own content stream with the lines of the page
+	var lines []int
+	for i, kid := range kids {
+		page := objects[kid]
+		if !strings.HasPrefix(page, "<< /Type /Page ") || !reflect.DeepEqual(refs(page, "Parent"), []int{pages}) {
+			t.Errorf("page %d: got %q", i+1, page)
+		}
+		contents := refs(page, "Contents")
+		if len(contents) != 1 {
+			t.Fatalf("page %d: got %q", i+1, page)
+		}
+		data := streamData(t, objects[contents[0]])
+		if !strings.Contains(data, "BT ") || !strings.HasSuffix(data, "ET\n") {
+			t.Errorf("page %d: the text of the content stream is not closed", i+1)
+		}
+		lines = append(lines, strings.Count(data, "TJ\n"))
+	}
+	total := 0
+	for i, n := range lines {
+		if n == 0 || n != lines[0] && i < len(lines)-1 {
+			t.Errorf("got %v lines on the pages, want full pages", lines)
+			break
+		}
+		total += n
+	}
+	if total != 100 {
+		t.Errorf("the pages have %d lines, want 100", total)
+	}
+}
+
+// render renders a document and returns its objects.
+func render(t *testing.T, d *Document) map[int]string {
+	var buf bytes.Buffer
+	if err := d.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Diagnostics) > 0 {
+		t.Errorf("got diagnostics %v", d.Diagnostics)
+	}
+	return pdfObjects(buf.Bytes())
+}
+
+// pageTree returns the page tree and the content streams of the pages.
+func pageTree(t *testing.T, objects map[int]string) (string, []string) {
+	for _, obj := range objects {
+		if strings.HasPrefix(obj, "<< /Type /Pages ") {
+			var contents []string
+			for _, kid := range refs(obj, "Kids") {
+				contents = append(contents, streamData(t, objects[refs(objects[kid], "Contents")[0]]))
+			}
+			return obj, contents
+		}
+	}
+	t.Fatal("no page tree")
+	return "", nil
+}
+
+func TestAddFont(t *testing.T) {
+	if err := NewDocument().Render(ioutil.Discard); err == nil || err.Error() != "imp: no normal font" {
+		t.Errorf("got %v without fonts, want an error", err)
+	}
+
+	d := newTestDocument(t)
+	bold, err := otf.Open("../fonts/SourceSansPro-Bold.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.AddFont("bold", bold)
+	d.AddText(`Regular \bold Bold`)
+	objects := render(t, d)
+	pages, contents := pageTree(t, objects)
+
+	// the fonts are named in the order of their use
+	for i, name := range []string{"SourceSansPro-Regular", "SourceSansPro-Bold"} {
+		id := refs(pages, fmt.Sprintf("F%d", i+1))
+		if len(id) != 1 || !regexp.MustCompile(`/BaseFont /[A-Z]{6}\+`+name+` `).MatchString(objects[id[0]]) {
+			t.Errorf("/F%d: got %v, want the font %s in %q", i+1, id, name, pages)
+		}
+	}
+	if !strings.Contains(contents[0], "/F2 12.0000 Tf\n") {
+		t.Errorf("the content stream does not select the bold font")
+	}
+}
+
+func TestImage(t *testing.T) {
+	d := newTestDocument(t)
+	d.Image = image.NewRGBA(image.Rect(0, 0, 40, 20))
+	d.AddText(strings.Repeat("Paragraph\n\n", 40))
+	objects := render(t, d)
+	pages, contents := pageTree(t, objects)
+
+	img := refs(pages, "I1")
+	if len(img) != 1 {
+		t.Fatalf("got %q, want the image /I1 in the resources", pages)
+	}
+	obj := objects[img[0]]
+	for _, want := range []string{"/Type /XObject ", "/Subtype /Image ", "/Width 40 ", "/Height 20 ", "/Filter [/DCTDecode] "} {
+		if !strings.Contains(obj, want) {
+			t.Errorf("the image %.200q does not contain %q", obj, want)
+		}
+	}
+	if data := streamData(t, obj); !strings.HasPrefix(data, "\xff\xd8") {
+		t.Errorf("got %.10q, want JPEG data", data)
+	}
+
+	// the image fills the width of the text at the bottom of the first page
+	// and the text ends above it
+	box := d.Page
+	want := fmt.Sprintf("q 1 0 0 1 %.4f %.4f cm %.4f 0 0 %.4f 0 0 cm /I1 Do Q",
+		box.PaddingLeft.Computed, box.PaddingBottom.Computed, box.Width.Computed, box.Width.Computed/2)
+	if len(contents) < 2 || !strings.Contains(contents[0], want) || strings.Contains(contents[1], "/I1 Do") {
+		t.Errorf("got %d pages, want the image %q on the first page only", len(contents), want)
+	}
+	if len(contents) >= 2 && strings.Count(contents[0], "TJ\n") >= strings.Count(contents[1], "TJ\n") {
+		t.Errorf("the first page has as many lines as the second page")
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	text := strings.Repeat(lorem+"\n\n", 2)
+	d := newTestDocument(t)
+	d.AddText(text)
+	_, contents := pageTree(t, render(t, d))
+	lines := strings.Count(strings.Join(contents, ""), "TJ\n")
+
+	d = newTestDocument(t)
+	d.Page = &Box{
+		Width:         MustParseLength("100mm"),
+		Height:        MustParseLength("150mm"),
+		PaddingTop:    MustParseLength("10mm"),
+		PaddingRight:  MustParseLength("10mm"),
+		PaddingBottom: MustParseLength("10mm"),
+		PaddingLeft:   MustParseLength("10mm"),
+	}
+	d.AddText(text)
+	pages, contents := pageTree(t, render(t, d))
+	if want := "/MediaBox [0 0 340.1575 481.8898] "; !strings.Contains(pages, want) {
+		t.Errorf("got %q, want %q", pages, want)
+	}
+	if want := "28.3465 28.3465 283.4646 425.1969 re S\n"; !strings.Contains(contents[0], want) {
+		t.Errorf("the first page does not contain the frame %q of the text area", want)
+	}
+	if want := "BT /F1 12.0000 Tf\n1.4 TL\n28.3465 "; !strings.Contains(contents[0], want) {
+		t.Errorf("the text does not start at the left padding %q", want)
+	}
+	if n := strings.Count(strings.Join(contents, ""), "TJ\n"); n <= lines {
+		t.Errorf("the text has %d lines on the narrow pages and %d on the default pages", n, lines)
+	}
+}
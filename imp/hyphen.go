@@ -0,0 +1,162 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tux21b/imp/imp/text"
+)
+
+// hyphenation adds exceptions to the hyphenator of the current language.
+// It is the token of the macro \hyphenation{ta-ble ...}.
+type hyphenation []string
+
+// Hyphenate inserts the points where words can be hyphenated. Words are
+// broken at soft hyphens (U+00AD), which are only visible at the end of a
+// line, and after hyphens. Other words are hyphenated with the patterns of
+// the language selected in the state, see text.RegisterHyphenator. Words
+// of languages without patterns and words set while State.Hyphenate is
+// false are not hyphenated. Lines are never broken at no-break spaces or
+// at non-breaking hyphens (U+2011).
+func (m *Imp) Hyphenate(tokens []Token) []Token {
+	s := m.State.Clone()
+	ntokens := make([]Token, 0, len(tokens))
+	for _, tok := range tokens {
+		switch t := tok.(type) {
+		case hyphenation:
+			h := m.hyphenator(s.Language)
+			if h == nil {
+				h = text.NewHyphenator(nil)
+			} else {
+				h = h.Clone()
+			}
+			for _, word := range t {
+				h.AddException(word)
+			}
+			m.hyphenators[language(s.Language)] = h
+		case Text:
+			ntokens = append(ntokens, m.hyphenate(s, string(t))...)
+		default:
+			GetWidth(s, tok) // updates the state
+			ntokens = append(ntokens, tok)
+		}
+	}
+	return ntokens
+}
+
+// hyphenate splits a word at the points where it can be hyphenated.
+func (m *Imp) hyphenate(s *State, word string) []Token {
+	var tokens []Token
+	add := func(t string) {
+		if t != "" {
+			tokens = append(tokens, Text(t))
+		}
+	}
+	if strings.ContainsRune(word, '\u00ad') || explicitHyphen(word) >= 0 {
+		// like TeX, such words are not hyphenated with patterns
+		for {
+			i, j := strings.IndexRune(word, '\u00ad'), explicitHyphen(word)
+			switch {
+			case i >= 0 && (j < 0 || i < j):
+				add(word[:i])
+				tokens = append(tokens, CanBreak{Before: Text("-")})
+				word = word[i+len("\u00ad"):]
+			case j >= 0:
+				add(word[:j])
+				tokens = append(tokens, CanBreak{Before: Text("-"), NoBreak: Text("-")})
+				word = word[j+1:]
+			default:
+				add(word)
+				return tokens
+			}
+		}
+	}
+	h := m.hyphenator(s.Language)
+	if !s.Hyphenate || h == nil {
+		return []Token{Text(word)}
+	}
+	for i, piece := range hyphenatePieces(h, word) {
+		if i > 0 {
+			tokens = append(tokens, CanBreak{Before: Text("-")})
+		}
+		add(piece)
+	}
+	return tokens
+}
+
+// explicitHyphen returns the index of the first hyphen after which the word
+// can be broken or -1. Such a hyphen is preceded by a letter or digit and
+// followed by a letter.
+func explicitHyphen(word string) int {
+	for start := 0; ; {
+		i := strings.IndexByte(word[start:], '-')
+		if i < 0 {
+			return -1
+		}
+		i += start
+		before, _ := utf8.DecodeLastRuneInString(word[:i])
+		after, _ := utf8.DecodeRuneInString(word[i+1:])
+		if (unicode.IsLetter(before) || unicode.IsDigit(before)) && unicode.IsLetter(after) {
+			return i
+		}
+		start = i + 1
+	}
+}
+
+// hyphenatePieces hyphenates the parts of a word which are joined by
+// no-break spaces or non-breaking hyphens separately.
+func hyphenatePieces(h *text.Hyphenator, word string) []string {
+	var pieces []string
+	for word != "" {
+		part, sep := word, ""
+		if i := strings.IndexFunc(word, isNoBreak); i >= 0 {
+			_, n := utf8.DecodeRuneInString(word[i:])
+			part, sep, word = word[:i], word[i:i+n], word[i+n:]
+		} else {
+			word = ""
+		}
+		p := h.Hyphenate(part)
+		if len(pieces) > 0 {
+			pieces[len(pieces)-1] += p[0]
+			p = p[1:]
+		}
+		pieces = append(pieces, p...)
+		pieces[len(pieces)-1] += sep
+	}
+	return pieces
+}
+
+// isNoBreak reports whether r is a no-break space or a non-breaking hyphen.
+func isNoBreak(r rune) bool {
+	switch r {
+	case '\u00a0', '\u2007', '\u202f', '\u2011':
+		return true
+	}
+	return false
+}
+
+// hyphenator returns the hyphenator of a language including the exceptions
+// added by the document.
+func (m *Imp) hyphenator(lang string) *text.Hyphenator {
+	lang = language(lang)
+	if m.hyphenators == nil {
+		m.hyphenators = make(map[string]*text.Hyphenator)
+	}
+	if h, ok := m.hyphenators[lang]; ok {
+		return h
+	}
+	return text.HyphenatorFor(lang)
+}
+
+// language returns the language code of text, which is English unless
+// another language is selected.
+func language(lang string) string {
+	if lang == "" {
+		return "en"
+	}
+	return lang
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tux21b/imp/imp/text"
+)
+
+// breakPoints returns the text of the tokens with the break opportunities
+// written as (Before|NoBreak), except for breaks at spaces.
+func breakPoints(tokens []Token) string {
+	var b strings.Builder
+	for _, tok := range tokens {
+		switch t := tok.(type) {
+		case Text:
+			b.WriteString(string(t))
+		case Space:
+			b.WriteString(" ")
+		case CanBreak:
+			if _, ok := t.NoBreak.(Space); ok && t.Before == nil {
+				b.WriteString(" ")
+				break
+			}
+			b.WriteString("(")
+			if t.Before != nil {
+				b.WriteString(breakPoints([]Token{t.Before}))
+			}
+			b.WriteString("|")
+			if t.NoBreak != nil {
+				b.WriteString(breakPoints([]Token{t.NoBreak}))
+			}
+			b.WriteString(")")
+		}
+	}
+	return b.String()
+}
+
+// hyphenateText hyphenates the text of a test document and finds the
+// break opportunities within the words.
+func hyphenateText(t *testing.T, text string) (*Imp, []Token) {
+	d := newTestDocument(t)
+	d.AddText(text)
+	m := newTestImp(d, 300)
+	tokens, err := d.tokens(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, m.FindBreaks(m.Hyphenate(tokens))
+}
+
+// lines returns the text of the lines of a paragraph.
+func lines(tokens []Token) []string {
+	var list []string
+	start := 0
+	for i, tok := range tokens {
+		if _, ok := tok.(LineBreak); ok || i == len(tokens)-1 {
+			list = append(list, strings.TrimSpace(breakPoints(tokens[start:i+1])))
+			start = i + 1
+		}
+	}
+	return list
+}
+
+func TestHyphenateCharacters(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		// soft hyphens are the only points where such words are broken
+		{"Soft\u00adware", "Soft(-|)ware"},
+		{"Ty\u00adpo\u00adgra\u00adphie", "Ty(-|)po(-|)gra(-|)phie"},
+		// explicit hyphens stay visible if the line is not broken there
+		{"e-mail", "e(-|-)mail"},
+		{"server-side", "server(-|-)side"},
+		{"1-2", "1-2"},
+		{"-5", "-5"},
+		// no-break spaces and non-breaking hyphens are never broken
+		{"10\u00a0kg", "10\u00a0kg"},
+		{"e\u2011mail", "e\u2011mail"},
+		{"Max\u00a0Mustermann", "Max\u00a0Mustermann"},
+	}
+	for _, test := range tests {
+		_, tokens := hyphenateText(t, `\hyphenoff `+test.text)
+		if got := breakPoints(tokens); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestHyphenateLanguage(t *testing.T) {
+	h, err := text.ReadHyphenator(strings.NewReader("% German\n1ß 1ser\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.RightMin = 2
+	text.RegisterHyphenator("de", h)
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`Häuser hyphenation`, "Häuser hy(-|)phen(-|)ation"},
+		{`\german Häuser Größe hyphenation`, "Häu(-|)ser Grö(-|)ße hyphenation"},
+		{`{\german Größe} Größe`, "Grö(-|)ße Größe"},
+		// there are no Turkish patterns
+		{`\turkish hyphenation Häuser`, "hyphenation Häuser"},
+	}
+	for _, test := range tests {
+		_, tokens := hyphenateText(t, test.text)
+		if got := breakPoints(tokens); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestSoftHyphen(t *testing.T) {
+	text := "Donau\u00addampf\u00adschiff"
+	_, tokens := splitLines(t, text, 300)
+	if got := lines(tokens); len(got) != 1 || got[0] != "Donaudampfschiff" {
+		t.Errorf("got lines %q, want the word without hyphens", got)
+	}
+	_, tokens = splitLines(t, text, 50)
+	if got := lines(tokens); len(got) != 3 || got[0] != "Donau-" || got[1] != "dampf-" || got[2] != "schiff" {
+		t.Errorf("got lines %q, want hyphens at the soft hyphens", got)
+	}
+}
+
+func TestNoBreak(t *testing.T) {
+	text := strings.Repeat("e-mail 10\u00a0kg e\u2011mail ", 10)
+	_, tokens := splitLines(t, text, 40)
+	for _, line := range lines(tokens) {
+		for _, word := range strings.Split(line, " ") {
+			switch word {
+			case "e-", "mail", "e-mail", "10\u00a0kg", "e\u2011mail":
+			default:
+				t.Errorf("line %q: unexpected word %q", line, word)
+			}
+		}
+	}
+}
+
+func TestNonBreakingHyphenGlyph(t *testing.T) {
+	// the bundled font has no glyph for U+2011
+	d := newTestDocument(t)
+	m := newTestImp(d, 300)
+	if got, want := m.State.Shape("e\u2011mail"), m.State.Shape("e-mail"); len(got) != len(want) || got[1].Index != want[1].Index {
+		t.Errorf("got glyphs %v, want %v", got, want)
+	}
+	d.AddText("e\u2011mail")
+	var buf strings.Builder
+	if err := d.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Diagnostics) != 0 {
+		t.Errorf("got diagnostics %v", d.Diagnostics)
+	}
+}
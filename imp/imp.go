@@ -1 +1,291 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// Package imp is a typesetting system which renders marked up text as PDF
+// documents. See Document for a high-level API.
 package imp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/tux21b/imp/imp/bidi"
+	"github.com/tux21b/imp/imp/otf"
+	"github.com/tux21b/imp/imp/shape"
+	"github.com/tux21b/imp/imp/text"
+)
+
+// Imp typesets a list of tokens. It keeps track of the current state and
+// of the fonts and glyphs which are used.
+type Imp struct {
+	State *State
+
+	// Diagnostics lists the problems found in the document.
+	Diagnostics []Diagnostic
+
+	Fonts       []*otf.Font
+	glyphs      map[*otf.Font]map[otf.Index]bool
+	hyphenators map[string]*text.Hyphenator // with exceptions of the document
+}
+
+func (m *Imp) GetFontId(f *otf.Font) string {
+	for i := 0; i < len(m.Fonts); i++ {
+		if m.Fonts[i] == f {
+			return fmt.Sprintf("/F%d", i+1)
+		}
+	}
+	m.Fonts = append(m.Fonts, f)
+	return fmt.Sprintf("/F%d", len(m.Fonts))
+}
+
+func (m *Imp) UseGlyphs(f *otf.Font, glyphs ...otf.Index) {
+	if m.glyphs == nil {
+		m.glyphs = make(map[*otf.Font]map[otf.Index]bool)
+	}
+	used := m.glyphs[f]
+	if used == nil {
+		used = make(map[otf.Index]bool)
+		m.glyphs[f] = used
+	}
+	for _, g := range glyphs {
+		used[g] = true
+	}
+}
+
+func (m *Imp) UsedGlyphs(f *otf.Font) []otf.Index {
+	glyphs := make([]otf.Index, 0, len(m.glyphs[f]))
+	for g := range m.glyphs[f] {
+		glyphs = append(glyphs, g)
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+	return glyphs
+}
+
+type State struct {
+	Imp        *Imp
+	Font       *otf.Font
+	Fallbacks  []*otf.Font // fonts for characters missing in Font, in order
+	Size       float64
+	Features   []string
+	Script     string
+	Language   string
+	Level      bidi.Level
+	Color      SetTextColor
+	LineHeight float64
+	ParSkip    float64
+	MaxWidth   float64
+	TextWidth  float64 // width of the text area of the page
+	YPos       float64
+	ColStart   float64
+	Column     int
+	Columns    int
+	Justify    bool
+	Hyphenate  bool
+	Tolerance  float64 // maximum badness of a line
+	Looseness  int     // lines to add to the current paragraph
+
+	WidowPenalty  float64
+	OrphanPenalty float64
+	KeepWithNext  bool
+
+	colBottom float64  // lowest position of the previous columns
+	groups    []*State // states saved at the start of the enclosing groups
+}
+
+func (s *State) Shape(text string) []otf.Glyph {
+	return s.shape(s.Font, text)
+}
+
+func (s *State) shape(f *otf.Font, text string) []otf.Glyph {
+	text = substitute(f, text)
+	ctx := f.Context(s.Script, otf.LanguageTag(s.Language))
+	dir := bidi.LeftToRight
+	if s.Level%2 == 1 {
+		dir = bidi.RightToLeft
+	}
+	return shape.Shape(ctx, text, dir, s.Features...)
+}
+
+// A fontRun is a part of a text which is set in a single font.
+type fontRun struct {
+	font *otf.Font
+	text string
+}
+
+// fontRuns splits a text into runs which are set in the first of the font
+// and the fallbacks that has a glyph for the characters. Combining marks
+// stay with their base if possible and characters without a glyph in any
+// font stay in the current run.
+func (s *State) fontRuns(text string) []fontRun {
+	if len(s.Fallbacks) == 0 {
+		return []fontRun{{s.Font, text}}
+	}
+	var runs []fontRun
+	font, start := s.Font, 0
+	for i, r := range text {
+		f := s.fontFor(r)
+		if f == nil || f == font || i > start && unicode.In(r, unicode.Mn, unicode.Me) && font.Index(r) != 0 {
+			continue
+		}
+		if i > start {
+			runs = append(runs, fontRun{font, text[start:i]})
+		}
+		font, start = f, i
+	}
+	return append(runs, fontRun{font, text[start:]})
+}
+
+// fontFor returns the first of the font and the fallbacks which has a glyph
+// for r, or nil.
+func (s *State) fontFor(r rune) *otf.Font {
+	if hasGlyph(s.Font, r) {
+		return s.Font
+	}
+	for _, f := range s.Fallbacks {
+		if hasGlyph(f, r) {
+			return f
+		}
+	}
+	return nil
+}
+
+// substitutes lists the characters which are set with the glyph of a
+// similar character if a font has no glyph for them.
+var substitutes = map[rune][]rune{
+	'\u2011': {'\u2010', '-'}, // non-breaking hyphen
+}
+
+// hasGlyph reports whether f has a glyph for r or for one of its
+// substitutes.
+func hasGlyph(f *otf.Font, r rune) bool {
+	return f.Index(substitute1(f, r)) != 0
+}
+
+// substitute1 returns the first substitute of r which has a glyph in f, or
+// r itself.
+func substitute1(f *otf.Font, r rune) rune {
+	if f.Index(r) != 0 {
+		return r
+	}
+	for _, x := range substitutes[r] {
+		if f.Index(x) != 0 {
+			return x
+		}
+	}
+	return r
+}
+
+// substitute replaces the characters of text which have no glyph in f by
+// their substitutes.
+func substitute(f *otf.Font, text string) string {
+	return strings.Map(func(r rune) rune {
+		return substitute1(f, r)
+	}, text)
+}
+
+func (s *State) SetFeature(tag string, enabled bool) {
+	features := make([]string, 0, len(s.Features)+1)
+	for _, f := range s.Features {
+		if f != tag {
+			features = append(features, f)
+		}
+	}
+	if enabled {
+		features = append(features, tag)
+	}
+	s.Features = features
+}
+
+func (s *State) Clone() *State {
+	cp := *s
+	return &cp
+}
+
+// columnGap is the space between two columns relative to the width of the
+// text.
+const columnGap = 0.04
+
+// setColumns sets the text in n columns, which start at the current
+// position and divide the width of the text area.
+func (s *State) setColumns(n int) {
+	s.ColStart = s.YPos
+	s.Columns = n
+	s.MaxWidth = s.TextWidth * (1 - columnGap*float64(n-1)) / float64(n)
+}
+
+// beginGroup saves the current state until the end of the group.
+func (s *State) beginGroup() {
+	s.groups = append(s.groups[:len(s.groups):len(s.groups)], s.Clone())
+}
+
+// endGroup restores the state saved at the start of the innermost group.
+// The position on the page and the bidi level are kept. If the group
+// changed the columns, the text continues below the longest column of the
+// group.
+func (s *State) endGroup() {
+	if len(s.groups) == 0 {
+		return
+	}
+	outer := *s.groups[len(s.groups)-1]
+	outer.Level = s.Level
+	outer.YPos = s.YPos
+	outer.KeepWithNext = s.KeepWithNext
+	if outer.Columns == s.Columns {
+		outer.ColStart, outer.Column, outer.colBottom = s.ColStart, s.Column, s.colBottom
+	} else {
+		if s.Column > 0 && s.colBottom < outer.YPos {
+			outer.YPos = s.colBottom
+		}
+		outer.ColStart, outer.Column = outer.YPos, 0
+	}
+	*s = outer
+}
+
+// nextColumn moves to the top of the next column.
+func (s *State) nextColumn() {
+	if s.Column == 0 || s.YPos < s.colBottom {
+		s.colBottom = s.YPos
+	}
+	s.Column++
+	s.YPos = s.ColStart
+}
+
+func GetWidth(s *State, t Token) float64 {
+	switch t := t.(type) {
+	case Text:
+		width := 0.0
+		for _, run := range s.fontRuns(string(t)) {
+			for _, g := range s.shape(run.font, run.text) {
+				width += float64(run.font.Scale(g.XAdvance, 1000)) / 1000 * s.Size
+			}
+		}
+		return width
+	case CanBreak:
+		return GetWidth(s, t.NoBreak)
+	case Space:
+		return float64(s.Font.Scale(s.Font.HMetric(s.Font.Index(' ')).Width, 1000)) / 1000 * s.Size
+	case Inline:
+		return t.Width(s)
+	case SetFont:
+		if t.Font != nil {
+			s.Font = t.Font
+		}
+		if t.Size != 0 {
+			s.Size = float64(t.Size)
+		}
+	case SetTextColor:
+		s.Color = t
+	case StateAction:
+		t(s)
+	case ParagraphBreak:
+		// like in TeX, the looseness only applies to a single paragraph
+		s.Looseness = 0
+	case BeginGroup:
+		s.beginGroup()
+	case EndGroup:
+		s.endGroup()
+	}
+	return 0
+}
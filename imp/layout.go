@@ -1,10 +1,11 @@
 // Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
 // All rights reserved. Distributed under the Simplified BSD License.
 
-package main
+package imp
 
 import (
 	"errors"
+	"image"
 	"strconv"
 	"strings"
 	"unicode"
@@ -184,3 +185,13 @@ func (v *VBox) Children() []Object {
 }
 
 */
+
+type Bounds struct {
+	X, Y float64
+	W, H float64
+}
+
+type ImageBox struct {
+	B   Bounds
+	Img image.Image
+}
@@ -0,0 +1,299 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"math"
+	"sort"
+)
+
+// Parameters of the line breaking algorithm.
+const (
+	linePenalty          = 10
+	hyphenPenalty        = 50
+	doubleHyphenDemerits = 10000
+	adjDemerits          = 10000
+	infBad               = 10000
+)
+
+// SplitLines breaks every paragraph into lines using the algorithm of Knuth
+// and Plass. Text is treated as boxes, spaces as glue which is able to
+// stretch and shrink and hyphens as penalties. The breaks which minimize
+// the total demerits of a paragraph are replaced by line breaks.
+func (m *Imp) SplitLines(tokens []Token, width float64) []Token {
+	b := &lineBreaker{
+		tokens:  tokens,
+		states:  make([]*State, len(tokens)+1),
+		pos:     make([]Pos, len(tokens)+1),
+		widths:  make([]float64, len(tokens)+1),
+		stretch: make([]float64, len(tokens)+1),
+		shrink:  make([]float64, len(tokens)+1),
+	}
+	s := m.State.Clone()
+	b.states[0] = s.Clone()
+	for i := range tokens {
+		b.pos[i+1] = b.pos[i]
+		if p, ok := tokens[i].(Pos); ok {
+			b.pos[i+1] = p
+		}
+		w := GetWidth(s, tokens[i])
+		b.widths[i+1] = b.widths[i] + w
+		b.stretch[i+1], b.shrink[i+1] = b.stretch[i], b.shrink[i]
+		if cb, ok := tokens[i].(CanBreak); ok {
+			if _, ok := cb.NoBreak.(Space); ok {
+				b.stretch[i+1] += w / 2
+				b.shrink[i+1] += w / 3
+			}
+		}
+		b.states[i+1] = s.Clone()
+	}
+
+	change := make([]bool, len(tokens))
+	start := 0
+	for start < len(tokens) {
+		end := len(tokens)
+		for i := start; i < len(tokens); i++ {
+			if isParagraphEnd(tokens[i]) {
+				end = i
+				break
+			}
+		}
+		tolerance := b.states[end].Tolerance
+		node := b.breakParagraph(start, end, tolerance, false)
+		if node == nil {
+			node = b.breakParagraph(start, end, math.Inf(1), false)
+		}
+		if node == nil {
+			node = b.breakParagraph(start, end, math.Inf(1), true)
+		}
+		for n := node; n != nil; n = n.prev {
+			if n.pos > start && n.pos < end {
+				change[n.pos-1] = true
+			}
+			if n.overfull > 0 {
+				m.errorf(b.pos[n.pos], "overfull line (%.1fpt too wide)", n.overfull)
+			}
+		}
+		start = end + 1
+	}
+
+	ntokens := make([]Token, 0, len(tokens))
+	for i := range tokens {
+		if cb, ok := tokens[i].(CanBreak); ok {
+			if change[i] {
+				if cb.Before != nil {
+					ntokens = append(ntokens, cb.Before)
+				}
+				ntokens = append(ntokens, LineBreak{})
+			} else if cb.NoBreak != nil {
+				ntokens = append(ntokens, cb.NoBreak)
+			}
+		} else {
+			ntokens = append(ntokens, tokens[i])
+		}
+	}
+	return ntokens
+}
+
+// isParagraphEnd reports whether the lines before t are broken
+// independently of the lines after it.
+func isParagraphEnd(t Token) bool {
+	switch t := t.(type) {
+	case ParagraphBreak:
+		return true
+	case LineBreak:
+		return t.Forced
+	}
+	return false
+}
+
+type lineBreaker struct {
+	tokens []Token
+	states []*State // state after every token
+	pos    []Pos    // source position after every token
+
+	// sums of the natural width, stretchability and shrinkability of
+	// the tokens before every position
+	widths, stretch, shrink []float64
+}
+
+// A breakNode is a feasible break of a paragraph. The line which follows
+// the break starts with the token at pos.
+type breakNode struct {
+	pos        int
+	line       int
+	fitness    int
+	demerits   float64
+	hyphenated bool
+	overfull   float64 // width of the line beyond the maximum
+	prev       *breakNode
+}
+
+// breakParagraph finds the best breaks of the paragraph tokens[start:end]
+// for the given tolerance and returns the node of the final break. If no
+// feasible breaks exist, nil is returned unless emergency is set, in which
+// case overfull lines are accepted.
+func (b *lineBreaker) breakParagraph(start, end int, tolerance float64, emergency bool) *breakNode {
+	looseness := b.states[end].Looseness
+	active := []*breakNode{{pos: start, fitness: 1}}
+	for j := start + 1; j <= end; j++ {
+		var cb CanBreak
+		if j != end {
+			var ok bool
+			if cb, ok = b.tokens[j-1].(CanBreak); !ok {
+				continue
+			}
+		}
+
+		s := b.states[j]
+		penalty, hyphenated := 0.0, false
+		if t, ok := cb.Before.(Text); ok && t == "-" {
+			penalty, hyphenated = hyphenPenalty, true
+		}
+		extra := 0.0
+		if j != end {
+			extra = GetWidth(b.states[j-1].Clone(), cb.Before) - (b.widths[j] - b.widths[j-1])
+		}
+		best := make(map[int]*breakNode)
+		kept := active[:0]
+		for _, a := range active {
+			w := b.widths[j] - b.widths[a.pos] + extra
+			y := b.stretch[j-1] - b.stretch[a.pos]
+			z := b.shrink[j-1] - b.shrink[a.pos]
+			if !s.Justify {
+				y, z = 2*s.Size, 0
+			}
+			if j == end {
+				y = math.Inf(1)
+			}
+
+			r := adjustmentRatio(w, s.MaxWidth, y, z)
+			if r >= -1 && j != end {
+				kept = append(kept, a)
+			}
+			bad, overfull := badness(r), 0.0
+			if r < -1 {
+				if !emergency {
+					continue
+				}
+				bad = infBad + w - s.MaxWidth
+				overfull = w - z - s.MaxWidth
+			} else if bad > tolerance {
+				continue
+			}
+
+			d := (linePenalty + bad) * (linePenalty + bad)
+			d += penalty * penalty
+			if hyphenated && a.hyphenated {
+				d += doubleHyphenDemerits
+			}
+			fitness := fitnessClass(r)
+			if fitness-a.fitness > 1 || a.fitness-fitness > 1 {
+				d += adjDemerits
+			}
+
+			key := fitness
+			if looseness != 0 {
+				key += 4 * (a.line + 1)
+			}
+			if n := best[key]; n == nil || a.demerits+d < n.demerits {
+				best[key] = &breakNode{
+					pos:        j,
+					line:       a.line + 1,
+					fitness:    fitness,
+					demerits:   a.demerits + d,
+					hyphenated: hyphenated,
+					overfull:   overfull,
+					prev:       a,
+				}
+			}
+		}
+
+		keys := make([]int, 0, len(best))
+		for key := range best {
+			keys = append(keys, key)
+		}
+		sort.Ints(keys)
+		nodes := make([]*breakNode, len(keys))
+		for i, key := range keys {
+			nodes[i] = best[key]
+		}
+		if j == end {
+			return chooseBreak(nodes, looseness)
+		}
+		active = append(kept, nodes...)
+		if len(active) == 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// chooseBreak selects the final break with the fewest demerits. A non-zero
+// looseness prefers paragraphs with more or less lines instead.
+func chooseBreak(nodes []*breakNode, looseness int) *breakNode {
+	var best *breakNode
+	for _, n := range nodes {
+		if best == nil || n.demerits < best.demerits {
+			best = n
+		}
+	}
+	if best == nil || looseness == 0 {
+		return best
+	}
+	target := best.line + looseness
+	for _, n := range nodes {
+		dn, db := abs(n.line-target), abs(best.line-target)
+		if dn < db || dn == db && n.demerits < best.demerits {
+			best = n
+		}
+	}
+	return best
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// adjustmentRatio returns how much the glue of a line with the natural
+// width w needs to stretch (positive) or shrink (negative) to fill the
+// given width.
+func adjustmentRatio(w, width, stretch, shrink float64) float64 {
+	switch {
+	case w < width && stretch > 0:
+		return (width - w) / stretch
+	case w < width:
+		return math.Inf(1)
+	case w > width && shrink > 0:
+		return (width - w) / shrink
+	case w > width:
+		return math.Inf(-1)
+	}
+	return 0
+}
+
+func badness(r float64) float64 {
+	b := 100 * math.Abs(r*r*r)
+	if b > infBad {
+		return infBad
+	}
+	return b
+}
+
+// fitnessClass classifies lines into tight, decent, loose and very loose
+// lines.
+func fitnessClass(r float64) int {
+	switch {
+	case r < -0.5:
+		return 0
+	case r <= 0.5:
+		return 1
+	case r <= 1:
+		return 2
+	}
+	return 3
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// Package linebreak implements the Unicode Line Breaking Algorithm (UAX #14)
+// which finds the positions where a text can be broken into lines.
+package linebreak
+
+import "unicode"
+
+// A Class is the line breaking class of a rune.
+type Class uint8
+
+const (
+	AL  Class = iota // alphabetic
+	BK               // mandatory break
+	CR               // carriage return
+	LF               // line feed
+	NL               // next line
+	CM               // combining mark
+	ZWJ              // zero width joiner
+	SP               // space
+	ZW               // zero width space
+	WJ               // word joiner
+	GL               // non-breaking glue
+	BA               // break after
+	BB               // break before
+	B2               // break opportunity before and after
+	HY               // hyphen
+	CB               // contingent break opportunity
+	CL               // close punctuation
+	CP               // close parenthesis
+	EX               // exclamation and interrogation
+	IN               // inseparable
+	NS               // nonstarter
+	OP               // open punctuation
+	QU               // quotation
+	IS               // infix numeric separator
+	NU               // numeric
+	PO               // postfix numeric
+	PR               // prefix numeric
+	SY               // symbols allowing a break after
+	HL               // Hebrew letter
+	ID               // ideographic
+	CJ               // conditional Japanese starter
+	SA               // complex context dependent (South East Asian)
+	JL               // Hangul L jamo
+	JV               // Hangul V jamo
+	JT               // Hangul T jamo
+	H2               // Hangul LV syllable
+	H3               // Hangul LVT syllable
+	RI               // regional indicator
+	EB               // emoji base
+	EM               // emoji modifier
+)
+
+// An Opportunity tells whether a line can be broken between two runes.
+type Opportunity uint8
+
+const (
+	NoBreak   Opportunity = iota // the line must not be broken
+	Allowed                      // the line can be broken
+	Mandatory                    // the line must be broken
+)
+
+// Breaks returns the break opportunity before every rune of a text. The
+// opportunity before the first rune is NoBreak.
+//
+// Conditional Japanese starters, like small kana, are treated as
+// nonstarters, which is the strict style of Japanese line breaking. Thai
+// text is broken at syllable boundaries, see thaiBreaks. The other scripts
+// which need a dictionary to find the words, like Lao or Khmer, are treated
+// as alphabetic, so a run of such text is never broken.
+func Breaks(text []rune) []Opportunity {
+	breaks := make([]Opportunity, len(text))
+	if len(text) == 0 {
+		return breaks
+	}
+	b := &breaker{}
+	b.first(text[0])
+	for i := 1; i < len(text); i++ {
+		var ahead rune
+		if i+1 < len(text) {
+			ahead = text[i+1]
+		}
+		breaks[i] = b.next(text[i], ahead)
+	}
+	for start := 0; start < len(text); start++ {
+		if !isThai(text[start]) {
+			continue
+		}
+		end := start + 1
+		for end < len(text) && isThai(text[end]) {
+			end++
+		}
+		thaiBreaks(text, breaks, start, end)
+		start = end
+	}
+	return breaks
+}
+
+// resolve returns the class of a rune after the rules of LB1.
+func resolve(r rune) Class {
+	switch c := LookupClass(r); c {
+	case SA:
+		if unicode.In(r, unicode.Mn, unicode.Mc) {
+			return CM
+		}
+		return AL
+	case CJ:
+		return NS
+	default:
+		return c
+	}
+}
+
+// A breaker holds the context of the rules which look at more than the
+// two runes around a break.
+type breaker struct {
+	prev       Class // class of the previous rune, combining marks excluded
+	prevRune   rune
+	beforeSP   Class // class before the spaces which precede the current rune
+	beforePrev Class // class before the previous rune
+	zwj        bool  // the previous rune is a zero width joiner
+	ri         int   // number of regional indicators before the current rune
+	num        bool  // the previous rune is part of a number
+	numClose   bool  // the previous rune closes a number in brackets
+}
+
+func (b *breaker) first(r rune) {
+	c := resolve(r)
+	b.zwj = c == ZWJ
+	if c == CM || c == ZWJ {
+		c = AL // LB10
+	}
+	b.set(c, r)
+}
+
+// set makes c the class of the previous rune.
+func (b *breaker) set(c Class, r rune) {
+	if c != SP || b.prev != SP {
+		if c == SP {
+			b.beforeSP = b.prev
+		} else {
+			b.beforeSP = c
+		}
+	}
+	if c == RI {
+		b.ri++
+	} else {
+		b.ri = 0
+	}
+	b.numClose = b.num && (c == CL || c == CP)
+	b.num = c == NU || b.num && (c == SY || c == IS)
+	b.beforePrev, b.prev, b.prevRune = b.prev, c, r
+}
+
+// next returns the break opportunity before r. The rune ahead follows r
+// and is 0 at the end of the text.
+func (b *breaker) next(r, ahead rune) Opportunity {
+	c := resolve(r)
+	zwj := b.zwj
+	b.zwj = c == ZWJ
+	if c == CM || c == ZWJ {
+		switch b.prev {
+		case BK, CR, LF, NL, SP, ZW:
+			c = AL // LB10
+		default:
+			return NoBreak // LB9: the mark takes the class of its base
+		}
+	}
+	o := b.rule(b.prev, c, r, ahead, zwj)
+	b.set(c, r)
+	return o
+}
+
+// rule applies the rules LB4 to LB31 to a pair of classes.
+func (b *breaker) rule(before, after Class, r, ahead rune, zwj bool) Opportunity {
+	sp := b.beforeSP
+	switch {
+	case before == BK:
+		return Mandatory
+	case before == CR && after == LF:
+		return NoBreak
+	case before == CR || before == LF || before == NL:
+		return Mandatory
+	case after == BK || after == CR || after == LF || after == NL:
+		return NoBreak
+	case after == SP || after == ZW:
+		return NoBreak
+	case sp == ZW:
+		return Allowed
+	case zwj:
+		return NoBreak
+	case before == WJ || after == WJ:
+		return NoBreak
+	case before == GL:
+		return NoBreak
+	case after == GL && before != SP && before != BA && before != HY:
+		return NoBreak
+	case after == CL || after == CP || after == EX || after == IS || after == SY:
+		return NoBreak
+	case sp == OP:
+		return NoBreak
+	case sp == QU && after == OP:
+		return NoBreak
+	case (sp == CL || sp == CP) && after == NS:
+		return NoBreak
+	case sp == B2 && after == B2:
+		return NoBreak
+	case before == SP:
+		return Allowed
+	case before == QU || after == QU:
+		return NoBreak
+	case before == CB || after == CB:
+		return Allowed
+	case after == BA || after == HY || after == NS || before == BB:
+		return NoBreak
+	case b.beforePrev == HL && (before == HY || before == BA):
+		return NoBreak
+	case before == SY && after == HL:
+		return NoBreak
+	case after == IN:
+		return NoBreak
+	case isAlpha(before) && after == NU, before == NU && isAlpha(after):
+		return NoBreak
+	case before == PR && (after == ID || after == EB || after == EM),
+		(before == ID || before == EB || before == EM) && after == PO:
+		return NoBreak
+	case (before == PR || before == PO) && isAlpha(after),
+		isAlpha(before) && (after == PR || after == PO):
+		return NoBreak
+	case b.numeric(before, after, ahead):
+		return NoBreak
+	case korean(before, after):
+		return NoBreak
+	case isAlpha(before) && isAlpha(after):
+		return NoBreak
+	case before == IS && isAlpha(after):
+		return NoBreak
+	case (isAlpha(before) || before == NU) && after == OP && !isWide(r),
+		before == CP && !isWide(b.prevRune) && (isAlpha(after) || after == NU):
+		return NoBreak
+	case before == RI && after == RI && b.ri%2 == 1:
+		return NoBreak
+	case after == EM && (before == EB || before == ID && unassigned(b.prevRune)):
+		// unassigned code points of the emoji blocks may become emoji bases
+		return NoBreak
+	}
+	return Allowed
+}
+
+func isAlpha(c Class) bool {
+	return c == AL || c == HL
+}
+
+// numeric implements the rule LB25, which keeps numbers like "$(12.35)"
+// together. It is tailored like Example 7 of UAX #14, so a break is only
+// prevented within a number.
+func (b *breaker) numeric(before, after Class, ahead rune) bool {
+	switch {
+	case before == PR || before == PO:
+		return after == NU || (after == OP || after == HY) && resolve(ahead) == NU
+	case before == OP || before == HY:
+		return after == NU
+	case b.num:
+		switch after {
+		case NU, SY, IS, CL, CP, PR, PO:
+			return true
+		}
+	case b.numClose:
+		return after == PR || after == PO
+	}
+	return false
+}
+
+// korean implements the rules LB26 and LB27 for Hangul syllables.
+func korean(before, after Class) bool {
+	switch {
+	case before == JL:
+		return after == JL || after == JV || after == H2 || after == H3 || after == PO
+	case before == JV || before == H2:
+		return after == JV || after == JT || after == PO
+	case before == JT || before == H3:
+		return after == JT || after == PO
+	case before == PR:
+		return after == JL || after == JV || after == JT || after == H2 || after == H3
+	}
+	return false
+}
+
+// isWide reports whether r is a wide East Asian character, like the
+// fullwidth parentheses of Chinese text.
+func isWide(r rune) bool {
+	return r >= 0x1100 && r <= 0x115F || r >= 0x2329 && r <= 0x232A ||
+		r >= 0x2E80 && r <= 0xA4CF || r >= 0xAC00 && r <= 0xD7A3 ||
+		r >= 0xF900 && r <= 0xFAFF ||
+		r >= 0xFE10 && r <= 0xFE6F || r >= 0xFF00 && r <= 0xFF60 ||
+		r >= 0xFFE0 && r <= 0xFFE6 || r >= 0x20000 && r <= 0x3FFFD
+}
+
+// unassigned reports whether r is not yet assigned to a character.
+func unassigned(r rune) bool {
+	return !unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.P,
+		unicode.S, unicode.Z, unicode.Cc, unicode.Cf, unicode.Co, unicode.Cs)
+}
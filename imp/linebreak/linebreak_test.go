@@ -0,0 +1,86 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package linebreak
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestLineBreakTest checks the samples of the Unicode Character Database,
+// where ÷ marks a break opportunity and × marks a position without one.
+func TestLineBreakTest(t *testing.T) {
+	f, err := os.Open("testdata/LineBreakTest.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var text []rune
+		var want []bool
+		for i := 1; i < len(fields); i += 2 {
+			r, err := strconv.ParseUint(fields[i], 16, 32)
+			if err != nil {
+				t.Fatalf("line %d: %v", n, err)
+			}
+			text = append(text, rune(r))
+			want = append(want, i > 1 && fields[i-1] == "÷")
+		}
+		for i, o := range Breaks(text) {
+			if got := o != NoBreak; got != want[i] {
+				t.Errorf("line %d: %s: break before rune %d is %v, want %v",
+					n, strings.TrimSpace(line), i, got, want[i])
+				break
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBreaks(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"ภาษาไทยง่าย", "ภา|ษา|ไทย|ง่าย"},
+		{"ภาษาไทย ง่าย", "ภา|ษา|ไทย |ง่าย"},
+		{"ไปไหนมา", "ไป|ไหน|มา"},
+		{"สวัสดีครับ", "สวัส|ดี|ครับ"},
+		{"ดูหนังกับเพื่อน", "ดู|หนัง|กับ|เพื่อน"},
+		{"เปลี่ยนแปลง", "เปลี่ยน|แปลง"},
+		{"คนไทย", "คน|ไทย"},
+		{"ສະບາຍດີ", "ສະບາຍດີ"}, // Lao is not broken
+		{"日本語です。", "日|本|語|で|す。"},
+		{"$(12.35) each", "$(12.35) |each"},
+		{"and/or", "and/|or"},
+		{"a\nb", "a\n|b"},
+	}
+	for _, test := range tests {
+		text := []rune(test.text)
+		var got []rune
+		for i, o := range Breaks(text) {
+			if o != NoBreak {
+				got = append(got, '|')
+			}
+			got = append(got, text[i])
+		}
+		if string(got) != test.want {
+			t.Errorf("Breaks(%q) = %q, want %q", test.text, string(got), test.want)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package linebreak
+
+import (
+	"sort"
+	"unicode"
+)
+
+// LookupClass returns the line breaking class of a rune.
+func LookupClass(r rune) Class {
+	if r >= 0xAC00 && r <= 0xD7A3 {
+		// Hangul syllables without a trailing consonant are LV syllables
+		if (r-0xAC00)%28 == 0 {
+			return H2
+		}
+		return H3
+	}
+	if c, ok := searchClass(classes, r); ok {
+		return c
+	}
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Mc, unicode.Me, unicode.Cf):
+		return CM
+	case unicode.Is(unicode.Nd, r):
+		return NU
+	case unicode.Is(unicode.Zs, r):
+		return BA
+	case unicode.Is(unicode.Ps, r):
+		return OP
+	case unicode.Is(unicode.Pe, r):
+		return CL
+	case unicode.In(r, unicode.Pi, unicode.Pf):
+		return QU
+	case unicode.Is(unicode.Pd, r):
+		return BA
+	case unicode.Is(unicode.Sc, r):
+		return PR
+	}
+	return AL
+}
+
+type classRange struct {
+	lo, hi rune
+	class  Class
+}
+
+func searchClass(table []classRange, r rune) (Class, bool) {
+	k := sort.Search(len(table), func(i int) bool { return table[i].hi >= r })
+	if k < len(table) && table[k].lo <= r {
+		return table[k].class, true
+	}
+	return AL, false
+}
+
+// classes lists characters whose class differs from the default derived
+// from their general category.
+var classes = []classRange{
+	{0x0000, 0x0008, CM},
+	{0x0009, 0x0009, BA},
+	{0x000A, 0x000A, LF},
+	{0x000B, 0x000C, BK},
+	{0x000D, 0x000D, CR},
+	{0x000E, 0x001F, CM},
+	{0x0020, 0x0020, SP},
+	{0x0021, 0x0021, EX},
+	{0x0022, 0x0022, QU},
+	{0x0024, 0x0024, PR},
+	{0x0025, 0x0025, PO},
+	{0x0027, 0x0027, QU},
+	{0x0028, 0x0028, OP},
+	{0x0029, 0x0029, CP},
+	{0x002B, 0x002B, PR},
+	{0x002C, 0x002C, IS},
+	{0x002D, 0x002D, HY},
+	{0x002E, 0x002E, IS},
+	{0x002F, 0x002F, SY},
+	{0x0030, 0x0039, NU},
+	{0x003A, 0x003B, IS},
+	{0x003F, 0x003F, EX},
+	{0x005B, 0x005B, OP},
+	{0x005C, 0x005C, PR},
+	{0x005D, 0x005D, CP},
+	{0x007B, 0x007B, OP},
+	{0x007C, 0x007C, BA},
+	{0x007D, 0x007D, CL},
+	{0x007F, 0x0084, CM},
+	{0x0085, 0x0085, NL},
+	{0x0086, 0x009F, CM},
+	{0x00A0, 0x00A0, GL},
+	{0x00A1, 0x00A1, OP},
+	{0x00A2, 0x00A2, PO},
+	{0x00A3, 0x00A5, PR},
+	{0x00AB, 0x00AB, QU},
+	{0x00AD, 0x00AD, BA},
+	{0x00B0, 0x00B0, PO},
+	{0x00B1, 0x00B1, PR},
+	{0x00B4, 0x00B4, BB},
+	{0x00BB, 0x00BB, QU},
+	{0x00BF, 0x00BF, OP},
+	{0x05D0, 0x05EA, HL},
+	{0x05EF, 0x05F2, HL},
+	{0x0609, 0x060B, PO},
+	{0x066A, 0x066A, PO},
+	{0x0964, 0x0965, BA},
+	{0x0E01, 0x0E3A, SA},
+	{0x0E40, 0x0E4E, SA},
+	{0x0E5A, 0x0E5B, BA},
+	{0x0E80, 0x0EDF, SA},
+	{0x0F0B, 0x0F0B, BA},
+	{0x0F0C, 0x0F0C, GL},
+	{0x1000, 0x109F, SA},
+	{0x1100, 0x115F, JL},
+	{0x1160, 0x11A7, JV},
+	{0x11A8, 0x11FF, JT},
+	{0x1780, 0x17D3, SA},
+	{0x17D4, 0x17D5, BA},
+	{0x17D6, 0x17D6, NS},
+	{0x17D7, 0x17D7, SA},
+	{0x17D8, 0x17D8, BA},
+	{0x17DA, 0x17DA, BA},
+	{0x17DB, 0x17DB, PR},
+	{0x17DC, 0x17DD, SA},
+	{0x1806, 0x1806, BB},
+	{0x1950, 0x19DF, SA},
+	{0x1A20, 0x1AAF, SA},
+	{0x2007, 0x2007, GL},
+	{0x200B, 0x200B, ZW},
+	{0x200D, 0x200D, ZWJ},
+	{0x2011, 0x2011, GL},
+	{0x2014, 0x2014, B2},
+	{0x2024, 0x2026, IN},
+	{0x2027, 0x2027, BA},
+	{0x2028, 0x2029, BK},
+	{0x202F, 0x202F, GL},
+	{0x2030, 0x2037, PO},
+	{0x2039, 0x203A, QU},
+	{0x203C, 0x203D, NS},
+	{0x2044, 0x2044, IS},
+	{0x2047, 0x2049, NS},
+	{0x2056, 0x2056, BA},
+	{0x2058, 0x205B, BA},
+	{0x205D, 0x205E, BA},
+	{0x2060, 0x2060, WJ},
+	{0x20A7, 0x20A7, PO},
+	{0x20B6, 0x20B6, PO},
+	{0x20BB, 0x20BB, PO},
+	{0x20BE, 0x20BE, PO},
+	{0x2103, 0x2103, PO},
+	{0x2109, 0x2109, PO},
+	{0x2116, 0x2116, PR},
+	{0x231A, 0x231B, ID},
+	{0x2329, 0x2329, OP},
+	{0x232A, 0x232A, CL},
+	{0x261D, 0x261D, EB},
+	{0x26F9, 0x26F9, EB},
+	{0x270A, 0x270D, EB},
+	{0x2E3A, 0x2E3B, B2},
+	{0x2E80, 0x2FFF, ID},
+	{0x3000, 0x3000, BA},
+	{0x3001, 0x3002, CL},
+	{0x3003, 0x3004, ID},
+	{0x3005, 0x3005, NS},
+	{0x3006, 0x3007, ID},
+	{0x3008, 0x3008, OP},
+	{0x3009, 0x3009, CL},
+	{0x300A, 0x300A, OP},
+	{0x300B, 0x300B, CL},
+	{0x300C, 0x300C, OP},
+	{0x300D, 0x300D, CL},
+	{0x300E, 0x300E, OP},
+	{0x300F, 0x300F, CL},
+	{0x3010, 0x3010, OP},
+	{0x3011, 0x3011, CL},
+	{0x3012, 0x3013, ID},
+	{0x3014, 0x3014, OP},
+	{0x3015, 0x3015, CL},
+	{0x3016, 0x3016, OP},
+	{0x3017, 0x3017, CL},
+	{0x3018, 0x3018, OP},
+	{0x3019, 0x3019, CL},
+	{0x301A, 0x301A, OP},
+	{0x301B, 0x301B, CL},
+	{0x301C, 0x301C, NS},
+	{0x301D, 0x301D, OP},
+	{0x301E, 0x301F, CL},
+	{0x3020, 0x3029, ID},
+	{0x302A, 0x302F, CM},
+	{0x3030, 0x303A, ID},
+	{0x303B, 0x303C, NS},
+	{0x303D, 0x303F, ID},
+	{0x3041, 0x3041, CJ},
+	{0x3042, 0x3042, ID},
+	{0x3043, 0x3043, CJ},
+	{0x3044, 0x3044, ID},
+	{0x3045, 0x3045, CJ},
+	{0x3046, 0x3046, ID},
+	{0x3047, 0x3047, CJ},
+	{0x3048, 0x3048, ID},
+	{0x3049, 0x3049, CJ},
+	{0x304A, 0x3062, ID},
+	{0x3063, 0x3063, CJ},
+	{0x3064, 0x3082, ID},
+	{0x3083, 0x3083, CJ},
+	{0x3084, 0x3084, ID},
+	{0x3085, 0x3085, CJ},
+	{0x3086, 0x3086, ID},
+	{0x3087, 0x3087, CJ},
+	{0x3088, 0x308D, ID},
+	{0x308E, 0x308E, CJ},
+	{0x308F, 0x3094, ID},
+	{0x3095, 0x3096, CJ},
+	{0x3099, 0x309A, CM},
+	{0x309B, 0x309E, NS},
+	{0x309F, 0x309F, ID},
+	{0x30A0, 0x30A0, NS},
+	{0x30A1, 0x30A1, CJ},
+	{0x30A2, 0x30A2, ID},
+	{0x30A3, 0x30A3, CJ},
+	{0x30A4, 0x30A4, ID},
+	{0x30A5, 0x30A5, CJ},
+	{0x30A6, 0x30A6, ID},
+	{0x30A7, 0x30A7, CJ},
+	{0x30A8, 0x30A8, ID},
+	{0x30A9, 0x30A9, CJ},
+	{0x30AA, 0x30C2, ID},
+	{0x30C3, 0x30C3, CJ},
+	{0x30C4, 0x30E2, ID},
+	{0x30E3, 0x30E3, CJ},
+	{0x30E4, 0x30E4, ID},
+	{0x30E5, 0x30E5, CJ},
+	{0x30E6, 0x30E6, ID},
+	{0x30E7, 0x30E7, CJ},
+	{0x30E8, 0x30ED, ID},
+	{0x30EE, 0x30EE, CJ},
+	{0x30EF, 0x30F4, ID},
+	{0x30F5, 0x30F6, CJ},
+	{0x30F7, 0x30FA, ID},
+	{0x30FB, 0x30FB, NS},
+	{0x30FC, 0x30FC, CJ},
+	{0x30FD, 0x30FE, NS},
+	{0x30FF, 0x31EF, ID},
+	{0x31F0, 0x31FF, CJ},
+	{0x3200, 0x4DBF, ID},
+	{0x4E00, 0x9FFF, ID},
+	{0xA000, 0xA014, ID},
+	{0xA015, 0xA015, NS},
+	{0xA016, 0xA4CF, ID},
+	{0xA960, 0xA97F, JL},
+	{0xA9E0, 0xA9FF, SA},
+	{0xAA60, 0xAADF, SA},
+	{0xD7B0, 0xD7C6, JV},
+	{0xD7CB, 0xD7FB, JT},
+	{0xF900, 0xFAFF, ID},
+	{0xFE10, 0xFE10, IS},
+	{0xFE11, 0xFE12, CL},
+	{0xFE13, 0xFE14, IS},
+	{0xFE15, 0xFE16, EX},
+	{0xFE17, 0xFE17, OP},
+	{0xFE18, 0xFE18, CL},
+	{0xFE19, 0xFE19, IN},
+	{0xFE30, 0xFE34, ID},
+	{0xFE35, 0xFE35, OP},
+	{0xFE36, 0xFE36, CL},
+	{0xFE37, 0xFE37, OP},
+	{0xFE38, 0xFE38, CL},
+	{0xFE39, 0xFE39, OP},
+	{0xFE3A, 0xFE3A, CL},
+	{0xFE3B, 0xFE3B, OP},
+	{0xFE3C, 0xFE3C, CL},
+	{0xFE3D, 0xFE3D, OP},
+	{0xFE3E, 0xFE3E, CL},
+	{0xFE3F, 0xFE3F, OP},
+	{0xFE40, 0xFE40, CL},
+	{0xFE41, 0xFE41, OP},
+	{0xFE42, 0xFE42, CL},
+	{0xFE43, 0xFE43, OP},
+	{0xFE44, 0xFE44, CL},
+	{0xFE45, 0xFE46, ID},
+	{0xFE47, 0xFE47, OP},
+	{0xFE48, 0xFE48, CL},
+	{0xFE49, 0xFE4F, ID},
+	{0xFE50, 0xFE50, CL},
+	{0xFE51, 0xFE51, ID},
+	{0xFE52, 0xFE52, CL},
+	{0xFE54, 0xFE55, NS},
+	{0xFE56, 0xFE57, EX},
+	{0xFE58, 0xFE58, ID},
+	{0xFE59, 0xFE59, OP},
+	{0xFE5A, 0xFE5A, CL},
+	{0xFE5B, 0xFE5B, OP},
+	{0xFE5C, 0xFE5C, CL},
+	{0xFE5D, 0xFE5D, OP},
+	{0xFE5E, 0xFE5E, CL},
+	{0xFE5F, 0xFE68, ID},
+	{0xFEFF, 0xFEFF, WJ},
+	{0xFF01, 0xFF01, EX},
+	{0xFF02, 0xFF03, ID},
+	{0xFF04, 0xFF04, PR},
+	{0xFF05, 0xFF05, PO},
+	{0xFF06, 0xFF07, ID},
+	{0xFF08, 0xFF08, OP},
+	{0xFF09, 0xFF09, CL},
+	{0xFF0A, 0xFF0B, ID},
+	{0xFF0C, 0xFF0C, CL},
+	{0xFF0D, 0xFF0D, ID},
+	{0xFF0E, 0xFF0E, CL},
+	{0xFF0F, 0xFF19, ID},
+	{0xFF1A, 0xFF1B, NS},
+	{0xFF1C, 0xFF1E, ID},
+	{0xFF1F, 0xFF1F, EX},
+	{0xFF20, 0xFF3A, ID},
+	{0xFF3B, 0xFF3B, OP},
+	{0xFF3C, 0xFF3C, ID},
+	{0xFF3D, 0xFF3D, CL},
+	{0xFF3E, 0xFF5A, ID},
+	{0xFF5B, 0xFF5B, OP},
+	{0xFF5C, 0xFF5C, ID},
+	{0xFF5D, 0xFF5D, CL},
+	{0xFF5E, 0xFF5E, ID},
+	{0xFF5F, 0xFF5F, OP},
+	{0xFF60, 0xFF61, CL},
+	{0xFF62, 0xFF62, OP},
+	{0xFF63, 0xFF64, CL},
+	{0xFF65, 0xFF65, NS},
+	{0xFF66, 0xFF66, ID},
+	{0xFF67, 0xFF70, CJ},
+	{0xFF71, 0xFF9D, ID},
+	{0xFF9E, 0xFF9F, NS},
+	{0xFFE0, 0xFFE0, PO},
+	{0xFFE1, 0xFFE1, PR},
+	{0xFFE2, 0xFFE4, ID},
+	{0xFFE5, 0xFFE6, PR},
+	{0xFFFC, 0xFFFC, CB},
+	{0x1F000, 0x1F1E5, ID},
+	{0x1F1E6, 0x1F1FF, RI},
+	{0x1F200, 0x1F384, ID},
+	{0x1F385, 0x1F385, EB},
+	{0x1F386, 0x1F3C1, ID},
+	{0x1F3C2, 0x1F3C4, EB},
+	{0x1F3C5, 0x1F3C6, ID},
+	{0x1F3C7, 0x1F3C7, EB},
+	{0x1F3C8, 0x1F3C9, ID},
+	{0x1F3CA, 0x1F3CC, EB},
+	{0x1F3CD, 0x1F3FA, ID},
+	{0x1F3FB, 0x1F3FF, EM},
+	{0x1F400, 0x1F441, ID},
+	{0x1F442, 0x1F443, EB},
+	{0x1F444, 0x1F445, ID},
+	{0x1F446, 0x1F450, EB},
+	{0x1F451, 0x1F465, ID},
+	{0x1F466, 0x1F469, EB},
+	{0x1F46A, 0x1F46A, ID},
+	{0x1F46B, 0x1F46E, EB},
+	{0x1F46F, 0x1F46F, ID},
+	{0x1F470, 0x1F478, EB},
+	{0x1F479, 0x1F47B, ID},
+	{0x1F47C, 0x1F47C, EB},
+	{0x1F47D, 0x1F480, ID},
+	{0x1F481, 0x1F483, EB},
+	{0x1F484, 0x1F484, ID},
+	{0x1F485, 0x1F487, EB},
+	{0x1F488, 0x1F48E, ID},
+	{0x1F48F, 0x1F48F, EB},
+	{0x1F490, 0x1F490, ID},
+	{0x1F491, 0x1F491, EB},
+	{0x1F492, 0x1F4A9, ID},
+	{0x1F4AA, 0x1F4AA, EB},
+	{0x1F4AB, 0x1F573, ID},
+	{0x1F574, 0x1F575, EB},
+	{0x1F576, 0x1F579, ID},
+	{0x1F57A, 0x1F57A, EB},
+	{0x1F57B, 0x1F58F, ID},
+	{0x1F590, 0x1F590, EB},
+	{0x1F591, 0x1F594, ID},
+	{0x1F595, 0x1F596, EB},
+	{0x1F597, 0x1F644, ID},
+	{0x1F645, 0x1F647, EB},
+	{0x1F648, 0x1F64A, ID},
+	{0x1F64B, 0x1F64F, EB},
+	{0x1F650, 0x1F6A2, ID},
+	{0x1F6A3, 0x1F6A3, EB},
+	{0x1F6A4, 0x1F6B3, ID},
+	{0x1F6B4, 0x1F6B6, EB},
+	{0x1F6B7, 0x1F6BF, ID},
+	{0x1F6C0, 0x1F6C0, EB},
+	{0x1F6C1, 0x1F6CB, ID},
+	{0x1F6CC, 0x1F6CC, EB},
+	{0x1F6CD, 0x1F90B, ID},
+	{0x1F90C, 0x1F90C, EB},
+	{0x1F90D, 0x1F90E, ID},
+	{0x1F90F, 0x1F90F, EB},
+	{0x1F910, 0x1F917, ID},
+	{0x1F918, 0x1F91F, EB},
+	{0x1F920, 0x1F925, ID},
+	{0x1F926, 0x1F926, EB},
+	{0x1F927, 0x1F92F, ID},
+	{0x1F930, 0x1F939, EB},
+	{0x1F93A, 0x1F93C, ID},
+	{0x1F93D, 0x1F93E, EB},
+	{0x1F93F, 0x1F976, ID},
+	{0x1F977, 0x1F977, EB},
+	{0x1F978, 0x1F9B4, ID},
+	{0x1F9B5, 0x1F9B6, EB},
+	{0x1F9B7, 0x1F9B7, ID},
+	{0x1F9B8, 0x1F9B9, EB},
+	{0x1F9BA, 0x1F9BA, ID},
+	{0x1F9BB, 0x1F9BB, EB},
+	{0x1F9BC, 0x1F9CC, ID},
+	{0x1F9CD, 0x1F9CF, EB},
+	{0x1F9D0, 0x1F9D0, ID},
+	{0x1F9D1, 0x1F9DD, EB},
+	{0x1F9DE, 0x1FAC2, ID},
+	{0x1FAC3, 0x1FAC5, EB},
+	{0x1FAC6, 0x1FAEF, ID},
+	{0x1FAF0, 0x1FAF8, EB},
+	{0x1FAF9, 0x1FAFF, ID},
+	{0x20000, 0x2FFFD, ID},
+	{0x30000, 0x3FFFD, ID},
+}
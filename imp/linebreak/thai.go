@@ -0,0 +1,106 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package linebreak
+
+// Thai is written without spaces between words, and finding the words
+// requires a dictionary. Instead, thaiBreaks allows breaks at syllable
+// boundaries which can be recognized from the spelling alone:
+//
+//   - before a leading vowel (เ แ โ ใ ไ),
+//   - before a consonant which carries a vowel sign, like ษ in ภาษา, or
+//     before the first consonant of a cluster like หน or คร which carries
+//     one.
+//
+// A break is only allowed if the syllable before it is complete, i.e. it
+// contains a vowel sign, a leading vowel and a consonant, or at least two
+// consonants. Therefore single consonants with an implicit vowel, like ส in
+// สวัสดี, are never separated from the following syllable. Syllables with
+// implicit vowels only, like คน, are not divided either. The result breaks
+// between most words, but also between the syllables of a word.
+
+// thaiBreaks sets the break opportunities at the syllable boundaries of
+// the Thai run text[start:end].
+func thaiBreaks(text []rune, breaks []Opportunity, start, end int) {
+	syllable := start
+	for i := start + 1; i < end; i++ {
+		k := -1
+		switch r := text[i]; {
+		case isLeadingVowel(r):
+			k = i
+		case isThaiConsonant(r) && carriesVowel(text[i+1:end]):
+			k = i
+			if i-1 > syllable && isCluster(text[i-1], r) {
+				k = i - 1
+			}
+		}
+		if k < 0 || !completeSyllable(text[syllable:k]) {
+			continue
+		}
+		if breaks[k] == NoBreak {
+			breaks[k] = Allowed
+		}
+		syllable = k
+	}
+}
+
+func isThai(r rune) bool {
+	return r >= 0x0E01 && r <= 0x0E4E
+}
+
+func isThaiConsonant(r rune) bool {
+	return r >= 0x0E01 && r <= 0x0E2E
+}
+
+func isLeadingVowel(r rune) bool {
+	return r >= 0x0E40 && r <= 0x0E44
+}
+
+// isVowelSign reports whether r is a vowel written above, below or after
+// a consonant.
+func isVowelSign(r rune) bool {
+	return r >= 0x0E30 && r <= 0x0E39 || r == 0x0E45 || r == 0x0E47
+}
+
+// carriesVowel reports whether the consonant before text is followed by a
+// vowel sign, possibly after a tone mark.
+func carriesVowel(text []rune) bool {
+	for _, r := range text {
+		if r < 0x0E48 || r > 0x0E4B {
+			return isVowelSign(r)
+		}
+	}
+	return false
+}
+
+// isCluster reports whether the consonants a and b start a syllable
+// together, like กร or the silent ห in หน.
+func isCluster(a, b rune) bool {
+	switch a {
+	case 'ก', 'ข', 'ค', 'ต', 'ป', 'พ', 'ผ':
+		return b == 'ร' || b == 'ล' || b == 'ว'
+	case 'จ', 'ซ', 'ท', 'ศ', 'ส':
+		return b == 'ร'
+	case 'ห':
+		return b == 'ง' || b == 'ญ' || b == 'น' || b == 'ม' ||
+			b == 'ย' || b == 'ร' || b == 'ล' || b == 'ว'
+	case 'อ':
+		return b == 'ย'
+	}
+	return false
+}
+
+func completeSyllable(text []rune) bool {
+	leading, consonants := false, 0
+	for _, r := range text {
+		switch {
+		case isVowelSign(r):
+			return true
+		case isLeadingVowel(r):
+			leading = true
+		case isThaiConsonant(r):
+			consonants++
+		}
+	}
+	return consonants >= 2 || leading && consonants >= 1
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const lorem = `Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do
+eiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim
+veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea
+commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit
+esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat
+cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id
+est laborum.`
+
+// newTestImp returns an Imp which sets the text of a test document in lines
+// of the given width.
+func newTestImp(d *Document, width float64) *Imp {
+	return &Imp{State: &State{
+		Font:       d.fonts["normal"],
+		Size:       12,
+		LineHeight: 1.4,
+		ParSkip:    1.8,
+		MaxWidth:   width,
+		TextWidth:  width,
+		Tolerance:  200,
+		Justify:    true,
+		Hyphenate:  true,
+	}}
+}
+
+// splitLines breaks the text of a test document into lines of the given
+// width and returns the resulting tokens.
+func splitLines(t *testing.T, text string, width float64) (*Imp, []Token) {
+	d := newTestDocument(t)
+	d.AddText(text)
+	m := newTestImp(d, width)
+	tokens, err := d.tokens(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens = m.Hyphenate(tokens)
+	tokens = m.FindBreaks(tokens)
+	return m, m.SplitLines(tokens, 0)
+}
+
+// countLines returns the number of lines of every paragraph.
+func countLines(tokens []Token) []int {
+	lines := []int{1}
+	for _, tok := range tokens {
+		switch tok.(type) {
+		case LineBreak:
+			lines[len(lines)-1]++
+		case ParagraphBreak:
+			lines = append(lines, 1)
+		}
+	}
+	return lines
+}
+
+func TestLooseness(t *testing.T) {
+	// short words have enough glue to shrink the paragraph by a line
+	text := strings.Repeat("ab cd ef gh ", 40)
+	_, tokens := splitLines(t, text, 200)
+	natural := countLines(tokens)[0]
+	for _, looseness := range []int{-1, 1} {
+		input := fmt.Sprintf(`\tolerance{10000}\looseness{%d}%s\par %s`, looseness, text, text)
+		_, tokens := splitLines(t, input, 200)
+		lines := countLines(tokens)
+		if lines[0] != natural+looseness {
+			t.Errorf("looseness %d: got %d lines, want %d", looseness, lines[0], natural+looseness)
+		}
+		if lines[1] != natural {
+			t.Errorf("looseness %d: the next paragraph has %d lines, want %d", looseness, lines[1], natural)
+		}
+	}
+}
+
+func TestTolerance(t *testing.T) {
+	_, tight := splitLines(t, `\tolerance{100}`+lorem, 250)
+	_, loose := splitLines(t, `\tolerance{10000}`+lorem, 250)
+	if fmt.Sprint(tight) == fmt.Sprint(loose) {
+		t.Errorf("the tolerance does not change the line breaks")
+	}
+	m, _ := splitLines(t, `\tolerance{x}`+lorem, 250)
+	if len(m.Diagnostics) != 1 || m.Diagnostics[0].Message != `\tolerance: invalid number "x"` {
+		t.Errorf("got diagnostics %v", m.Diagnostics)
+	}
+}
+
+func TestOverfull(t *testing.T) {
+	for _, text := range []string{"Supercalifragilistic is long", "It is supercalifragilistic"} {
+		m, _ := splitLines(t, `\hyphenoff `+text, 60)
+		if len(m.Diagnostics) != 1 || !strings.HasPrefix(m.Diagnostics[0].Message, "overfull line") {
+			t.Errorf("%q: got diagnostics %v", text, m.Diagnostics)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import "fmt"
+
+// maxExpansions limits the number of macro expansions in a document, which
+// stops macros that call themselves.
+const maxExpansions = 1000000
+
+// A macroDef is a macro defined with \def.
+type macroDef struct {
+	params int
+	body   []Token
+}
+
+// ExpandMacros processes the definitions of macros and replaces every use
+// of a defined or registered macro by its expansion. A macro is defined
+// with
+//
+//	\def\name#1#2{body}
+//
+// and called as \name{first}{second}. The parameters #1 to #9 in the body
+// are replaced by the arguments, which are either a group or a single
+// token. Definitions are global and unknown macros are kept. Expanded
+// tokens have the position of the macro call. Invalid definitions, calls,
+// unbalanced groups and Problem tokens are reported as diagnostics.
+func (m *Imp) ExpandMacros(tokens []Token) ([]Token, error) {
+	defs := make(map[Macro]*macroDef)
+	ntokens := make([]Token, 0, len(tokens))
+	last := Pos(-1)
+	emit := func(tok Token, pos Pos) {
+		if _, space := tok.(Space); !space && pos != last {
+			ntokens = append(ntokens, pos)
+			last = pos
+		}
+		ntokens = append(ntokens, tok)
+	}
+	var groups []Pos
+	in := &tokenStack{}
+	in.push(tokens)
+	for expansions := 0; ; {
+		tok, ok := in.pop()
+		if !ok {
+			break
+		}
+		pos := in.pos
+		switch tok := tok.(type) {
+		case Param:
+			m.errorf(pos, "#%d outside of a macro definition", int(tok))
+		case Problem:
+			m.errorf(pos, "%s", string(tok))
+		case BeginGroup:
+			groups = append(groups, pos)
+			emit(tok, pos)
+		case EndGroup:
+			if len(groups) == 0 {
+				m.errorf(pos, "unexpected }")
+				continue
+			}
+			groups = groups[:len(groups)-1]
+			emit(tok, pos)
+		case Macro:
+			if tok == "\\def" {
+				name, def, err := parseDef(in)
+				if err != nil {
+					m.errorf(pos, "%v", err)
+					continue
+				}
+				defs[name] = def
+				// the spaces after a definition are ignored, even an
+				// empty line
+				for isSpace(in.peek()) {
+					in.pop()
+				}
+				continue
+			}
+			var expand MacroFunc
+			params := 0
+			if def := defs[tok]; def != nil {
+				expand, params = def.expand, def.params
+			} else if p, ok := lookupPlugin(tok); ok {
+				expand, params = p.fn, p.params
+			} else {
+				emit(tok, pos)
+				continue
+			}
+			if expansions++; expansions > maxExpansions {
+				return nil, Diagnostic{pos, fmt.Sprintf("%s: too many macro expansions", tok)}
+			}
+			args, err := readArgs(in, params)
+			if err != nil {
+				m.errorf(pos, "%s: %v", tok, err)
+				continue
+			}
+			body, err := expand(args)
+			if err != nil {
+				m.errorf(pos, "%s: %v", tok, err)
+				continue
+			}
+			in.push(body)
+			in.pos = pos
+		default:
+			emit(tok, pos)
+		}
+	}
+	for _, pos := range groups {
+		m.errorf(pos, "unclosed {")
+	}
+	return ntokens, nil
+}
+
+// parseDef parses the name, the parameters and the body of a definition.
+func parseDef(in *tokenStack) (Macro, *macroDef, error) {
+	name, ok := in.peek().(Macro)
+	if !ok {
+		return "", nil, fmt.Errorf("\\def: missing macro name")
+	}
+	in.pop()
+	def := &macroDef{}
+	for {
+		p, ok := in.peek().(Param)
+		if !ok {
+			break
+		}
+		in.pop()
+		if int(p) != def.params+1 {
+			return "", nil, fmt.Errorf("\\def%s: parameters must be numbered #1, #2, ...", name)
+		}
+		def.params++
+	}
+	body, ok := readGroup(in)
+	if !ok {
+		return "", nil, fmt.Errorf("\\def%s: missing body {...}", name)
+	}
+	for _, tok := range body {
+		if p, ok := tok.(Param); ok && int(p) > def.params {
+			return "", nil, fmt.Errorf("\\def%s: undefined parameter #%d", name, int(p))
+		}
+	}
+	def.body = body
+	return name, def, nil
+}
+
+// readArgs reads the arguments of a macro call.
+func readArgs(in *tokenStack, n int) ([][]Token, error) {
+	args := make([][]Token, 0, n)
+	for len(args) < n {
+		in.skipSpace()
+		switch in.peek().(type) {
+		case nil, EndGroup, Space, ParagraphBreak:
+			// like in TeX, the arguments end at a paragraph break
+			return nil, fmt.Errorf("expected %d arguments, got %d", n, len(args))
+		case BeginGroup:
+			arg, ok := readGroup(in)
+			if !ok {
+				return nil, fmt.Errorf("unbalanced braces in argument %d", len(args)+1)
+			}
+			args = append(args, arg)
+		default:
+			tok, _ := in.pop()
+			args = append(args, []Token{tok})
+		}
+	}
+	return args, nil
+}
+
+// readGroup reads a group and returns its content without the braces.
+func readGroup(in *tokenStack) ([]Token, bool) {
+	if _, ok := in.peek().(BeginGroup); !ok {
+		return nil, false
+	}
+	var group []Token
+	depth := 0
+	for {
+		tok, ok := in.pop()
+		if !ok {
+			return nil, false
+		}
+		switch tok.(type) {
+		case BeginGroup:
+			depth++
+		case EndGroup:
+			depth--
+			if depth == 0 {
+				return group[1:], true
+			}
+		}
+		group = append(group, tok)
+	}
+}
+
+// expand returns a copy of the body with the parameters replaced.
+func (def *macroDef) expand(args [][]Token) ([]Token, error) {
+	body := make([]Token, 0, len(def.body))
+	for _, tok := range def.body {
+		if p, ok := tok.(Param); ok {
+			body = append(body, args[p-1]...)
+		} else {
+			body = append(body, tok)
+		}
+	}
+	return body, nil
+}
+
+// A tokenStack holds the tokens which are not expanded yet. The tokens are
+// stored in reverse order, so that expansions are pushed cheaply. Pos
+// tokens are removed and the position of the last token is kept instead.
+type tokenStack struct {
+	tokens []Token
+	pos    Pos
+}
+
+func (s *tokenStack) push(tokens []Token) {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		s.tokens = append(s.tokens, tokens[i])
+	}
+}
+
+func (s *tokenStack) pop() (Token, bool) {
+	tok := s.peek()
+	if tok == nil {
+		return nil, false
+	}
+	s.tokens = s.tokens[:len(s.tokens)-1]
+	return tok, true
+}
+
+// peek returns the next token or nil.
+func (s *tokenStack) peek() Token {
+	for len(s.tokens) > 0 {
+		tok := s.tokens[len(s.tokens)-1]
+		pos, ok := tok.(Pos)
+		if !ok {
+			return tok
+		}
+		s.pos = pos
+		s.tokens = s.tokens[:len(s.tokens)-1]
+	}
+	return nil
+}
+
+// skipSpace skips spaces up to the next token or paragraph break.
+func (s *tokenStack) skipSpace() {
+	for {
+		if sp, ok := s.peek().(Space); !ok || sp.paragraph() {
+			return
+		}
+		s.pop()
+	}
+}
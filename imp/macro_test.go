@@ -0,0 +1,71 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"strings"
+	"testing"
+)
+
+// dump returns a readable form of tokens. Paragraph breaks are written
+// as ¶.
+func dump(tokens []Token) string {
+	var b strings.Builder
+	for _, tok := range tokens {
+		switch t := tok.(type) {
+		case Text:
+			b.WriteString(string(t))
+		case Space:
+			if t.paragraph() {
+				b.WriteString("¶")
+			} else {
+				b.WriteString(" ")
+			}
+		case Macro:
+			b.WriteString(string(t))
+		case BeginGroup:
+			b.WriteString("{")
+		case EndGroup:
+			b.WriteString("}")
+		case Problem:
+			b.WriteString("!(" + string(t) + ")")
+		}
+	}
+	return b.String()
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		diag  string
+	}{
+		{`\def\swap#1#2{#2#1}\swap{a}{b}`, "ba", ""},
+		{`\def\swap#1#2{#2#1}\swap{a} {b}`, "ba", ""},
+		{`\def\swap#1#2{#2#1}\swap ab c`, "cab", ""}, // words are single tokens
+		{"\\def\\swap#1#2{#2#1}\\swap{a}\n{b}", "ba", ""},
+		{"\\def\\swap#1#2{#2#1}\\swap{a}\n\n{b}", "¶{b}", "\\swap: expected 2 arguments, got 1"},
+		{"\\def\\x{X}\n\nA \\x B", "A XB", ""},
+		{`\unknown{a}`, `\unknown{a}`, ""},
+		{`\def\x#2{}`, "{}", "\\def\\x: parameters must be numbered #1, #2, ..."},
+	}
+	for _, test := range tests {
+		m := &Imp{}
+		tokens, err := m.ExpandMacros(Lex(test.input))
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if got := dump(tokens); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.input, got, test.want)
+		}
+		diag := ""
+		if len(m.Diagnostics) > 0 {
+			diag = m.Diagnostics[0].Message
+		}
+		if diag != test.diag {
+			t.Errorf("%q: got diagnostic %q, want %q", test.input, diag, test.diag)
+		}
+	}
+}
@@ -0,0 +1,620 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Style describes how an element of a Markdown document is displayed.
+type Style struct {
+	Font  string        // name of a font added with AddFont or ""
+	Size  int           // font size or 0
+	Color *SetTextColor // text color or nil
+}
+
+// tokens returns the tokens which switch to the style.
+func (st Style) tokens() []Token {
+	var tokens []Token
+	if st.Font != "" {
+		tokens = append(tokens, Macro("\\"+st.Font))
+	}
+	if st.Size != 0 {
+		tokens = append(tokens, SetFont{Size: st.Size})
+	}
+	if st.Color != nil {
+		tokens = append(tokens, *st.Color)
+	}
+	return tokens
+}
+
+// MarkdownStyles are the styles of the elements of Markdown documents.
+type MarkdownStyles struct {
+	Headings [6]Style
+	Emphasis Style
+	Strong   Style
+	Code     Style
+	Link     Style
+	Quote    Style
+}
+
+// DefaultMarkdownStyles returns styles which use the fonts normal, bold and
+// italic.
+func DefaultMarkdownStyles() MarkdownStyles {
+	blue := &SetTextColor{1, .34, 0, .21}
+	return MarkdownStyles{
+		Headings: [6]Style{
+			{Font: "bold", Size: 24, Color: blue},
+			{Font: "bold", Size: 18, Color: blue},
+			{Font: "bold", Size: 14, Color: blue},
+			{Font: "bold", Size: 12, Color: blue},
+			{Font: "bold", Size: 12},
+			{Font: "italic", Size: 12},
+		},
+		Emphasis: Style{Font: "italic"},
+		Strong:   Style{Font: "bold"},
+		Code:     Style{Color: &SetTextColor{0, 0, 0, .7}},
+		Link:     Style{Color: blue},
+		Quote:    Style{Font: "italic"},
+	}
+}
+
+// LexMarkdown splits a Markdown document into the tokens which Lex returns
+// for the equivalent markup. A subset of CommonMark is supported: ATX and
+// setext headings, paragraphs, emphasis, strong emphasis, lists, links,
+// code spans, code blocks and block quotes. Link targets are dropped.
+// Images cannot be displayed, they are replaced by their description and
+// reported with a Problem token. Nested lists are indented with no-break
+// spaces.
+func LexMarkdown(input string, styles *MarkdownStyles) []Token {
+	var lines []mdLine
+	for pos := 0; pos < len(input); {
+		end := strings.IndexByte(input[pos:], '\n')
+		if end < 0 {
+			end = len(input)
+		} else {
+			end += pos
+		}
+		text := strings.TrimSuffix(input[pos:end], "\r")
+		lines = append(lines, mdLine{strings.Replace(text, "\t", "    ", -1), pos})
+		pos = end + 1
+	}
+	p := &mdParser{styles: styles, last: -1}
+	p.blocks(lines, 0)
+	return p.tokens
+}
+
+// An mdLine is a line of a Markdown document and its position.
+type mdLine struct {
+	text string
+	pos  int
+}
+
+func (l mdLine) blank() bool {
+	return strings.TrimSpace(l.text) == ""
+}
+
+// indent returns the number of leading spaces.
+func (l mdLine) indent() int {
+	return len(l.text) - len(strings.TrimLeft(l.text, " "))
+}
+
+// cut removes the first n bytes of the line.
+func (l mdLine) cut(n int) mdLine {
+	if n > len(l.text) {
+		n = len(l.text)
+	}
+	return mdLine{l.text[n:], l.pos + n}
+}
+
+type mdParser struct {
+	styles *MarkdownStyles
+	tokens []Token
+	last   int // position of the last Pos token
+}
+
+// emit appends tokens which originate from the position pos.
+func (p *mdParser) emit(pos int, tokens ...Token) {
+	if pos != p.last {
+		p.tokens = append(p.tokens, Pos(pos))
+		p.last = pos
+	}
+	p.tokens = append(p.tokens, tokens...)
+}
+
+// blocks parses the block structure of lines. The depth is the nesting
+// level of lists.
+func (p *mdParser) blocks(lines []mdLine, depth int) {
+	for i := 0; i < len(lines); {
+		l := lines[i]
+		switch {
+		case l.blank() || isThematicBreak(l.text):
+			i++
+		case l.indent() >= 4:
+			end := i
+			for j := i; j < len(lines) && (lines[j].blank() || lines[j].indent() >= 4); j++ {
+				if !lines[j].blank() {
+					end = j + 1
+				}
+			}
+			code := make([]mdLine, 0, end-i)
+			for _, l := range lines[i:end] {
+				code = append(code, l.cut(4))
+			}
+			p.codeBlock(code)
+			i = end
+		case isFence(l.text) != "":
+			fence := isFence(l.text)
+			j := i + 1
+			for j < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[j].text), fence) {
+				j++
+			}
+			p.codeBlock(lines[i+1 : j])
+			i = j + 1
+		case headingLevel(l.text) > 0:
+			level := headingLevel(l.text)
+			text := strings.TrimLeft(l.text, " ")
+			l = l.cut(len(l.text) - len(text) + level)
+			l.text = strings.TrimRight(l.text, " ")
+			if t := strings.TrimRight(l.text, "#"); t == "" || strings.HasSuffix(t, " ") {
+				l.text = t
+			}
+			p.heading(level, []mdLine{l})
+			i++
+		case isQuote(l.text):
+			var quote []mdLine
+			for ; i < len(lines) && !lines[i].blank(); i++ {
+				l := lines[i]
+				if isQuote(l.text) {
+					l = l.cut(l.indent() + 1)
+					if strings.HasPrefix(l.text, " ") {
+						l = l.cut(1)
+					}
+				}
+				quote = append(quote, l)
+			}
+			p.emit(l.pos, BeginGroup{})
+			p.emit(l.pos, p.styles.Quote.tokens()...)
+			p.blocks(quote, depth)
+			p.emit(l.pos, EndGroup{})
+		case listMarker(l.text) != "":
+			i = p.list(lines, i, depth)
+		default:
+			j, level := i+1, 0
+			for ; j < len(lines) && !lines[j].blank(); j++ {
+				if level = setextLevel(lines[j].text); level > 0 || interrupts(lines[j].text) {
+					break
+				}
+			}
+			if level > 0 {
+				p.heading(level, lines[i:j])
+				i = j + 1
+			} else {
+				p.inline(lines[i:j])
+				p.emit(lines[j-1].pos, Macro("\\par"))
+				i = j
+			}
+		}
+	}
+}
+
+// list parses the items of a list starting at lines[i] and returns the
+// index of the first line after the list.
+func (p *mdParser) list(lines []mdLine, i, depth int) int {
+	marker := listMarker(lines[i].text)
+	ordered := !strings.ContainsAny(marker, "-*+")
+	number := 1
+	if ordered {
+		number, _ = strconv.Atoi(strings.TrimRight(strings.TrimSpace(marker), ".)"))
+	}
+	for i < len(lines) {
+		l := lines[i]
+		m := listMarker(l.text)
+		if m == "" || ordered == strings.ContainsAny(m, "-*+") {
+			break
+		}
+		indent := len(m)
+		item := []mdLine{l.cut(indent)}
+		j := i + 1
+		for j < len(lines) {
+			next := lines[j]
+			if next.blank() {
+				if j+1 < len(lines) && lines[j+1].indent() >= indent {
+					item = append(item, next)
+					j++
+					continue
+				}
+				break
+			}
+			if next.indent() >= indent {
+				item = append(item, next.cut(indent))
+			} else if !interrupts(next.text) && !lines[j-1].blank() {
+				item = append(item, next)
+			} else {
+				break
+			}
+			j++
+		}
+
+		bullet := []string{"•", "–"}[depth%2]
+		if ordered {
+			bullet = strconv.Itoa(number) + "."
+			number++
+		}
+		if depth > 0 {
+			p.emit(l.pos, Text(strings.Repeat("\u00a0", 4*depth)))
+		}
+		p.emit(l.pos, Text(bullet), Space(" "))
+		p.blocks(item, depth+1)
+		i = j
+		for i < len(lines) && lines[i].blank() {
+			i++
+		}
+	}
+	return i
+}
+
+func (p *mdParser) heading(level int, lines []mdLine) {
+	pos := lines[0].pos
+	p.emit(pos, BeginGroup{})
+	p.emit(pos, p.styles.Headings[level-1].tokens()...)
+	p.emit(pos, Macro("\\keepnext"))
+	p.inline(lines)
+	p.emit(pos, EndGroup{})
+	p.emit(pos, Macro("\\par"))
+}
+
+func (p *mdParser) codeBlock(lines []mdLine) {
+	for len(lines) > 0 && lines[len(lines)-1].blank() {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return
+	}
+	pos := lines[0].pos
+	p.emit(pos, BeginGroup{})
+	p.emit(pos, p.styles.Code.tokens()...)
+	p.emit(pos, Macro("\\raggedright"))
+	for i, l := range lines {
+		if i > 0 {
+			p.emit(l.pos, Macro("\\break"))
+		}
+		// indentation is kept with no-break spaces
+		if n := l.indent(); n > 0 && n < len(l.text) {
+			p.emit(l.pos, Text(strings.Repeat("\u00a0", n)))
+			l = l.cut(n)
+		}
+		p.text(l.text, l.pos)
+	}
+	p.emit(pos, EndGroup{})
+	p.emit(pos, Macro("\\par"))
+}
+
+// text emits words and spaces.
+func (p *mdParser) text(s string, pos int) {
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		j := i + n
+		if isBreakingSpace(r) {
+			for j < len(s) {
+				r, n := utf8.DecodeRuneInString(s[j:])
+				if !isBreakingSpace(r) {
+					break
+				}
+				j += n
+			}
+			p.tokens = append(p.tokens, Space(" "))
+		} else {
+			for j < len(s) {
+				r, n := utf8.DecodeRuneInString(s[j:])
+				if isBreakingSpace(r) {
+					break
+				}
+				j += n
+			}
+			p.emit(pos+i, Text(s[i:j]))
+		}
+		i = j
+	}
+}
+
+// inline parses the text of a paragraph or heading.
+func (p *mdParser) inline(lines []mdLine) {
+	var buf []byte
+	var offs []int
+	for i, l := range lines {
+		if i > 0 {
+			buf = append(buf, '\n')
+			offs = append(offs, l.pos-1)
+		}
+		text := strings.TrimLeft(l.text, " ")
+		for k := 0; k < len(text); k++ {
+			offs = append(offs, l.pos+len(l.text)-len(text)+k)
+		}
+		buf = append(buf, text...)
+	}
+	s := strings.TrimRight(string(buf), " ")
+	offs = append(offs[:len(s)], 0)
+	if len(s) > 0 {
+		offs[len(s)] = offs[len(s)-1] + 1
+	}
+	p.spans(s, offs)
+}
+
+// spans parses emphasis, code spans and links in s. The position of every
+// byte of s is given by offs.
+func (p *mdParser) spans(s string, offs []int) {
+	start := 0
+	flush := func(end int) {
+		if start < end {
+			p.text(s[start:end], offs[start])
+		}
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n',
+			c == '\n' && strings.HasSuffix(s[start:i], "  "):
+			flush(len(strings.TrimRight(s[:i], " ")))
+			p.emit(offs[i], Macro("\\break"))
+			if i++; c == '\\' {
+				i++
+			}
+			start = i
+			continue
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			flush(i)
+			p.emit(offs[i+1], Text(s[i+1:i+2]))
+			i += 2
+			start = i
+			continue
+		case c == '`':
+			n := runLength(s, i, '`')
+			if end := strings.Index(s[i+n:], s[i:i+n]); end >= 0 && runLength(s, i+n+end, '`') == n {
+				flush(i)
+				code := strings.Replace(s[i+n:i+n+end], "\n", " ", -1)
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				p.group(offs[i], p.styles.Code, func() {
+					p.text(code, offs[i+n])
+				})
+				i += 2*n + end
+				start = i
+				continue
+			}
+			i += n
+			continue
+		case c == '*' || c == '_':
+			n := runLength(s, i, c)
+			if n > 2 {
+				n = 2
+			}
+			if end := closingDelim(s, i+n, s[i:i+n]); end > 0 && (c == '*' || leftFlanking(s, i)) {
+				flush(i)
+				style := p.styles.Emphasis
+				if n == 2 {
+					style = p.styles.Strong
+				}
+				p.group(offs[i], style, func() {
+					p.spans(s[i+n:end], offs[i+n:end+1])
+				})
+				i = end + n
+				start = i
+				continue
+			}
+			i += n
+			continue
+		case c == '[' || c == '!' && i+1 < len(s) && s[i+1] == '[':
+			open := i
+			if c == '!' {
+				open++
+			}
+			if text, end, ok := parseLink(s, open); ok {
+				flush(i)
+				style := p.styles.Link
+				if c == '!' {
+					style = p.styles.Emphasis
+					src := strings.TrimSpace(s[text+2 : end-1])
+					p.emit(offs[i], Problem("image "+src+" is not supported"))
+				}
+				p.group(offs[i], style, func() {
+					p.spans(s[open+1:text], offs[open+1:text+1])
+				})
+				i = end
+				start = i
+				continue
+			}
+		}
+		i++
+	}
+	flush(len(s))
+}
+
+// group emits the tokens of fn within a group of the given style.
+func (p *mdParser) group(pos int, style Style, fn func()) {
+	p.emit(pos, BeginGroup{})
+	p.emit(pos, style.tokens()...)
+	fn()
+	p.emit(p.last, EndGroup{})
+}
+
+// parseLink parses a link [text](target) starting with the bracket at
+// s[i]. It returns the index of the closing bracket and the end of the
+// link.
+func parseLink(s string, i int) (text, end int, ok bool) {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				if j+1 >= len(s) || s[j+1] != '(' {
+					return 0, 0, false
+				}
+				k := strings.IndexByte(s[j+1:], ')')
+				if k < 0 {
+					return 0, 0, false
+				}
+				return j, j + 1 + k + 1, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// closingDelim returns the index of the delimiter which closes emphasis
+// opened before s[i] or -1.
+func closingDelim(s string, i int, delim string) int {
+	if i >= len(s) || s[i] == ' ' || s[i] == '\n' {
+		return -1
+	}
+	for j := i + 1; j+len(delim) <= len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if s[j] == '`' {
+			n := runLength(s, j, '`')
+			if end := strings.Index(s[j+n:], s[j:j+n]); end >= 0 {
+				j += 2*n + end - 1
+				continue
+			}
+		}
+		if !strings.HasPrefix(s[j:], delim) || s[j-1] == ' ' || s[j-1] == '\n' {
+			continue
+		}
+		n := runLength(s, j, delim[0])
+		if n == len(delim) {
+			if delim[0] == '_' && j+n < len(s) && isWordByte(s[j+n]) {
+				continue
+			}
+			return j
+		}
+		j += n - 1
+	}
+	return -1
+}
+
+// leftFlanking reports whether the underscore at s[i] starts a word.
+func leftFlanking(s string, i int) bool {
+	return i == 0 || !isWordByte(s[i-1])
+}
+
+func isWordByte(c byte) bool {
+	return c >= 0x80 || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+// isFence returns the fence if the line starts a fenced code block.
+func isFence(line string) string {
+	if len(line)-len(strings.TrimLeft(line, " ")) > 3 {
+		return ""
+	}
+	line = strings.TrimLeft(line, " ")
+	for _, c := range []byte{'`', '~'} {
+		if n := runLength(line, 0, c); n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// headingLevel returns the level of an ATX heading or 0.
+func headingLevel(line string) int {
+	if len(line)-len(strings.TrimLeft(line, " ")) > 3 {
+		return 0
+	}
+	line = strings.TrimLeft(line, " ")
+	n := runLength(line, 0, '#')
+	if n < 1 || n > 6 || n < len(line) && line[n] != ' ' {
+		return 0
+	}
+	return n
+}
+
+// setextLevel returns the level of a setext heading underline or 0.
+func setextLevel(line string) int {
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "":
+		return 0
+	case runLength(line, 0, '=') == len(line):
+		return 1
+	case runLength(line, 0, '-') == len(line):
+		return 2
+	}
+	return 0
+}
+
+func isQuote(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " "), ">") &&
+		len(line)-len(strings.TrimLeft(line, " ")) <= 3
+}
+
+// listMarker returns the marker of a list item including the spaces which
+// follow it, or "".
+func listMarker(line string) string {
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	if indent > 3 {
+		return ""
+	}
+	rest := line[indent:]
+	n := 0
+	switch {
+	case rest == "":
+		return ""
+	case strings.IndexByte("-*+", rest[0]) >= 0:
+		n = 1
+	default:
+		for n < len(rest) && n < 9 && rest[n] >= '0' && rest[n] <= '9' {
+			n++
+		}
+		if n == 0 || n >= len(rest) || rest[n] != '.' && rest[n] != ')' {
+			return ""
+		}
+		n++
+	}
+	if n < len(rest) && rest[n] != ' ' {
+		return ""
+	}
+	spaces := runLength(rest, n, ' ')
+	if spaces > 4 {
+		spaces = 1
+	}
+	if isThematicBreak(line) {
+		return ""
+	}
+	return line[:indent+n+spaces]
+}
+
+func isThematicBreak(line string) bool {
+	line = strings.Replace(strings.TrimSpace(line), " ", "", -1)
+	return len(line) >= 3 && strings.IndexByte("-*_", line[0]) >= 0 &&
+		runLength(line, 0, line[0]) == len(line)
+}
+
+// interrupts reports whether a line starts a new block and ends the
+// current paragraph.
+func interrupts(line string) bool {
+	return isFence(line) != "" || headingLevel(line) > 0 || isQuote(line) ||
+		isThematicBreak(line) || listMarker(line) != ""
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLexMarkdown(t *testing.T) {
+	// every style switches to a font named after the element, so dump
+	// shows which text is styled
+	styles := &MarkdownStyles{
+		Emphasis: Style{Font: "em"},
+		Strong:   Style{Font: "strong"},
+		Code:     Style{Font: "code"},
+		Link:     Style{Font: "link"},
+		Quote:    Style{Font: "quote"},
+	}
+	for i := range styles.Headings {
+		styles.Headings[i] = Style{Font: "h" + string(rune('1'+i))}
+	}
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Hello  world", `Hello world\par`},
+		{"one\ntwo\n\nthree", `one two\parthree\par`},
+		{"# Title #\n## Sub", `{\h1\keepnextTitle}\par{\h2\keepnextSub}\par`},
+		{"#nope", `#nope\par`},
+		{"Title\n=====\nSub\n---", `{\h1\keepnextTitle}\par{\h2\keepnextSub}\par`},
+		{"*a* **b** _c_ snake_case_name", `{\ema} {\strongb} {\emc} snake_case_name\par`},
+		{"**not closed", `**not closed\par`},
+		{"a `x * y` b", `a {\codex * y} b\par`},
+		{"\\*a\\*", `*a*\par`},
+		{"[a *link*](http://x) ![img](y.png)", `{\linka {\emlink}} !(image y.png is not supported){\emimg}\par`},
+		{"![a *logo*]( logo.jpg )", `!(image logo.jpg is not supported){\ema {\emlogo}}\par`},
+		{"line  \nbreak\\\nagain", `line\breakbreak\breakagain\par`},
+		{"- a\n- b\n  - c", `• a\par• b\par` + "\u00a0\u00a0\u00a0\u00a0" + `– c\par`},
+		{"1. a\n   - b\n     1. c\n- d", `1. a\par` + "\u00a0\u00a0\u00a0\u00a0" + `– b\par` +
+			"\u00a0\u00a0\u00a0\u00a0\u00a0\u00a0\u00a0\u00a0" + `1. c\par• d\par`},
+		{"3. x\n4. y", `3. x\par4. y\par`},
+		{"- a\n1. b", `• a\par1. b\par`},
+		{"> quoted\ntext", `{\quotequoted text\par}`},
+		{"    code\n      more", `{\code\raggedrightcode\break` + "  " + `more}\par`},
+		{"```\na  b\n```\nafter", `{\code\raggedrighta b}\parafter\par`},
+		{"a\n***\nb", `a\parb\par`},
+	}
+	for _, test := range tests {
+		if got := dump(LexMarkdown(test.input, styles)); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestLexMarkdownPos(t *testing.T) {
+	input := "# Head\n\nsome *text*"
+	styles := DefaultMarkdownStyles()
+	pos := -1
+	for _, tok := range LexMarkdown(input, &styles) {
+		switch tok := tok.(type) {
+		case Pos:
+			pos = int(tok)
+		case Text:
+			if pos < 0 || input[pos:pos+len(tok)] != string(tok) {
+				t.Errorf("text %q has position %d", tok, pos)
+			}
+		}
+	}
+}
+
+func TestMarkdownImage(t *testing.T) {
+	d := newTestDocument(t)
+	d.Markdown = MarkdownStyles{} // the test document has no bold and italic fonts
+	d.AddMarkdown("logo.md", "# Logo\n\nThe ![logo](logo.png) of Imp.")
+	var buf bytes.Buffer
+	if err := d.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Diagnostics) != 1 {
+		t.Fatalf("got diagnostics %v, want one", d.Diagnostics)
+	}
+	diag := d.Diagnostics[0]
+	if got, want := d.Position(diag.Pos).String()+": "+diag.Message, "logo.md:3:5: image logo.png is not supported"; got != want {
+		t.Errorf("got diagnostic %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,687 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+import (
+	"bytes"
+)
+
+// CFF top and private DICT operators which are referencing other parts of
+// the font program. Two byte operators are stored as 1200 + second byte.
+const (
+	cffOpCharset     = 15
+	cffOpEncoding    = 16
+	cffOpCharStrings = 17
+	cffOpPrivate     = 18
+	cffOpSubrs       = 19
+	cffOpFDArray     = 1236
+	cffOpFDSelect    = 1237
+)
+
+// A cffDictEntry is a single operator together with its raw operands.
+type cffDictEntry struct {
+	op       int
+	operands [][]byte
+}
+
+type cffDict []cffDictEntry
+
+// parseCFFIndex reads the CFF INDEX structure located at data[offset:] and
+// returns all entries as well as the offset of the first byte after it.
+func parseCFFIndex(data []byte, offset int) ([][]byte, int, error) {
+	if offset+2 > len(data) {
+		return nil, 0, errorf("unexpected end of CFF INDEX at 0x%x", offset)
+	}
+	count := int(u16(data, offset))
+	if count == 0 {
+		return nil, offset + 2, nil
+	}
+	if offset+3 > len(data) {
+		return nil, 0, errorf("unexpected end of CFF INDEX at 0x%x", offset)
+	}
+	offSize := int(data[offset+2])
+	if offSize < 1 || offSize > 4 {
+		return nil, 0, errorf("invalid CFF INDEX offset size %d", offSize)
+	}
+	offsetsStart := offset + 3
+	dataStart := offsetsStart + (count+1)*offSize - 1
+	if dataStart > len(data) {
+		return nil, 0, errorf("unexpected end of CFF INDEX at 0x%x", offset)
+	}
+	readOffset := func(i int) int {
+		v := 0
+		for k := 0; k < offSize; k++ {
+			v = v<<8 | int(data[offsetsStart+i*offSize+k])
+		}
+		return v
+	}
+	items := make([][]byte, count)
+	for i := 0; i < count; i++ {
+		start, end := dataStart+readOffset(i), dataStart+readOffset(i+1)
+		if start > end || end > len(data) {
+			return nil, 0, errorf("invalid CFF INDEX entry %d at 0x%x", i, offset)
+		}
+		items[i] = data[start:end]
+	}
+	return items, dataStart + readOffset(count), nil
+}
+
+// writeCFFIndex serializes the given entries as CFF INDEX structure.
+func writeCFFIndex(buf *bytes.Buffer, items [][]byte) {
+	buf.WriteByte(byte(len(items) >> 8))
+	buf.WriteByte(byte(len(items)))
+	if len(items) == 0 {
+		return
+	}
+	total := 1
+	for i := range items {
+		total += len(items[i])
+	}
+	offSize := 1
+	for total >= 1<<(8*uint(offSize)) {
+		offSize++
+	}
+	buf.WriteByte(byte(offSize))
+	writeOffset := func(v int) {
+		for k := offSize - 1; k >= 0; k-- {
+			buf.WriteByte(byte(v >> (8 * uint(k))))
+		}
+	}
+	pos := 1
+	writeOffset(pos)
+	for i := range items {
+		pos += len(items[i])
+		writeOffset(pos)
+	}
+	for i := range items {
+		buf.Write(items[i])
+	}
+}
+
+// parseCFFDict splits a CFF DICT into its operators and operands.
+func parseCFFDict(data []byte) (cffDict, error) {
+	var (
+		dict     cffDict
+		operands [][]byte
+	)
+	for i := 0; i < len(data); {
+		b := data[i]
+		if b <= 21 {
+			op := int(b)
+			if b == 12 {
+				if i+1 >= len(data) {
+					return nil, errorf("unexpected end of CFF DICT")
+				}
+				op = 1200 + int(data[i+1])
+				i++
+			}
+			i++
+			dict = append(dict, cffDictEntry{op, operands})
+			operands = nil
+			continue
+		}
+		size := 0
+		switch {
+		case b == 28:
+			size = 3
+		case b == 29:
+			size = 5
+		case b == 30:
+			for size = 1; i+size < len(data); size++ {
+				if n := data[i+size]; n&0x0f == 0x0f || n&0xf0 == 0xf0 {
+					break
+				}
+			}
+			size++
+		case b >= 32 && b <= 246:
+			size = 1
+		case b >= 247 && b <= 254:
+			size = 2
+		default:
+			return nil, errorf("invalid CFF DICT operand 0x%x", b)
+		}
+		if i+size > len(data) {
+			return nil, errorf("unexpected end of CFF DICT")
+		}
+		operands = append(operands, data[i:i+size])
+		i += size
+	}
+	return dict, nil
+}
+
+// lookup returns the integer operands of the given operator.
+func (d cffDict) lookup(op int) ([]int, bool) {
+	for _, e := range d {
+		if e.op == op {
+			values := make([]int, len(e.operands))
+			for i := range e.operands {
+				values[i] = cffDictInt(e.operands[i])
+			}
+			return values, true
+		}
+	}
+	return nil, false
+}
+
+// set replaces the operands of the given operator with fixed size integers,
+// so that the size of the dictionary doesn't depend on the values.
+func (d cffDict) set(op int, values ...int) cffDict {
+	operands := make([][]byte, len(values))
+	for i := range values {
+		v := uint32(int32(values[i]))
+		operands[i] = []byte{29, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+	for i := range d {
+		if d[i].op == op {
+			d[i].operands = operands
+			return d
+		}
+	}
+	return append(d, cffDictEntry{op, operands})
+}
+
+func (d cffDict) bytes() []byte {
+	buf := &bytes.Buffer{}
+	for _, e := range d {
+		for _, operand := range e.operands {
+			buf.Write(operand)
+		}
+		if e.op >= 1200 {
+			buf.WriteByte(12)
+			buf.WriteByte(byte(e.op - 1200))
+		} else {
+			buf.WriteByte(byte(e.op))
+		}
+	}
+	return buf.Bytes()
+}
+
+// cffDictInt decodes a single integer operand. Real numbers are truncated
+// to zero, since they are never used for offsets or sizes.
+func cffDictInt(b []byte) int {
+	switch {
+	case len(b) == 3 && b[0] == 28:
+		return int(int16(u16(b, 1)))
+	case len(b) == 5 && b[0] == 29:
+		return int(int32(u32(b, 1)))
+	case len(b) == 1 && b[0] >= 32 && b[0] <= 246:
+		return int(b[0]) - 139
+	case len(b) == 2 && b[0] >= 247 && b[0] <= 250:
+		return (int(b[0])-247)*256 + int(b[1]) + 108
+	case len(b) == 2 && b[0] >= 251 && b[0] <= 254:
+		return -(int(b[0])-251)*256 - int(b[1]) - 108
+	}
+	return 0
+}
+
+// cffSubrBias returns the bias which is added to subroutine numbers.
+func cffSubrBias(count int) int {
+	if count < 1240 {
+		return 107
+	} else if count < 33900 {
+		return 1131
+	}
+	return 32768
+}
+
+// A cffPrivate holds a private DICT together with its local subroutines.
+type cffPrivate struct {
+	dict  cffDict
+	subrs [][]byte
+	used  map[int]bool
+}
+
+func parseCFFPrivate(data []byte, sizeOffset []int) (*cffPrivate, error) {
+	if len(sizeOffset) != 2 {
+		return nil, errorf("invalid CFF private DICT reference")
+	}
+	size, offset := sizeOffset[0], sizeOffset[1]
+	if size < 0 || offset < 0 || offset+size > len(data) {
+		return nil, errorf("invalid CFF private DICT at 0x%x", offset)
+	}
+	dict, err := parseCFFDict(data[offset : offset+size])
+	if err != nil {
+		return nil, err
+	}
+	p := &cffPrivate{dict: dict, used: make(map[int]bool)}
+	if subrs, ok := dict.lookup(cffOpSubrs); ok && len(subrs) == 1 {
+		if p.subrs, _, err = parseCFFIndex(data, offset+subrs[0]); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// bytes returns the private DICT followed by the local subroutines.
+func (p *cffPrivate) bytes() []byte {
+	dict := p.dict
+	if len(p.subrs) > 0 {
+		dict = dict.set(cffOpSubrs, 0)
+		dict = dict.set(cffOpSubrs, len(dict.bytes()))
+	}
+	buf := &bytes.Buffer{}
+	buf.Write(dict.bytes())
+	if len(p.subrs) > 0 {
+		writeCFFIndex(buf, subsetSubrs(p.subrs, p.used))
+	}
+	return buf.Bytes()
+}
+
+// size returns the length of the private DICT alone.
+func (p *cffPrivate) size() int {
+	dict := p.dict
+	if len(p.subrs) > 0 {
+		dict = dict.set(cffOpSubrs, 0)
+	}
+	return len(dict.bytes())
+}
+
+// subsetSubrs replaces all unused subroutines with a single return operator.
+func subsetSubrs(subrs [][]byte, used map[int]bool) [][]byte {
+	result := make([][]byte, len(subrs))
+	for i := range subrs {
+		if used[i] {
+			result[i] = subrs[i]
+		} else {
+			result[i] = []byte{11} // return
+		}
+	}
+	return result
+}
+
+// A charStringWalker interprets Type 2 charstrings just far enough to find
+// all subroutines which are called. Hint masks make it necessary to keep
+// track of the number of stems too.
+type charStringWalker struct {
+	global [][]byte
+	local  *cffPrivate
+	usedG  map[int]bool
+	stack  []int
+	nStems int
+	depth  int
+}
+
+func (w *charStringWalker) walk(cs []byte) (done bool, err error) {
+	if w.depth++; w.depth > 10 {
+		return false, errorf("CFF subroutines nested too deeply")
+	}
+	defer func() { w.depth-- }()
+	for i := 0; i < len(cs); {
+		b := cs[i]
+		switch {
+		case b == 28:
+			if i+3 > len(cs) {
+				return false, errorf("unexpected end of charstring")
+			}
+			w.stack = append(w.stack, int(int16(u16(cs, i+1))))
+			i += 3
+			continue
+		case b >= 32 && b <= 246:
+			w.stack = append(w.stack, int(b)-139)
+			i++
+			continue
+		case b >= 247 && b <= 250:
+			if i+2 > len(cs) {
+				return false, errorf("unexpected end of charstring")
+			}
+			w.stack = append(w.stack, (int(b)-247)*256+int(cs[i+1])+108)
+			i += 2
+			continue
+		case b >= 251 && b <= 254:
+			if i+2 > len(cs) {
+				return false, errorf("unexpected end of charstring")
+			}
+			w.stack = append(w.stack, -(int(b)-251)*256-int(cs[i+1])-108)
+			i += 2
+			continue
+		case b == 255:
+			if i+5 > len(cs) {
+				return false, errorf("unexpected end of charstring")
+			}
+			w.stack = append(w.stack, int(int32(u32(cs, i+1)))>>16)
+			i += 5
+			continue
+		}
+
+		i++
+		switch b {
+		case 1, 3, 18, 23: // hstem, vstem, hstemhm, vstemhm
+			w.nStems += len(w.stack) / 2
+		case 19, 20: // hintmask, cntrmask
+			w.nStems += len(w.stack) / 2
+			i += (w.nStems + 7) / 8
+		case 10, 29: // callsubr, callgsubr
+			if len(w.stack) == 0 {
+				return false, errorf("charstring stack underflow")
+			}
+			n := w.stack[len(w.stack)-1]
+			w.stack = w.stack[:len(w.stack)-1]
+			subrs, used := w.global, w.usedG
+			if b == 10 {
+				if w.local == nil {
+					return false, errorf("charstring calls missing local subroutine")
+				}
+				subrs, used = w.local.subrs, w.local.used
+			}
+			n += cffSubrBias(len(subrs))
+			if n < 0 || n >= len(subrs) {
+				return false, errorf("invalid charstring subroutine %d", n)
+			}
+			used[n] = true
+			if done, err := w.walk(subrs[n]); done || err != nil {
+				return done, err
+			}
+			continue
+		case 11: // return
+			return false, nil
+		case 14: // endchar
+			return true, nil
+		case 12:
+			i++
+		}
+		w.stack = w.stack[:0]
+	}
+	return false, nil
+}
+
+// cffTableLength calculates the length of a charset, encoding or FDSelect
+// table which are all stored without an explicit length.
+func cffTableLength(data []byte, offset int, kind int, nGlyphs int) (int, error) {
+	if offset >= len(data) {
+		return 0, errorf("invalid CFF table offset 0x%x", offset)
+	}
+	format := int(data[offset])
+	length := 0
+	switch kind {
+	case cffOpCharset:
+		switch format {
+		case 0:
+			length = 1 + 2*(nGlyphs-1)
+		case 1, 2:
+			length = 1
+			size := 3
+			if format == 2 {
+				size = 4
+			}
+			for covered := 1; covered < nGlyphs; {
+				if offset+length+size > len(data) {
+					return 0, errorf("unexpected end of CFF charset")
+				}
+				nLeft := int(data[offset+length+2])
+				if format == 2 {
+					nLeft = int(u16(data, offset+length+2))
+				}
+				covered += nLeft + 1
+				length += size
+			}
+		default:
+			return 0, errorf("unsupported CFF charset format %d", format)
+		}
+	case cffOpEncoding:
+		if offset+2 > len(data) {
+			return 0, errorf("unexpected end of CFF encoding")
+		}
+		switch format & 0x7f {
+		case 0:
+			length = 2 + int(data[offset+1])
+		case 1:
+			length = 2 + 2*int(data[offset+1])
+		default:
+			return 0, errorf("unsupported CFF encoding format %d", format)
+		}
+		if format&0x80 != 0 {
+			if offset+length+1 > len(data) {
+				return 0, errorf("unexpected end of CFF encoding")
+			}
+			length += 1 + 3*int(data[offset+length])
+		}
+	case cffOpFDSelect:
+		switch format {
+		case 0:
+			length = 1 + nGlyphs
+		case 3:
+			if offset+3 > len(data) {
+				return 0, errorf("unexpected end of CFF FDSelect")
+			}
+			length = 5 + 3*int(u16(data, offset+1))
+		default:
+			return 0, errorf("unsupported CFF FDSelect format %d", format)
+		}
+	}
+	if offset+length > len(data) {
+		return 0, errorf("unexpected end of CFF table at 0x%x", offset)
+	}
+	return length, nil
+}
+
+// parseCFFFDSelect returns the font DICT index for every glyph.
+func parseCFFFDSelect(table []byte, nGlyphs int) []int {
+	fds := make([]int, nGlyphs)
+	switch table[0] {
+	case 0:
+		for i := range fds {
+			fds[i] = int(table[1+i])
+		}
+	case 3:
+		nRanges := int(u16(table, 1))
+		for i := 0; i < nRanges; i++ {
+			first := int(u16(table, 3+3*i))
+			fd := int(table[3+3*i+2])
+			last := int(u16(table, 3+3*(i+1)))
+			for g := first; g < last && g < nGlyphs; g++ {
+				fds[g] = fd
+			}
+		}
+	}
+	return fds
+}
+
+// SubsetCFF returns a stripped down copy of the font's CFF program which
+// only contains the outlines of the given glyphs. Glyph indexes are kept
+// stable, unused glyphs and subroutines are replaced with empty stubs.
+// The font is renamed to name if it is not empty.
+func (f *Font) SubsetCFF(glyphs []Index, name string) ([]byte, error) {
+	data := f.cff
+	if len(data) < 4 {
+		return nil, errorf("CFF block is too short (%d bytes)", len(data))
+	}
+	names, offset, err := parseCFFIndex(data, int(data[2]))
+	if err != nil {
+		return nil, err
+	}
+	topDicts, offset, err := parseCFFIndex(data, offset)
+	if err != nil {
+		return nil, err
+	}
+	stringIndex := offset
+	_, offset, err = parseCFFIndex(data, offset)
+	if err != nil {
+		return nil, err
+	}
+	stringData := data[stringIndex:offset]
+	gsubrs, _, err := parseCFFIndex(data, offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) != 1 || len(topDicts) != 1 {
+		return nil, errorf("CFF font sets are not supported")
+	}
+	top, err := parseCFFDict(topDicts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	csOffset, ok := top.lookup(cffOpCharStrings)
+	if !ok || len(csOffset) != 1 {
+		return nil, errorf("CFF font without charstrings")
+	}
+	charStrings, _, err := parseCFFIndex(data, csOffset[0])
+	if err != nil {
+		return nil, err
+	}
+	nGlyphs := len(charStrings)
+
+	// copy the tables which are not affected by the subsetting verbatim
+	raw := make(map[int][]byte)
+	for _, op := range []int{cffOpCharset, cffOpEncoding, cffOpFDSelect} {
+		v, ok := top.lookup(op)
+		if !ok || len(v) != 1 {
+			continue
+		}
+		if (op == cffOpCharset && v[0] <= 2) || (op == cffOpEncoding && v[0] <= 1) {
+			continue // predefined charset or encoding
+		}
+		length, err := cffTableLength(data, v[0], op, nGlyphs)
+		if err != nil {
+			return nil, err
+		}
+		raw[op] = data[v[0] : v[0]+length]
+	}
+
+	// load the private DICTs and determine which one is used for a glyph
+	var (
+		privates []*cffPrivate
+		fdDicts  []cffDict
+		fdSelect []int
+	)
+	if v, ok := top.lookup(cffOpFDArray); ok && len(v) == 1 {
+		if raw[cffOpFDSelect] == nil {
+			return nil, errorf("CID-keyed CFF font without FDSelect")
+		}
+		fdSelect = parseCFFFDSelect(raw[cffOpFDSelect], nGlyphs)
+		fds, _, err := parseCFFIndex(data, v[0])
+		if err != nil {
+			return nil, err
+		}
+		for i := range fds {
+			fd, err := parseCFFDict(fds[i])
+			if err != nil {
+				return nil, err
+			}
+			p, err := parseCFFPrivate(data, mustLookup(fd, cffOpPrivate))
+			if err != nil {
+				return nil, err
+			}
+			fdDicts = append(fdDicts, fd)
+			privates = append(privates, p)
+		}
+	} else {
+		p, err := parseCFFPrivate(data, mustLookup(top, cffOpPrivate))
+		if err != nil {
+			return nil, err
+		}
+		privates = append(privates, p)
+	}
+
+	// strip all unused glyphs and find the required subroutines
+	used := make([]bool, nGlyphs)
+	used[0] = true
+	for _, g := range glyphs {
+		if int(g) < nGlyphs {
+			used[g] = true
+		}
+	}
+	usedG := make(map[int]bool)
+	subset := make([][]byte, nGlyphs)
+	for g := range charStrings {
+		if !used[g] {
+			subset[g] = []byte{14} // endchar
+			continue
+		}
+		local := privates[0]
+		if fdSelect != nil {
+			if fdSelect[g] >= len(privates) {
+				return nil, errorf("invalid FDSelect entry for glyph %d", g)
+			}
+			local = privates[fdSelect[g]]
+		}
+		walker := &charStringWalker{global: gsubrs, local: local, usedG: usedG}
+		if _, err := walker.walk(charStrings[g]); err != nil {
+			return nil, err
+		}
+		subset[g] = charStrings[g]
+	}
+
+	if name == "" {
+		name = string(names[0])
+	}
+
+	// calculate the layout of the new font program. All offsets within the
+	// DICTs are stored as fixed size integers, therefore the size of those
+	// DICTs can be determined before the offsets are known.
+	for _, op := range []int{cffOpCharset, cffOpEncoding, cffOpFDSelect, cffOpCharStrings} {
+		if raw[op] != nil || op == cffOpCharStrings {
+			top = top.set(op, 0)
+		}
+	}
+	if fdDicts != nil {
+		top = top.set(cffOpFDArray, 0)
+		for i := range fdDicts {
+			fdDicts[i] = fdDicts[i].set(cffOpPrivate, 0, 0)
+		}
+	} else {
+		top = top.set(cffOpPrivate, 0, 0)
+	}
+
+	head := &bytes.Buffer{}
+	head.Write([]byte{data[0], data[1], 4, data[3]})
+	writeCFFIndex(head, [][]byte{[]byte(name)})
+	headerLen := head.Len()
+	topLen := len(indexBytes(top.bytes()))
+	gsubrsBuf := &bytes.Buffer{}
+	writeCFFIndex(gsubrsBuf, subsetSubrs(gsubrs, usedG))
+
+	pos := headerLen + topLen + len(stringData) + gsubrsBuf.Len()
+	for _, op := range []int{cffOpCharset, cffOpEncoding, cffOpFDSelect} {
+		if raw[op] != nil {
+			top = top.set(op, pos)
+			pos += len(raw[op])
+		}
+	}
+	top = top.set(cffOpCharStrings, pos)
+	csBuf := &bytes.Buffer{}
+	writeCFFIndex(csBuf, subset)
+	pos += csBuf.Len()
+
+	privBuf := &bytes.Buffer{}
+	if fdDicts == nil {
+		top = top.set(cffOpPrivate, privates[0].size(), pos)
+		privBuf.Write(privates[0].bytes())
+	} else {
+		for i := range fdDicts {
+			fdDicts[i] = fdDicts[i].set(cffOpPrivate, privates[i].size(), pos+privBuf.Len())
+			privBuf.Write(privates[i].bytes())
+		}
+		top = top.set(cffOpFDArray, pos+privBuf.Len())
+		fds := make([][]byte, len(fdDicts))
+		for i := range fdDicts {
+			fds[i] = fdDicts[i].bytes()
+		}
+		writeCFFIndex(privBuf, fds)
+	}
+
+	out := &bytes.Buffer{}
+	out.Write(head.Bytes())
+	out.Write(indexBytes(top.bytes()))
+	out.Write(stringData)
+	out.Write(gsubrsBuf.Bytes())
+	for _, op := range []int{cffOpCharset, cffOpEncoding, cffOpFDSelect} {
+		out.Write(raw[op])
+	}
+	out.Write(csBuf.Bytes())
+	out.Write(privBuf.Bytes())
+	return out.Bytes(), nil
+}
+
+// indexBytes wraps a single entry in a CFF INDEX structure.
+func indexBytes(item []byte) []byte {
+	buf := &bytes.Buffer{}
+	writeCFFIndex(buf, [][]byte{item})
+	return buf.Bytes()
+}
+
+func mustLookup(d cffDict, op int) []int {
+	v, _ := d.lookup(op)
+	return v
+}
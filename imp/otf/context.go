@@ -0,0 +1,318 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A Context shapes text using the features of a specific OpenType script
+// and language system, for example to get the Turkish variant of the "fi"
+// ligature or language specific kerning.
+type Context struct {
+	Font        *Font
+	Script      string // OpenType script tag, e.g. "latn"
+	Language    string // OpenType language system tag, e.g. "TRK "
+	RightToLeft bool   // glyphs are returned in visual order
+
+	gsub, gpos *langSys
+}
+
+// Context returns a shaping context for the given OpenType script and
+// language system tags, e.g. ("latn", "TRK"). Tags are padded with spaces.
+// An empty or unsupported script or language selects the font's defaults.
+func (f *Font) Context(script, lang string) *Context {
+	c := &Context{Font: f}
+	if script != "" {
+		c.Script = padTag(script)
+	}
+	if lang != "" {
+		c.Language = padTag(lang)
+	}
+	c.RightToLeft = rtlScripts[c.Script]
+	if f.gsub != nil {
+		c.gsub = f.gsub.langSys(f.gsub.scriptTag(c.Script), c.Language)
+	}
+	if f.gpos != nil {
+		c.gpos = f.gpos.langSys(f.gpos.scriptTag(c.Script), c.Language)
+	}
+	return c
+}
+
+// scriptTag prefers the newer shaping model of Indic scripts if the font
+// supports it.
+func (l *layout) scriptTag(script string) string {
+	if v2, ok := indicScripts[script]; ok {
+		if _, ok := l.scripts[v2]; ok {
+			return v2
+		}
+	}
+	return script
+}
+
+// Substitute applies the glyph substitutions of the given OpenType features
+// (e.g. "liga", "smcp", "onum" or "ss01") to a run of glyphs. A feature can
+// be written as "tag=n" to select the n-th alternate glyph, "tag=0" or
+// "-tag" disables it.
+func (c *Context) Substitute(glyphs []Index, features ...string) []Index {
+	if c.Font.gsub == nil || len(glyphs) == 0 {
+		return glyphs
+	}
+	buf := newGlyphBuffer(glyphs)
+	c.Font.substitute(buf, c.gsub, parseFeatures(features))
+	return buf.glyphs
+}
+
+// WouldSubstitute reports whether the given feature changes the sequence of
+// glyphs.
+func (c *Context) WouldSubstitute(glyphs []Index, feature string) bool {
+	in := make([]Index, len(glyphs))
+	copy(in, glyphs)
+	out := c.Substitute(in, feature)
+	if len(out) != len(glyphs) {
+		return true
+	}
+	for i := range out {
+		if out[i] != glyphs[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// Position applies the GPOS lookups of the given features (e.g. "kern",
+// "mark" or "mkmk") to a run of glyphs. The cluster of each resulting glyph
+// is its position within the input.
+func (c *Context) Position(glyphs []Index, features ...string) []Glyph {
+	buf := newGlyphBuffer(glyphs)
+	return c.PositionBuffer(&Buffer{Glyphs: buf.glyphs, Clusters: buf.clusters},
+		parseFeatures(features)...)
+}
+
+// Shape converts a string into a list of positioned glyphs. Both the GSUB
+// and the GPOS lookups of the given features are applied. The cluster of
+// each glyph is the byte offset of its first rune within the text.
+func (c *Context) Shape(text string, features ...string) []Glyph {
+	buf := c.Font.NewBuffer(text)
+	values := parseFeatures(features)
+	c.SubstituteBuffer(buf, values...)
+	return c.PositionBuffer(buf, values...)
+}
+
+// A Buffer holds a run of glyphs which is shaped in several stages, e.g.
+// by a shaper for complex scripts. Every glyph belongs to a cluster and has
+// a mask which selects the features that are applied to it.
+type Buffer struct {
+	Glyphs   []Index
+	Clusters []int
+	Masks    []uint32
+}
+
+// NewBuffer maps the runes of a text to glyphs. The cluster of each glyph
+// is the byte offset of its rune within the text and its mask is 1.
+func (f *Font) NewBuffer(text string) *Buffer {
+	b := &Buffer{}
+	for pos, r := range text {
+		b.Append(f.Index(r), pos, 1)
+	}
+	return b
+}
+
+// Append adds a glyph to the end of the buffer.
+func (b *Buffer) Append(g Index, cluster int, mask uint32) {
+	b.Glyphs = append(b.Glyphs, g)
+	b.Clusters = append(b.Clusters, cluster)
+	b.Masks = append(b.Masks, mask)
+}
+
+// SubstituteBuffer applies the GSUB lookups of the given features to the
+// buffer. All lookups are applied in the order they are defined by the
+// font. Features which must see the result of others are applied by
+// calling SubstituteBuffer several times.
+func (c *Context) SubstituteBuffer(b *Buffer, features ...Feature) {
+	if c.Font.gsub == nil || len(b.Glyphs) == 0 {
+		return
+	}
+	buf := &glyphBuffer{glyphs: b.Glyphs, clusters: b.Clusters, masks: b.Masks}
+	c.Font.substitute(buf, c.gsub, features)
+	b.Glyphs, b.Clusters, b.Masks = buf.glyphs, buf.clusters, buf.masks
+}
+
+// PositionBuffer applies the GPOS lookups of the given features to the
+// buffer and returns the positioned glyphs. The glyphs are returned in
+// reverse order if the context is right-to-left.
+func (c *Context) PositionBuffer(b *Buffer, features ...Feature) []Glyph {
+	buf := &glyphBuffer{glyphs: b.Glyphs, clusters: b.Clusters, masks: b.Masks}
+	if c.Font.gpos != nil {
+		c.Font.position(buf, c.gpos, features, c.RightToLeft)
+	}
+	glyphs := buf.result(c.Font)
+	if c.RightToLeft {
+		for i, j := 0, len(glyphs)-1; i < j; i, j = i+1, j-1 {
+			glyphs[i], glyphs[j] = glyphs[j], glyphs[i]
+		}
+	}
+	return glyphs
+}
+
+// padTag pads an OpenType tag with spaces to a length of four.
+func padTag(tag string) string {
+	if len(tag) < 4 {
+		tag += strings.Repeat(" ", 4-len(tag))
+	}
+	return tag
+}
+
+// ScriptTag returns the OpenType script tag of a rune. Characters which are
+// shared by many scripts, like digits and punctuation, return "".
+func ScriptTag(r rune) string {
+	if r < 0x80 {
+		if unicode.IsLetter(r) {
+			return "latn"
+		}
+		return ""
+	}
+	for _, s := range scriptTags {
+		if unicode.Is(s.table, r) {
+			return s.tag
+		}
+	}
+	return ""
+}
+
+// LanguageTag converts an ISO 639 language code (e.g. "de" or "tr") into
+// the corresponding OpenType language system tag. Unknown codes are
+// converted to upper case.
+func LanguageTag(code string) string {
+	code = strings.ToLower(code)
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	if code == "" {
+		return ""
+	}
+	if tag, ok := languageTags[code]; ok {
+		return tag
+	}
+	return padTag(strings.ToUpper(code))
+}
+
+var scriptTags = []struct {
+	table *unicode.RangeTable
+	tag   string
+}{
+	{unicode.Latin, "latn"},
+	{unicode.Greek, "grek"},
+	{unicode.Cyrillic, "cyrl"},
+	{unicode.Armenian, "armn"},
+	{unicode.Hebrew, "hebr"},
+	{unicode.Arabic, "arab"},
+	{unicode.Syriac, "syrc"},
+	{unicode.Thaana, "thaa"},
+	{unicode.Nko, "nko "},
+	{unicode.Devanagari, "deva"},
+	{unicode.Bengali, "beng"},
+	{unicode.Gurmukhi, "guru"},
+	{unicode.Gujarati, "gujr"},
+	{unicode.Oriya, "orya"},
+	{unicode.Tamil, "taml"},
+	{unicode.Telugu, "telu"},
+	{unicode.Kannada, "knda"},
+	{unicode.Malayalam, "mlym"},
+	{unicode.Sinhala, "sinh"},
+	{unicode.Thai, "thai"},
+	{unicode.Lao, "lao "},
+	{unicode.Tibetan, "tibt"},
+	{unicode.Myanmar, "mymr"},
+	{unicode.Georgian, "geor"},
+	{unicode.Hangul, "hang"},
+	{unicode.Ethiopic, "ethi"},
+	{unicode.Khmer, "khmr"},
+	{unicode.Mongolian, "mong"},
+	{unicode.Hiragana, "kana"},
+	{unicode.Katakana, "kana"},
+	{unicode.Han, "hani"},
+	{unicode.Bopomofo, "bopo"},
+}
+
+// rtlScripts contains the scripts which are written from right to left.
+var rtlScripts = map[string]bool{
+	"arab": true,
+	"hebr": true,
+	"nko ": true,
+	"syrc": true,
+	"thaa": true,
+}
+
+// indicScripts maps the Indic script tags to their version 2 counterparts.
+var indicScripts = map[string]string{
+	"beng": "bng2",
+	"deva": "dev2",
+	"gujr": "gjr2",
+	"guru": "gur2",
+	"knda": "knd2",
+	"mlym": "mlm2",
+	"orya": "ory2",
+	"taml": "tml2",
+	"telu": "tel2",
+}
+
+var languageTags = map[string]string{
+	"ar":  "ARA ",
+	"az":  "AZE ",
+	"bg":  "BGR ",
+	"bn":  "BEN ",
+	"ca":  "CAT ",
+	"crh": "CRT ",
+	"cs":  "CSY ",
+	"cy":  "WEL ",
+	"da":  "DAN ",
+	"de":  "DEU ",
+	"el":  "ELL ",
+	"en":  "ENG ",
+	"es":  "ESP ",
+	"et":  "ETI ",
+	"fa":  "FAR ",
+	"fi":  "FIN ",
+	"fr":  "FRA ",
+	"ga":  "IRI ",
+	"he":  "IWR ",
+	"hi":  "HIN ",
+	"hr":  "HRV ",
+	"hu":  "HUN ",
+	"hy":  "HYE ",
+	"is":  "ISL ",
+	"it":  "ITA ",
+	"ja":  "JAN ",
+	"kk":  "KAZ ",
+	"ko":  "KOR ",
+	"lt":  "LTH ",
+	"lv":  "LVI ",
+	"mk":  "MKD ",
+	"mr":  "MAR ",
+	"mt":  "MTS ",
+	"nb":  "NOR ",
+	"ne":  "NEP ",
+	"nl":  "NLD ",
+	"nn":  "NYN ",
+	"no":  "NOR ",
+	"pl":  "PLK ",
+	"pt":  "PTG ",
+	"ro":  "ROM ",
+	"ru":  "RUS ",
+	"sk":  "SKY ",
+	"sl":  "SLV ",
+	"sq":  "SQI ",
+	"sr":  "SRB ",
+	"sv":  "SVE ",
+	"ta":  "TAM ",
+	"th":  "THA ",
+	"tr":  "TRK ",
+	"tt":  "TAT ",
+	"uk":  "UKR ",
+	"ur":  "URD ",
+	"vi":  "VIT ",
+	"zh":  "ZHS ",
+}
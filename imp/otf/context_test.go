@@ -0,0 +1,77 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContextLanguage(t *testing.T) {
+	f := openTestFont(t)
+	i := f.indexes("i")
+	tests := []struct {
+		script, lang string
+		changed      bool
+	}{
+		{"", "", false},
+		{"latn", "", false},
+		{"latn", "DEU", false},
+		{"latn", "TRK", true},
+		{"latn", "AZE ", true},
+		{"cyrl", "TRK", false}, // the font falls back to the default script
+	}
+	for _, test := range tests {
+		c := f.Context(test.script, test.lang)
+		if changed := c.WouldSubstitute(i, "locl"); changed != test.changed {
+			t.Errorf("Context(%q, %q): locl changes i: %v, want %v",
+				test.script, test.lang, changed, test.changed)
+		}
+	}
+
+	// the features of the default language are still available
+	c := f.Context("latn", "TRK")
+	if got := c.Substitute(f.indexes("ff"), "liga"); len(got) != 1 {
+		t.Errorf("no ligature for ff in Turkish text: %v", got)
+	}
+}
+
+func TestContextDirection(t *testing.T) {
+	f := openTestFont(t)
+	if f.Context("latn", "").RightToLeft || !f.Context("arab", "").RightToLeft {
+		t.Error("wrong direction of the Latin or Arabic script")
+	}
+	g := f.Context("hebr", "").Shape("ab")
+	var clusters []int
+	for _, p := range g {
+		clusters = append(clusters, p.Cluster)
+	}
+	if !reflect.DeepEqual(clusters, []int{1, 0}) {
+		t.Errorf("right-to-left glyphs are in the order %v, want [1 0]", clusters)
+	}
+}
+
+func TestScriptTag(t *testing.T) {
+	tests := map[rune]string{
+		'a': "latn", 'ä': "latn", 'α': "grek", 'ж': "cyrl", 'ب': "arab",
+		'1': "", ' ': "", '.': "",
+	}
+	for r, want := range tests {
+		if got := ScriptTag(r); got != want {
+			t.Errorf("ScriptTag(%q) = %q, want %q", r, got, want)
+		}
+	}
+}
+
+func TestLanguageTag(t *testing.T) {
+	tests := map[string]string{
+		"tr": "TRK ", "de": "DEU ", "de-AT": "DEU ", "de_CH": "DEU ",
+		"TR": "TRK ", "xx": "XX  ", "": "",
+	}
+	for code, want := range tests {
+		if got := LanguageTag(code); got != want {
+			t.Errorf("LanguageTag(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"sort"
+	"unicode"
 	"unicode/utf16"
 )
 
@@ -24,21 +26,22 @@ type Font struct {
 	CapHeight              int     // height of an uppercase letter (from baseline)
 	ItalicAngle            float32 // italic angle
 
-	cm          []cm
-	hm          []HMetric
-	cmapIndexes []byte
-	nHMetric    int
-	nGlyph      int
-	nKern       int
-	kernTable   []byte
+	cm        []cm
+	symbol    bool // cmap uses the Microsoft symbol encoding
+	hm        []HMetric
+	nHMetric  int
+	nGlyph    int
+	nKern     int
+	kernTable []byte
 
 	tables map[string][]byte
 
-	liga      []Ligature
-	kern      []Kerning
-	classKern *classKerner
+	gsub *layout
+	gpos *layout
 
-	smcpBefore, smcpAfter []Index
+	glyphClass      classDef   // glyph classes from the GDEF table
+	markAttachClass classDef   // mark attachment classes from the GDEF table
+	markSets        []coverage // mark glyph sets from the GDEF table
 
 	// font tables
 	full []byte // complete TTF / OTF file
@@ -46,7 +49,6 @@ type Font struct {
 	name []byte // naming table
 	cff  []byte // PostScript font programm (Compact Font Format, optional)
 	os2  []byte // OS/2 and Windows specific metrics
-	gpos []byte // glyph positioning data
 }
 
 // Open reads in a font file stored on the filesystem.
@@ -90,7 +92,6 @@ func Parse(data []byte) (*Font, error) {
 
 	f.head = f.tables["head"]
 	f.name = f.tables["name"]
-	f.gpos = f.tables["GPOS"]
 	f.cff = f.tables["CFF "]
 	f.os2 = f.tables["OS/2"]
 
@@ -123,10 +124,10 @@ func Parse(data []byte) (*Font, error) {
 	if err := f.parsePost(f.tables["post"]); err != nil {
 		return nil, err
 	}
-	if err := f.parseGsub(); err != nil {
+	if err := f.parseGdef(); err != nil {
 		return nil, err
 	}
-	if err := f.parseGsubSmcp(); err != nil {
+	if err := f.parseGsub(); err != nil {
 		return nil, err
 	}
 	if err := f.parseGpos(); err != nil {
@@ -211,203 +212,47 @@ func (f *Font) TTF() []byte {
 	return f.full
 }
 
-func (f *Font) parseGsub() error {
-	data := f.tables["GSUB"]
+func (f *Font) parseGdef() error {
+	data := f.tables["GDEF"]
 	if len(data) == 0 {
-		return nil // GSUB block is optional
-	}
-	if len(data) < 10 {
-		return errorf("GSUB block is too short (%d bytes)", len(data))
-	}
-	var (
-		scriptTableOffset  = int(u16(data, 4))
-		featureTableOffset = int(u16(data, 6))
-		lookupTableOffset  = int(u16(data, 8))
-	)
-
-	featureIDs, err := f.parseScriptTable(data, scriptTableOffset, "", "")
-	if err != nil {
-		return err
-	}
-
-	lookupIDs, err := f.parseFeatureTable(data, featureTableOffset, featureIDs, "liga")
-	if err != nil {
-		return err
-	}
-
-	// parse lookup table
-	if lookupTableOffset+2 > len(data) {
-		return errorf("invalid GSUB lookup table at 0x%x", lookupTableOffset)
+		return nil // GDEF block is optional
 	}
-	lookupCount := int(u16(data, lookupTableOffset))
-	if lookupTableOffset+2+lookupCount*2 > len(data) {
-		return errorf("unexpected end of GSUB lookup table with %d entries", lookupCount)
+	if len(data) < 12 {
+		return errorf("GDEF block is too short (%d bytes)", len(data))
 	}
-	for _, i := range lookupIDs {
-		offset := int(u16(data, lookupTableOffset+2+i*2)) + lookupTableOffset
-
-		if offset+6 > len(data) {
-			return errorf("unexpected end of GSUB lookup entry at 0x%x", offset)
-		}
-		kind := int(u16(data, offset))
-		subblockCount := int(u16(data, offset+4))
-		if offset+6+subblockCount*2 > len(data) {
-			return errorf("unexpected end of GSUB lookup entry at 0x%x", offset)
-		}
-		if kind != 4 {
-			return errorf("unsupported GSUB lookup type %d", kind)
-		}
-		for j := 0; j < subblockCount; j++ {
-			subblockOffset := int(u16(data, offset+6+j*2)) + offset
-			if subblockOffset+6 > len(data) {
-				return errorf("unexpected end of GSUB subblock at 0x%x", subblockOffset)
-			}
-			if format := u16(data, subblockOffset); format != 1 {
-				return errorf("unsupported GSUB lookup type 4 format %d", format)
-			}
-			coverageOffset := int(u16(data, subblockOffset+2)) + subblockOffset
-			ligaSetCount := int(u16(data, subblockOffset+4))
-
-			// parse coverage
-			coverage, err := f.parseCoverage(data, coverageOffset)
-			if err != nil {
-				return err
-			}
-			if len(coverage) != ligaSetCount {
-				return errorf("GSUB coverage length doesn't match ligature set length")
-			}
-
-			// parse ligature sets
-			if subblockOffset+6+ligaSetCount*2 > len(data) {
-				return errorf("unexpected end of GSUB liga subblock at 0x%x", subblockOffset)
-			}
-			for k := 0; k < ligaSetCount; k++ {
-				ligaSetOffset := int(u16(data, subblockOffset+6+k*2)) + subblockOffset
-				if ligaSetOffset+2 > len(data) {
-					return errorf("unexpected end of GSUB ligature set at 0x%x", ligaSetOffset)
-				}
-				ligaCount := int(u16(data, ligaSetOffset))
-				if ligaSetOffset+2+2*ligaCount > len(data) {
-					return errorf("unexpected end of GSUB ligature set at 0x%x", ligaSetOffset)
-				}
-				// parse ligatures
-				for l := 0; l < ligaCount; l++ {
-					ligaOffset := int(u16(data, ligaSetOffset+2+2*l)) + ligaSetOffset
-					if ligaOffset+4 > len(data) {
-						return errorf("unexpected end of GSUB ligature entry at 0x%x", ligaOffset)
-					}
-					ligaGlyph := Index(int(u16(data, ligaOffset)))
-					compCount := int(u16(data, ligaOffset+2))
-					if ligaOffset+4+(compCount-1)*2 > len(data) {
-						return errorf("unexpected end of GSUB ligature entry at 0x%x", ligaOffset)
-					}
-					component := make([]Index, compCount)
-					component[0] = coverage[k]
-					for m := 1; m < compCount; m++ {
-						component[m] = Index(u16(data, ligaOffset+4+m*2-2))
-					}
-					f.liga = append(f.liga, Ligature{Old: component, New: ligaGlyph})
-				}
-			}
+	var err error
+	if offset := int(u16(data, 4)); offset != 0 {
+		if f.glyphClass, err = f.parseClassDef(data, offset); err != nil {
+			return err
 		}
 	}
-	return nil
-}
-
-func (f *Font) parseGsubSmcp() error {
-	data := f.tables["GSUB"]
-	if len(data) == 0 {
-		return nil // GSUB block is optional
-	}
-	if len(data) < 10 {
-		return errorf("GSUB block is too short (%d bytes)", len(data))
-	}
-	var (
-		scriptTableOffset  = int(u16(data, 4))
-		featureTableOffset = int(u16(data, 6))
-		lookupTableOffset  = int(u16(data, 8))
-	)
-
-	featureIDs, err := f.parseScriptTable(data, scriptTableOffset, "", "")
-	if err != nil {
-		return err
-	}
-
-	lookupIDs, err := f.parseFeatureTable(data, featureTableOffset, featureIDs, "smcp")
-	if err != nil {
-		return nil
-	}
-
-	// parse lookup table
-	if lookupTableOffset+2 > len(data) {
-		return errorf("invalid GSUB lookup table at 0x%x", lookupTableOffset)
-	}
-	lookupCount := int(u16(data, lookupTableOffset))
-	if lookupTableOffset+2+lookupCount*2 > len(data) {
-		return errorf("unexpected end of GSUB lookup table with %d entries", lookupCount)
-	}
-	for _, i := range lookupIDs {
-		offset := int(u16(data, lookupTableOffset+2+i*2)) + lookupTableOffset
-
-		if offset+6 > len(data) {
-			return errorf("unexpected end of GSUB lookup entry at 0x%x", offset)
+	if offset := int(u16(data, 10)); offset != 0 {
+		if f.markAttachClass, err = f.parseClassDef(data, offset); err != nil {
+			return err
 		}
-		kind := int(u16(data, offset))
-		subblockCount := int(u16(data, offset+4))
-		if offset+6+subblockCount*2 > len(data) {
-			return errorf("unexpected end of GSUB lookup entry at 0x%x", offset)
-		}
-		if kind != 1 {
-			return errorf("unsupported GSUB lookup type %d", kind)
-		}
-		for j := 0; j < subblockCount; j++ {
-			subblockOffset := int(u16(data, offset+6+j*2)) + offset
-			if subblockOffset+6 > len(data) {
-				return errorf("unexpected end of GSUB subblock at 0x%x", subblockOffset)
-			}
-			if format := u16(data, subblockOffset); format != 2 {
-				return errorf("unsupported GSUB lookup type 1 format %d", format)
-			}
-			coverageOffset := int(u16(data, subblockOffset+2)) + subblockOffset
-			setCount := int(u16(data, subblockOffset+4))
-
-			// parse coverage
-			coverage, err := f.parseCoverage(data, coverageOffset)
-			if err != nil {
-				return err
-			}
-			if len(coverage) != setCount {
-				return errorf("GSUB coverage length doesn't match set length")
+	}
+	if version := u32(data, 0); version >= 0x00010002 && len(data) >= 14 {
+		if offset := int(u16(data, 12)); offset != 0 {
+			if offset+4 > len(data) {
+				return errorf("unexpected end of GDEF mark glyph sets")
 			}
-			if subblockOffset+6+setCount*2 > len(data) {
-				return errorf("unexpected end of GSUB liga subblock at 0x%x", subblockOffset)
+			count := int(u16(data, offset+2))
+			if offset+4+4*count > len(data) {
+				return errorf("unexpected end of GDEF mark glyph sets")
 			}
-			repl := make([]Index, setCount)
-			for k := 0; k < len(repl); k++ {
-				repl[k] = Index(u16(data, subblockOffset+6+2*k))
+			for i := 0; i < count; i++ {
+				set, err := f.parseCoverage(data, offset+int(u32(data, offset+4+4*i)))
+				if err != nil {
+					return err
+				}
+				f.markSets = append(f.markSets, set)
 			}
-			f.smcpBefore = coverage
-			f.smcpAfter = repl
 		}
 	}
 	return nil
 }
 
-func (f *Font) SmallCaps(glyphs []Index) []Index {
-	if f.smcpBefore == nil {
-		return glyphs
-	}
-	for i := range glyphs {
-		for j := range f.smcpBefore {
-			if f.smcpBefore[j] == glyphs[i] {
-				glyphs[i] = f.smcpAfter[j]
-			}
-		}
-	}
-	return glyphs
-}
-
-func (f *Font) parseCoverage(data []byte, offset int) ([]Index, error) {
+func (f *Font) parseCoverage(data []byte, offset int) (coverage, error) {
 	if offset+4 > len(data) {
 		return nil, errorf("unexpected end of coverage list at 0x%x", offset)
 	}
@@ -418,7 +263,7 @@ func (f *Font) parseCoverage(data []byte, offset int) ([]Index, error) {
 		if offset+4+count*2 > len(data) {
 			return nil, errorf("unexpected end of coverage list at 0x%x", offset)
 		}
-		glyphs := make([]Index, count)
+		glyphs := make(coverage, count)
 		for i := range glyphs {
 			glyphs[i] = Index(u16(data, offset+4+2*i))
 		}
@@ -427,7 +272,7 @@ func (f *Font) parseCoverage(data []byte, offset int) ([]Index, error) {
 		if offset+4+count*6 > len(data) {
 			return nil, errorf("unexpected end of coverage list at 0x%x", offset)
 		}
-		var glyphs []Index
+		var glyphs coverage
 		for i := 0; i < count; i++ {
 			first := Index(u16(data, offset+4+6*i))
 			last := Index(u16(data, offset+4+6*i+2))
@@ -441,282 +286,12 @@ func (f *Font) parseCoverage(data []byte, offset int) ([]Index, error) {
 	}
 }
 
-func (f *Font) parseGpos() error {
-	data := f.tables["GPOS"]
-	if len(data) == 0 {
-		return nil // GPOS block is optional
-	}
-	if len(data) < 10 {
-		return errorf("GPOS block is too short (%d bytes)", len(data))
-	}
-	var (
-		scriptTableOffset  = int(u16(data, 4))
-		featureTableOffset = int(u16(data, 6))
-		lookupTableOffset  = int(u16(data, 8))
-	)
-
-	featureIDs, err := f.parseScriptTable(data, scriptTableOffset, "", "")
-	if err != nil {
-		return err
-	}
-
-	lookupIDs, err := f.parseFeatureTable(data, featureTableOffset, featureIDs, "kern")
-	if err != nil {
-		return err
-	}
-
-	reverse := make([]rune, f.NumGlyphs())
-	for i := 0; i < math.MaxUint16; i++ {
-		reverse[f.Index(rune(i))] = rune(i)
-	}
-
-	for _, i := range lookupIDs {
-		offset := int(u16(data, lookupTableOffset+2+i*2)) + lookupTableOffset
-
-		if offset+6 > len(data) {
-			return errorf("unexpected end of GPOS lookup entry at 0x%x", offset)
-		}
-		kind := int(u16(data, offset))
-		subblockCount := int(u16(data, offset+4))
-		if offset+6+subblockCount*2 > len(data) {
-			return errorf("unexpected end of GPOS lookup entry at 0x%x", offset)
-		}
-		if kind != 2 {
-			return errorf("unsupported GPOS lookup type %d", kind)
-		}
-		for j := 0; j < subblockCount; j++ {
-			subblockOffset := int(u16(data, offset+6+j*2)) + offset
-			if subblockOffset+2 > len(data) {
-				return errorf("unexpected end of GPOS subblock at 0x%x", subblockOffset)
-			}
-			format := u16(data, subblockOffset)
-			if format == 1 {
-				if subblockOffset+10 > len(data) {
-					return errorf("unexpected end of GPOS subblock at 0x%x", subblockOffset)
-				}
-				coverageOffset := int(u16(data, subblockOffset+2)) + subblockOffset
-				format1 := u16(data, subblockOffset+4)
-				format2 := u16(data, subblockOffset+6)
-				pairSetCount := int(u16(data, subblockOffset+8))
-				if format1 != 4 || format2 != 0 {
-					return errorf("unsupported kern format %d %d", format1, format2)
-				}
-				// parse coverage
-				if coverageOffset+4+2*pairSetCount > len(data) {
-					return errorf("unexpected end of GPOS coverage at 0x%x", coverageOffset)
-				}
-				if format := u16(data, coverageOffset); format != 1 {
-					return errorf("unsupported GPOS coverage format %d", format)
-				}
-				if count := int(u16(data, coverageOffset+2)); count != pairSetCount {
-					return errorf("GPOS coverage length doesn't match pair set length")
-				}
-				coverage := make([]Index, pairSetCount)
-				for k := 0; k < len(coverage); k++ {
-					coverage[k] = Index(u16(data, coverageOffset+4+2*k))
-				}
-				// parse pair sets
-				if subblockOffset+10+pairSetCount*2 > len(data) {
-					return errorf("unexpected end of GPOS kern subblock at 0x%x", subblockOffset)
-				}
-				for k := 0; k < pairSetCount; k++ {
-					pairSetOffset := int(u16(data, subblockOffset+10+k*2)) + subblockOffset
-					if pairSetOffset+2 > len(data) {
-						return errorf("unexpected end of GPOS pair set at 0x%x", pairSetOffset)
-					}
-					pairCount := int(u16(data, pairSetOffset))
-					if pairSetOffset+2+4*pairCount > len(data) {
-						return errorf("unexpected end of GPOS pair set at 0x%x", pairSetOffset)
-					}
-					// parse pairs
-					for l := 0; l < pairCount; l++ {
-						secondGlyph := Index(int(u16(data, pairSetOffset+2+4*l)))
-						kern := int(int16(u16(data, pairSetOffset+2+4*l+2)))
-						f.kern = append(f.kern, Kerning{coverage[k], secondGlyph, kern})
-					}
-				}
-			} else if format == 2 {
-				if subblockOffset+16 > len(data) {
-					return errorf("unexpected end of GPOS subblock at 0x%x", subblockOffset)
-				}
-				format1 := u16(data, subblockOffset+4)
-				format2 := u16(data, subblockOffset+6)
-				classOffset1 := int(u16(data, subblockOffset+8)) + subblockOffset
-				classOffset2 := int(u16(data, subblockOffset+10)) + subblockOffset
-				classCount1 := u16(data, subblockOffset+12)
-				classCount2 := u16(data, subblockOffset+14)
-				if format1 != 4 || format2 != 0 {
-					return errorf("unsupported kern format %d %d", format1, format2)
-				}
-				first, err := f.parseKernClassDef(data, classOffset1, classCount1)
-				if err != nil {
-					return err
-				}
-				second, err := f.parseKernClassDef(data, classOffset2, classCount2)
-				if err != nil {
-					return err
-				}
-				if subblockOffset+16+int(classCount1)*int(classCount2)*2 > len(data) {
-					return errorf("unexpected end of GPOS subblock at 0x%x", subblockOffset)
-				}
-				table := make([]int, classCount1*classCount2)
-				for k := 0; k < len(table); k++ {
-					table[k] = int(int16(u16(data, subblockOffset+16+k*2)))
-				}
-				f.classKern = &classKerner{
-					classA: first,
-					classB: second,
-					table:  table,
-					countA: int(classCount1),
-					countB: int(classCount2),
-				}
-			}
-		}
-	}
-	return nil
-}
-
-func (f *Font) parseKernClassDef(data []byte, offset int, classCount uint16) ([]uint16, error) {
-	if offset+4 > len(data) {
-		return nil, errorf("unexpected end of class definition")
-	}
-	if format := u16(data, offset); format != 2 {
-		return nil, errorf("unsupported class definition format %d", format)
-	}
-	count := int(u16(data, offset+2))
-	if offset+4+count*6 > len(data) {
-		return nil, errorf("unexpected end of class definition")
-	}
-	classes := make([]uint16, f.nGlyph)
-	for k := 0; k < count; k++ {
-		start := Index(u16(data, offset+4+k*6))
-		end := Index(u16(data, offset+4+k*6+2))
-		class := u16(data, offset+4+k*6+4)
-		if end >= Index(len(classes)) {
-			return nil, errorf("invalid glyph range %d %d", start, end)
-		}
-		if class >= classCount {
-			return nil, errorf("invalid class number %d", class)
-		}
-		for l := start; l <= end; l++ {
-			classes[l] = class
-		}
-	}
-	return classes, nil
-}
-
-func (f *Font) parseScriptTable(data []byte, scriptTableOffset int, script string, lang string) ([]int, error) {
-	// parse script list and locate the default script table
-	if scriptTableOffset+2 > len(data) {
-		return nil, errorf("unexpected end of GSUB script table")
-	}
-	scriptsCount := int(u16(data, scriptTableOffset))
-	if scriptTableOffset+2+scriptsCount*6 > len(data) {
-		return nil, errorf("unexpected end of GSUB script list with %d entries", scriptsCount)
-	}
-	scriptOffset := 0
-	for i := 0; i < scriptsCount; i++ {
-		x := scriptTableOffset + 2 + i*6
-		if scriptTag := string(data[x : x+4]); scriptTag == "DFLT" {
-			scriptOffset = int(u16(data, x+4))
-		} else if scriptTag == script {
-			scriptOffset = int(u16(data, x+4))
-			break
-		}
-	}
-	if scriptOffset <= 0 {
-		return nil, errorf("no suitable script table not found")
-	}
-	scriptOffset += scriptTableOffset
-
-	// parse script table and locate the default language/system table
-	if scriptOffset+4 > len(data) {
-		return nil, errorf("invalid script offset")
-	}
-	langSysOffset := int(u16(data, scriptOffset))
-	langSysCount := int(u16(data, scriptOffset+2))
-	if scriptOffset+4+6*langSysCount > len(data) {
-		return nil, errorf("unexpected end of script table with %d entries", langSysCount)
-	}
-	for i := 0; i < langSysCount; i++ {
-		x := scriptOffset + 4 + 6*i
-		langID := string(data[x : x+4])
-		if langID == lang {
-			langSysOffset = int(u16(data, x+4))
-			break
-		} else if langID == "dflt" {
-			langSysOffset = int(u16(data, x+4))
-		}
-	}
-	if langSysOffset <= 0 {
-		return nil, errorf("no suitable language/system table found")
-	}
-	langSysOffset += scriptOffset
-
-	// parse language/system table to get all features
-	var featureIDs []int
-	if langSysOffset+6 > len(data) {
-		return nil, errorf("invalid langSysOffset 0x%x", langSysOffset)
-	}
-	if required := u16(data, langSysOffset+2); required != math.MaxUint16 {
-		featureIDs = append(featureIDs, int(required))
-	}
-	featureTableCount := int(u16(data, langSysOffset+4))
-	if langSysOffset+6+featureTableCount*2 > len(data) {
-		return nil, errorf("unexpected end of lang/sys table with %d entries", featureTableCount)
-	}
-	for i := 0; i < featureTableCount; i++ {
-		featureIDs = append(featureIDs, int(u16(data, langSysOffset+6+i*2)))
-	}
-
-	return featureIDs, nil
-}
-
-func (f *Font) parseFeatureTable(data []byte, featureTableOffset int, featureIDs []int, feature string) ([]int, error) {
-	// parse feature table
-	if featureTableOffset+2 > len(data) {
-		return nil, errorf("invalid feature table at 0x%x", featureTableOffset)
-	}
-	featureCount := int(u16(data, featureTableOffset))
-	if featureTableOffset+2+featureCount*6 > len(data) {
-		return nil, errorf("unexpected end of feature table with %d entries", featureCount)
-	}
-	lookupOffset := -1
-	for _, id := range featureIDs {
-		if id >= featureCount {
-			return nil, errorf("can not find feature %d in GSUB feature table", id)
-		}
-		x := featureTableOffset + 2 + id*6
-		if name := string(data[x : x+4]); name == feature {
-			lookupOffset = int(u16(data, x+4))
-		}
-	}
-	if lookupOffset < 0 {
-		return nil, errorf("feature %q not found", feature)
-	}
-	lookupOffset += featureTableOffset
-
-	// parse lookup list
-	if lookupOffset+4 > len(data) {
-		return nil, errorf("invalid lookup list at 0x%x", lookupOffset)
-	}
-	lookupListCount := int(u16(data, lookupOffset+2))
-	if lookupOffset+4+2*lookupListCount > len(data) {
-		return nil, errorf("unexpected end of lookup list at 0x%x", lookupOffset)
-	}
-	lookupIDs := make([]int, lookupListCount)
-	for i := 0; i < len(lookupIDs); i++ {
-		lookupIDs[i] = int(u16(data, lookupOffset+4+2*i))
-	}
-	return lookupIDs, nil
-}
-
 func (f *Font) parseCmap(cmap []byte) error {
 	const (
-		cmapFormat4         = 4
-		languageIndependent = 0
-
-		unicodeEncoding         = 0x00000003 // PID = 0 (Unicode), PSID = 3 (Unicode 2.0)
+		unicodeBMPEncoding      = 0x00000003 // PID = 0 (Unicode), PSID = 3 (Unicode 2.0, BMP only)
+		unicodeFullEncoding     = 0x00000004 // PID = 0 (Unicode), PSID = 4 (Unicode 2.0, full repertoire)
+		unicodeFullEncoding13   = 0x00000006 // PID = 0 (Unicode), PSID = 6 (Unicode full repertoire, format 13)
+		macintoshRomanEncoding  = 0x00010000 // PID = 1 (Macintosh), PSID = 0 (Roman)
 		microsoftSymbolEncoding = 0x00030000 // PID = 3 (Microsoft), PSID = 0 (Symbol)
 		microsoftUCS2Encoding   = 0x00030001 // PID = 3 (Microsoft), PSID = 1 (UCS-2)
 		microsoftUCS4Encoding   = 0x0003000a // PID = 3 (Microsoft), PSID = 10 (UCS-4)
@@ -728,67 +303,231 @@ func (f *Font) parseCmap(cmap []byte) error {
 	if len(cmap) < 8*nsubtab+4 {
 		return FontError("cmap too short")
 	}
-	offset, found, x := 0, false, 4
-	for i := 0; i < nsubtab; i++ {
-		// We read the 16-bit Platform ID and 16-bit Platform Specific ID as a single uint32.
-		// All values are big-endian.
-		pidPsid, o := u32(cmap, x), u32(cmap, x+4)
-		x += 8
-		// We prefer the Unicode cmap encoding. Failing to find that, we fall
-		// back onto the Microsoft cmap encoding.
-		if pidPsid == unicodeEncoding {
-			offset, found = int(o), true
-			break
-		} else if pidPsid == microsoftSymbolEncoding ||
-			pidPsid == microsoftUCS2Encoding ||
-			pidPsid == microsoftUCS4Encoding {
-
-			offset, found = int(o), true
-			// We don't break out of the for loop, so that Unicode can override Microsoft.
+	// We prefer subtables which cover the full Unicode range, followed by
+	// the Unicode BMP and Microsoft UCS-2 encodings. Symbol and Macintosh
+	// encodings are only used as a last resort.
+	priority := func(pidPsid uint32) int {
+		switch pidPsid {
+		case microsoftUCS4Encoding, unicodeFullEncoding, unicodeFullEncoding13:
+			return 6
+		case unicodeBMPEncoding:
+			return 5
+		case microsoftUCS2Encoding:
+			return 4
+		case 0x00000000, 0x00000001, 0x00000002: // older Unicode versions
+			return 3
+		case microsoftSymbolEncoding:
+			return 2
+		case macintoshRomanEncoding:
+			return 1
 		}
+		return 0
 	}
-	if !found {
-		return FontError("unsupported cmap encoding")
+	var lastErr error = FontError("unsupported cmap encoding")
+	for best := 6; best > 0; best-- {
+		for i := 0; i < nsubtab; i++ {
+			// We read the 16-bit Platform ID and 16-bit Platform Specific ID as a single uint32.
+			// All values are big-endian.
+			x := 4 + 8*i
+			pidPsid, offset := u32(cmap, x), int(u32(cmap, x+4))
+			if priority(pidPsid) != best {
+				continue
+			}
+			if offset <= 0 || offset+4 > len(cmap) {
+				return FontError("bad cmap offset")
+			}
+			cm, err := parseCmapSubtable(cmap[offset:], pidPsid == macintoshRomanEncoding)
+			if err != nil {
+				// try the next subtable, there might be one with a supported format
+				lastErr = err
+				continue
+			}
+			if pidPsid == macintoshRomanEncoding {
+				cm = fromMacRoman(cm)
+			}
+			f.cm = cm
+			f.symbol = pidPsid == microsoftSymbolEncoding
+			return nil
+		}
 	}
-	if offset <= 0 || offset > len(cmap) {
-		return FontError("bad cmap offset")
+	return lastErr
+}
+
+// parseCmapSubtable parses a single cmap subtable in one of the formats
+// 0, 4, 6, 12 and 13.
+func parseCmapSubtable(data []byte, mac bool) ([]cm, error) {
+	const (
+		cmapFormat0  = 0
+		cmapFormat4  = 4
+		cmapFormat6  = 6
+		cmapFormat12 = 12
+		cmapFormat13 = 13
+
+		languageIndependent = 0
+	)
+	checkLanguage := func(language uint32) error {
+		if language != languageIndependent && !mac {
+			return FontError(fmt.Sprintf("unsupported language: %d", language))
+		}
+		return nil
 	}
 
-	cmapFormat := u16(cmap, offset)
+	cmapFormat := u16(data, 0)
 	switch cmapFormat {
+	case cmapFormat0:
+		if len(data) < 6+256 {
+			return nil, FontError("cmap format 0 too short")
+		}
+		if err := checkLanguage(uint32(u16(data, 4))); err != nil {
+			return nil, err
+		}
+		glyphs := make([]Index, 256)
+		for i := range glyphs {
+			glyphs[i] = Index(data[6+i])
+		}
+		return []cm{{start: 0, end: 255, glyphs: glyphs}}, nil
+
 	case cmapFormat4:
-		language := u16(cmap, offset+4)
-		if language != languageIndependent {
-			return FontError(fmt.Sprintf("unsupported language: %d", language))
+		if len(data) < 14 {
+			return nil, FontError("cmap format 4 too short")
+		}
+		if err := checkLanguage(uint32(u16(data, 4))); err != nil {
+			return nil, err
 		}
-		segCountX2 := int(u16(cmap, offset+6))
+		segCountX2 := int(u16(data, 6))
 		if segCountX2%2 == 1 {
-			return FontError(fmt.Sprintf("bad segCountX2: %d", segCountX2))
+			return nil, FontError(fmt.Sprintf("bad segCountX2: %d", segCountX2))
 		}
 		segCount := segCountX2 / 2
-		offset += 14
-		f.cm = make([]cm, segCount)
-		for i := 0; i < segCount; i++ {
-			f.cm[i].end = uint32(u16(cmap, offset))
-			offset += 2
+		var (
+			endCodes      = 14
+			startCodes    = endCodes + segCountX2 + 2
+			idDeltas      = startCodes + segCountX2
+			idRangeOffset = idDeltas + segCountX2
+		)
+		if idRangeOffset+segCountX2 > len(data) {
+			return nil, FontError("cmap format 4 too short")
+		}
+		segments := make([]cm, segCount)
+		for i := range segments {
+			s := &segments[i]
+			s.end = uint32(u16(data, endCodes+2*i))
+			s.start = uint32(u16(data, startCodes+2*i))
+			delta := u16(data, idDeltas+2*i)
+			if s.start > s.end {
+				return nil, FontError(fmt.Sprintf("bad cmap segment %d", i))
+			}
+			rangeOffset := int(u16(data, idRangeOffset+2*i))
+			if rangeOffset == 0 {
+				s.delta = uint32(delta)
+				continue
+			}
+			// resolve the glyph indexes of this segment right away
+			base := idRangeOffset + 2*i + rangeOffset
+			s.glyphs = make([]Index, s.end-s.start+1)
+			for c := range s.glyphs {
+				if base+2*c+2 > len(data) {
+					return nil, FontError("bad cmap glyph index offset")
+				}
+				if g := u16(data, base+2*c); g != 0 {
+					s.glyphs[c] = Index(g + delta)
+				}
+			}
 		}
-		offset += 2
-		for i := 0; i < segCount; i++ {
-			f.cm[i].start = uint32(u16(cmap, offset))
-			offset += 2
+		return segments, nil
+
+	case cmapFormat6:
+		if len(data) < 10 {
+			return nil, FontError("cmap format 6 too short")
+		}
+		if err := checkLanguage(uint32(u16(data, 4))); err != nil {
+			return nil, err
 		}
-		for i := 0; i < segCount; i++ {
-			f.cm[i].delta = uint32(u16(cmap, offset))
-			offset += 2
+		first := uint32(u16(data, 6))
+		count := int(u16(data, 8))
+		if count == 0 {
+			return nil, nil
 		}
-		for i := 0; i < segCount; i++ {
-			f.cm[i].offset = uint32(u16(cmap, offset))
-			offset += 2
+		if 10+2*count > len(data) {
+			return nil, FontError("cmap format 6 too short")
+		}
+		glyphs := make([]Index, count)
+		for i := range glyphs {
+			glyphs[i] = Index(u16(data, 10+2*i))
+		}
+		return []cm{{start: first, end: first + uint32(count) - 1, glyphs: glyphs}}, nil
+
+	case cmapFormat12, cmapFormat13:
+		if len(data) < 16 {
+			return nil, FontError(fmt.Sprintf("cmap format %d too short", cmapFormat))
+		}
+		if err := checkLanguage(u32(data, 8)); err != nil {
+			return nil, err
+		}
+		count := int(u32(data, 12))
+		if count < 0 || count > (len(data)-16)/12 {
+			return nil, FontError(fmt.Sprintf("cmap format %d too short", cmapFormat))
+		}
+		segments := make([]cm, count)
+		for i := range segments {
+			s := &segments[i]
+			s.start = u32(data, 16+12*i)
+			s.end = u32(data, 16+12*i+4)
+			s.delta = u32(data, 16+12*i+8)
+			if s.start > s.end || (i > 0 && s.start <= segments[i-1].end) {
+				return nil, FontError(fmt.Sprintf("bad cmap group %d", i))
+			}
+			if cmapFormat == cmapFormat12 {
+				s.delta -= s.start
+			} else {
+				s.constant = true
+			}
+		}
+		return segments, nil
+	}
+	return nil, FontError(fmt.Sprintf("unsupported cmap format: %d", cmapFormat))
+}
+
+// fromMacRoman converts the character codes of a cmap subtable with the
+// Macintosh Roman encoding to Unicode.
+func fromMacRoman(segments []cm) []cm {
+	ascii := make([]Index, 0x80)
+	result := []cm{{start: 0, end: 0x7f, glyphs: ascii}}
+	for i := range segments {
+		s := &segments[i]
+		for c := s.start; c <= s.end && c <= 0xff; c++ {
+			g := s.lookup(c)
+			if c < 0x80 {
+				ascii[c] = g
+			} else if g != 0 {
+				r := uint32(macRoman[c-0x80])
+				result = append(result, cm{start: r, end: r, glyphs: []Index{g}})
+			}
 		}
-		f.cmapIndexes = cmap[offset:]
-		return nil
 	}
-	return FontError(fmt.Sprintf("unsupported cmap format: %d", cmapFormat))
+	sort.Slice(result, func(i, j int) bool { return result[i].start < result[j].start })
+	return result
+}
+
+// macRoman maps the codes 0x80 to 0xff of the Macintosh Roman encoding to
+// Unicode.
+var macRoman = [128]rune{
+	0x00C4, 0x00C5, 0x00C7, 0x00C9, 0x00D1, 0x00D6, 0x00DC, 0x00E1,
+	0x00E0, 0x00E2, 0x00E4, 0x00E3, 0x00E5, 0x00E7, 0x00E9, 0x00E8,
+	0x00EA, 0x00EB, 0x00ED, 0x00EC, 0x00EE, 0x00EF, 0x00F1, 0x00F3,
+	0x00F2, 0x00F4, 0x00F6, 0x00F5, 0x00FA, 0x00F9, 0x00FB, 0x00FC,
+	0x2020, 0x00B0, 0x00A2, 0x00A3, 0x00A7, 0x2022, 0x00B6, 0x00DF,
+	0x00AE, 0x00A9, 0x2122, 0x00B4, 0x00A8, 0x2260, 0x00C6, 0x00D8,
+	0x221E, 0x00B1, 0x2264, 0x2265, 0x00A5, 0x00B5, 0x2202, 0x2211,
+	0x220F, 0x03C0, 0x222B, 0x00AA, 0x00BA, 0x03A9, 0x00E6, 0x00F8,
+	0x00BF, 0x00A1, 0x00AC, 0x221A, 0x0192, 0x2248, 0x2206, 0x00AB,
+	0x00BB, 0x2026, 0x00A0, 0x00C0, 0x00C3, 0x00D5, 0x0152, 0x0153,
+	0x2013, 0x2014, 0x201C, 0x201D, 0x2018, 0x2019, 0x00F7, 0x25CA,
+	0x00FF, 0x0178, 0x2044, 0x20AC, 0x2039, 0x203A, 0xFB01, 0xFB02,
+	0x2021, 0x00B7, 0x201A, 0x201E, 0x2030, 0x00C2, 0x00CA, 0x00C1,
+	0x00CB, 0x00C8, 0x00CD, 0x00CE, 0x00CF, 0x00CC, 0x00D3, 0x00D4,
+	0xF8FF, 0x00D2, 0x00DA, 0x00DB, 0x00D9, 0x0131, 0x02C6, 0x02DC,
+	0x00AF, 0x02D8, 0x02D9, 0x02DA, 0x00B8, 0x02DD, 0x02DB, 0x02C7,
 }
 
 func (f *Font) parseHhea(hhea []byte) error {
@@ -835,20 +574,6 @@ func (f *Font) Scale(value, scale int) int {
 	return (value * scale) / f.UnitsPerEm
 }
 
-// Kerning returns the kerning for the given glyph pair.
-func (f *Font) Kerning(scale int, a, b Index) int {
-	kern := 0
-	for i := 0; i < len(f.kern); i++ {
-		if f.kern[i].First == a && f.kern[i].Second == b {
-			kern += f.kern[i].Horiz
-		}
-	}
-	if f.classKern != nil {
-		kern += f.classKern.Kern(a, b)
-	}
-	return f.Scale(kern, scale)
-}
-
 func (f *Font) NumGlyphs() int {
 	return f.nGlyph
 }
@@ -898,7 +623,18 @@ func (f *Font) parseOS2() error {
 
 // Index returns a Font's index for the given rune.
 func (f *Font) Index(x rune) Index {
-	c := uint32(x)
+	if g := f.lookupCmap(uint32(x)); g != 0 || !f.symbol {
+		return g
+	}
+	// Symbol fonts usually map their characters into the private use area
+	// starting at U+F000 instead of using the Latin-1 code points.
+	if x >= 0 && x <= 0xff {
+		return f.lookupCmap(0xf000 + uint32(x))
+	}
+	return 0
+}
+
+func (f *Font) lookupCmap(c uint32) Index {
 	for i, j := 0, len(f.cm); i < j; {
 		h := i + (j-i)/2
 		cm := &f.cm[h]
@@ -906,43 +642,30 @@ func (f *Font) Index(x rune) Index {
 			j = h
 		} else if cm.end < c {
 			i = h + 1
-		} else if cm.offset == 0 {
-			return Index(c + cm.delta)
 		} else {
-			offset := int(cm.offset) + 2*(h-len(f.cm)+int(c-cm.start))
-			return Index(u16(f.cmapIndexes, offset))
+			return cm.lookup(c)
 		}
 	}
 	return 0
 }
 
-func (f *Font) Ligatures(glyphs []Index) []Index {
-	if len(f.liga) == 0 {
-		return glyphs
-	}
-	for i := 0; i < len(glyphs); i++ {
-		for _, liga := range f.liga {
-			if i+len(liga.Old) > len(glyphs) {
-				continue
-			}
-			found := true
-			for k := 0; k < len(liga.Old); k++ {
-				if liga.Old[k] != glyphs[i+k] {
-					found = false
-					break
-				}
-			}
-			if !found {
-				continue
+// Runes returns the lowest rune which is mapped to each glyph. Glyphs that
+// can not be reached by any rune are mapped to zero.
+func (f *Font) Runes() []rune {
+	runes := make([]rune, f.nGlyph)
+	for i := range f.cm {
+		cm := &f.cm[i]
+		for c := cm.start; c <= cm.end && c <= unicode.MaxRune; c++ {
+			if g := cm.lookup(c); g != 0 && int(g) < len(runes) && runes[g] == 0 {
+				runes[g] = rune(c)
 			}
-			glyphs[i] = liga.New
-			glyphs = append(glyphs[:i+1], glyphs[i+len(liga.Old):]...)
-			break
 		}
 	}
-	return glyphs
+	return runes
 }
 
+// StringToGlyphs maps every rune of the text to a glyph. Text in complex
+// scripts should be converted with package shape instead.
 func (f *Font) StringToGlyphs(text string) []Index {
 	var glyphs []Index
 	for _, r := range text {
@@ -951,29 +674,6 @@ func (f *Font) StringToGlyphs(text string) []Index {
 	return glyphs
 }
 
-func (f *Font) Index2(x rune) Index {
-	c := uint32(x)
-	seg := -1
-	for i := 0; i < len(f.cm); i++ {
-		if f.cm[i].end >= c {
-			seg = i
-			break
-		}
-	}
-	if seg < 0 || f.cm[seg].start > c {
-		return 0
-	}
-	rval := rune(c)
-	if f.cm[seg].offset != 0 {
-		offset := int(f.cm[seg].offset) + 2*(seg+int(c-f.cm[seg].start))
-		rval = rune(u16(f.cmapIndexes, offset))
-	}
-	if f.cm[seg].delta != 0 {
-		rval = (rval + rune(f.cm[seg].delta)) % 0x10000
-	}
-	return Index(rval)
-}
-
 // An Index is a Font's index of a rune.
 type Index uint16
 
@@ -982,39 +682,29 @@ type HMetric struct {
 	Width, Left int
 }
 
-// A cm holds a parsed cmap entry.
+// A cm holds a parsed cmap entry. The runes in the range [start, end] are
+// either mapped by an explicit list of glyphs, by adding delta to the rune
+// or, for constant ranges, all to the glyph delta.
 type cm struct {
-	start, end, delta, offset uint32
-}
-
-type Ligature struct {
-	Old []Index
-	New Index
+	start, end uint32
+	delta      uint32
+	constant   bool
+	glyphs     []Index
 }
 
-type Kerner interface {
-	Kern(a, b Index) int
-}
-
-type classKerner struct {
-	classA []uint16
-	classB []uint16
-	table  []int
-	countA int
-	countB int
-}
-
-func (c *classKerner) Kern(a, b Index) int {
-	if int(a) >= len(c.classA) || int(b) >= len(c.classB) {
-		return 0
+func (cm *cm) lookup(c uint32) Index {
+	switch {
+	case cm.glyphs != nil:
+		return cm.glyphs[c-cm.start]
+	case cm.constant:
+		return Index(cm.delta)
 	}
-	return c.table[int(c.classA[a])+int(c.classB[b])*c.countA]
+	return Index(c + cm.delta)
 }
 
-type Kerning struct {
-	First  Index
-	Second Index
-	Horiz  int
+type Ligature struct {
+	Old []Index
+	New Index
 }
 
 // FontError is used to report various errors about invalid TTF and OTF files.
@@ -0,0 +1,86 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+import "testing"
+
+func TestCmapMacRoman(t *testing.T) {
+	cmap := []byte{
+		0, 0, 0, 1, // version and number of subtables
+		0, 1, 0, 0, 0, 0, 0, 12, // Macintosh Roman at offset 12
+		0, 0, 1, 6, 0, 0, // format 0, length and language
+	}
+	glyphs := make([]byte, 256)
+	glyphs['A'] = 1
+	glyphs[0x8a] = 2 // ä
+	glyphs[0xd2] = 3 // “
+	cmap = append(cmap, glyphs...)
+
+	f := &Font{nGlyph: 4}
+	if err := f.parseCmap(cmap); err != nil {
+		t.Fatal(err)
+	}
+	for r, want := range map[rune]Index{'A': 1, 'ä': 2, '“': 3, 0x8a: 0, 0xd2: 0, 'B': 0} {
+		if g := f.Index(r); g != want {
+			t.Errorf("Index(%q) = %d, want %d", r, g, want)
+		}
+	}
+}
+
+// cmapWith returns a cmap table with the given subtables, which are
+// preceded by their platform and encoding IDs.
+func cmapWith(subtables ...[]byte) []byte {
+	cmap := []byte{0, 0, 0, byte(len(subtables))}
+	offset := 4 + 8*len(subtables)
+	for _, sub := range subtables {
+		cmap = append(cmap, sub[:4]...)
+		cmap = append(cmap, 0, 0, byte(offset>>8), byte(offset))
+		offset += len(sub) - 4
+	}
+	for _, sub := range subtables {
+		cmap = append(cmap, sub[4:]...)
+	}
+	return cmap
+}
+
+func TestCmapFormats(t *testing.T) {
+	var (
+		format6 = []byte{0, 3, 0, 1, // Microsoft UCS-2
+			0, 6, 0, 0, 0, 0, 0, 0x41, 0, 3, 0, 1, 0, 2, 0, 3}
+		format12 = []byte{0, 3, 0, 10, // Microsoft UCS-4
+			0, 12, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2,
+			0, 1, 0xf6, 0, 0, 1, 0xf6, 2, 0, 0, 0, 5,
+			0, 2, 0, 0, 0, 2, 0, 0, 0, 0, 0, 9}
+		format13 = []byte{0, 0, 0, 6, // Unicode full repertoire
+			0, 13, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1,
+			0, 1, 0xf6, 0, 0, 1, 0xf6, 0x0f, 0, 0, 0, 7}
+		format2 = []byte{0, 0, 0, 4, // Unicode full repertoire
+			0, 2, 0, 0, 0, 0}
+	)
+	tests := []struct {
+		cmap  []byte
+		index map[rune]Index
+	}{
+		{cmapWith(format6), map[rune]Index{'A': 1, 'C': 3, '@': 0, 'D': 0}},
+		{cmapWith(format12), map[rune]Index{0x1f600: 5, 0x1f602: 7, 0x1f603: 0, 0x20000: 9}},
+		{cmapWith(format13), map[rune]Index{0x1f600: 7, 0x1f60f: 7, 0x1f610: 0}},
+		{cmapWith(format6, format12), map[rune]Index{'A': 0, 0x1f601: 6}},
+		{cmapWith(format2, format6), map[rune]Index{'B': 2, 0x1f601: 0}},
+	}
+	for i, test := range tests {
+		f := &Font{nGlyph: 10}
+		if err := f.parseCmap(test.cmap); err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		for r, want := range test.index {
+			if g := f.Index(r); g != want {
+				t.Errorf("%d: Index(%U) = %d, want %d", i, r, g, want)
+			}
+		}
+	}
+	if err := (&Font{}).parseCmap(cmapWith(format2)); err == nil {
+		t.Error("expected an error for an unsupported cmap format")
+	}
+}
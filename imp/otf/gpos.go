@@ -0,0 +1,469 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+// GPOS lookup types.
+const (
+	gposSingle          = 1
+	gposPair            = 2
+	gposCursive         = 3
+	gposMarkToBase      = 4
+	gposMarkToLigature  = 5
+	gposMarkToMark      = 6
+	gposContext         = 7
+	gposChainingContext = 8
+	gposExtension       = 9
+)
+
+// A Glyph is a positioned glyph. All values are given in font units.
+type Glyph struct {
+	Index    Index
+	Cluster  int // index of the (first) input character of this glyph
+	XOffset  int // horizontal displacement of the glyph
+	YOffset  int // vertical displacement of the glyph
+	XAdvance int // horizontal advance, including kerning
+	YAdvance int // vertical advance
+}
+
+// Shape converts a string into a list of positioned glyphs using the
+// default script and language system. See Context.Shape.
+func (f *Font) Shape(text string, features ...string) []Glyph {
+	return f.Context("", "").Shape(text, features...)
+}
+
+// Position applies the GPOS lookups of the given features using the default
+// script and language system. See Context.Position.
+func (f *Font) Position(glyphs []Index, features ...string) []Glyph {
+	return f.Context("", "").Position(glyphs, features...)
+}
+
+func (f *Font) position(buf *glyphBuffer, ls *langSys, features []Feature, rtl bool) {
+	buf.initPositions(f)
+	c := &applyContext{f: f, buf: buf, lookups: f.gpos.lookups, rtl: rtl}
+	for _, lv := range f.gpos.selectLookups(ls, features) {
+		c.value, c.mask = lv.value, lv.mask
+		c.applyLookup(lv.index)
+	}
+}
+
+// Kerning returns the kerning for the given glyph pair, scaled to the
+// given number of units per em.
+//
+// Deprecated: Kerning only applies the kern feature to a single pair. Use
+// Position or Context.Position instead.
+func (f *Font) Kerning(scale int, a, b Index) int {
+	glyphs := f.Position([]Index{a, b}, "kern")
+	return f.Scale(glyphs[0].XAdvance-f.HMetric(a).Width, scale)
+}
+
+func (f *Font) parseGpos() error {
+	data := f.tables["GPOS"]
+	if len(data) == 0 {
+		return nil // GPOS block is optional
+	}
+	gpos, err := f.parseLayout("GPOS", data, f.parseGposSubtable)
+	if err != nil {
+		return err
+	}
+	f.gpos = gpos
+	return nil
+}
+
+func (f *Font) parseGposSubtable(data []byte, offset, kind int) (subtable, int, error) {
+	if offset+4 > len(data) {
+		return nil, kind, errorf("unexpected end of GPOS subblock at 0x%x", offset)
+	}
+	format := int(u16(data, offset))
+	r := &reader{data: data, pos: offset + 2}
+
+	var (
+		s   subtable
+		err error
+	)
+	switch {
+	case kind == gposSingle && (format == 1 || format == 2):
+		sub := &singlePos{}
+		if sub.coverage, err = f.parseCoverage(data, offset+r.u16()); err != nil {
+			return nil, kind, err
+		}
+		valueFormat := r.u16()
+		if format == 1 {
+			sub.values = []valueRecord{r.valueRecord(valueFormat)}
+		} else {
+			for n := r.u16(); n > 0 && r.err == nil; n-- {
+				sub.values = append(sub.values, r.valueRecord(valueFormat))
+			}
+		}
+		s = sub
+	case kind == gposPair && format == 1:
+		sub := &pairPos{}
+		if sub.coverage, err = f.parseCoverage(data, offset+r.u16()); err != nil {
+			return nil, kind, err
+		}
+		valueFormat1, valueFormat2 := r.u16(), r.u16()
+		sub.skipSecond = valueFormat2 != 0
+		for _, x := range r.offsets(r.u16(), offset) {
+			r2 := &reader{data: data, pos: x}
+			var set []pairValue
+			for n := r2.u16(); n > 0 && r2.err == nil; n-- {
+				set = append(set, pairValue{
+					second: Index(r2.u16()),
+					value1: r2.valueRecord(valueFormat1),
+					value2: r2.valueRecord(valueFormat2),
+				})
+			}
+			if r2.err != nil {
+				return nil, kind, r2.err
+			}
+			sub.sets = append(sub.sets, set)
+		}
+		s = sub
+	case kind == gposPair && format == 2:
+		sub := &pairPos{}
+		if sub.coverage, err = f.parseCoverage(data, offset+r.u16()); err != nil {
+			return nil, kind, err
+		}
+		valueFormat1, valueFormat2 := r.u16(), r.u16()
+		sub.skipSecond = valueFormat2 != 0
+		classOffset1, classOffset2 := r.u16(), r.u16()
+		class1Count, class2Count := r.u16(), r.u16()
+		if r.err != nil {
+			return nil, kind, r.err
+		}
+		if sub.class1, err = f.parseClassDef(data, offset+classOffset1); err != nil {
+			return nil, kind, err
+		}
+		if sub.class2, err = f.parseClassDef(data, offset+classOffset2); err != nil {
+			return nil, kind, err
+		}
+		sub.class2Count = class2Count
+		sub.classValues = make([]pairValue, 0, class1Count*class2Count)
+		for n := class1Count * class2Count; n > 0 && r.err == nil; n-- {
+			sub.classValues = append(sub.classValues, pairValue{
+				value1: r.valueRecord(valueFormat1),
+				value2: r.valueRecord(valueFormat2),
+			})
+		}
+		s = sub
+	case kind == gposCursive && format == 1:
+		sub := &cursivePos{}
+		if sub.coverage, err = f.parseCoverage(data, offset+r.u16()); err != nil {
+			return nil, kind, err
+		}
+		for n := r.u16(); n > 0 && r.err == nil; n-- {
+			sub.entry = append(sub.entry, r.anchor(offset))
+			sub.exit = append(sub.exit, r.anchor(offset))
+		}
+		s = sub
+	case (kind == gposMarkToBase || kind == gposMarkToLigature || kind == gposMarkToMark) && format == 1:
+		sub := &markPos{kind: kind}
+		if sub.marks, err = f.parseCoverage(data, offset+r.u16()); err != nil {
+			return nil, kind, err
+		}
+		if sub.bases, err = f.parseCoverage(data, offset+r.u16()); err != nil {
+			return nil, kind, err
+		}
+		classCount := r.u16()
+		markArray, baseArray := offset+r.u16(), offset+r.u16()
+		if r.err != nil {
+			return nil, kind, r.err
+		}
+
+		r = &reader{data: data, pos: markArray}
+		for n := r.u16(); n > 0 && r.err == nil; n-- {
+			sub.markRecords = append(sub.markRecords, markRecord{
+				class:  r.u16(),
+				anchor: r.anchor(markArray),
+			})
+		}
+		if r.err != nil {
+			return nil, kind, r.err
+		}
+
+		// readAnchors reads a matrix of anchors with classCount columns.
+		readAnchors := func(r *reader, base int) [][]*anchor {
+			var rows [][]*anchor
+			for n := r.u16(); n > 0 && r.err == nil; n-- {
+				row := make([]*anchor, classCount)
+				for k := range row {
+					row[k] = r.anchor(base)
+				}
+				rows = append(rows, row)
+			}
+			return rows
+		}
+		r = &reader{data: data, pos: baseArray}
+		if kind == gposMarkToLigature {
+			for _, x := range r.offsets(r.u16(), baseArray) {
+				r2 := &reader{data: data, pos: x}
+				sub.ligatures = append(sub.ligatures, readAnchors(r2, x))
+				if r2.err != nil {
+					return nil, kind, r2.err
+				}
+			}
+		} else {
+			sub.baseAnchors = readAnchors(r, baseArray)
+		}
+		s = sub
+	case kind == gposContext || kind == gposChainingContext:
+		ctx, err := f.parseContext(data, offset, kind == gposChainingContext)
+		if err != nil {
+			return nil, kind, err
+		}
+		s = ctx
+	case kind == gposExtension && format == 1:
+		extKind := r.u16()
+		extOffset := r.u32()
+		if r.err != nil || extKind == gposExtension {
+			return nil, kind, errorf("invalid GPOS extension subtable at 0x%x", offset)
+		}
+		return f.parseGposSubtable(data, offset+extOffset, extKind)
+	default:
+		return nil, kind, unsupportedf("unsupported GPOS lookup type %d format %d", kind, format)
+	}
+	if r.err != nil {
+		return nil, kind, r.err
+	}
+	return s, kind, nil
+}
+
+// A valueRecord holds the adjustments of a glyph's position and advance.
+type valueRecord struct {
+	xPlacement, yPlacement int
+	xAdvance, yAdvance     int
+}
+
+// valueRecord reads a value record of the given format. Device tables are
+// skipped, since they are only used for hinting at small pixel sizes.
+func (r *reader) valueRecord(format int) valueRecord {
+	var v valueRecord
+	fields := []*int{&v.xPlacement, &v.yPlacement, &v.xAdvance, &v.yAdvance}
+	for bit := uint(0); bit < 8; bit++ {
+		if format&(1<<bit) == 0 {
+			continue
+		}
+		if value := r.i16(); bit < 4 {
+			*fields[bit] = value
+		}
+	}
+	return v
+}
+
+func (v valueRecord) applyTo(p *Glyph) {
+	p.XOffset += v.xPlacement
+	p.YOffset += v.yPlacement
+	p.XAdvance += v.xAdvance
+	p.YAdvance += v.yAdvance
+}
+
+// An anchor is an attachment point of a glyph.
+type anchor struct {
+	x, y int
+}
+
+// anchor reads the offset of an anchor table relative to base and parses
+// the anchor. Null offsets result in a nil anchor.
+func (r *reader) anchor(base int) *anchor {
+	offset := r.u16()
+	if offset == 0 || r.err != nil {
+		return nil
+	}
+	offset += base
+	if offset+6 > len(r.data) {
+		r.err = errorf("unexpected end of anchor table at 0x%x", offset)
+		return nil
+	}
+	return &anchor{int(int16(u16(r.data, offset+2))), int(int16(u16(r.data, offset+4)))}
+}
+
+// singlePos adjusts the position of single glyphs.
+type singlePos struct {
+	coverage coverage
+	values   []valueRecord // a single value in format 1
+}
+
+func (s *singlePos) apply(c *applyContext, i int) (int, bool) {
+	k := s.coverage.index(c.buf.glyphs[i])
+	if k < 0 {
+		return 0, false
+	}
+	if len(s.values) == 1 {
+		k = 0
+	} else if k >= len(s.values) {
+		return 0, false
+	}
+	s.values[k].applyTo(&c.buf.positions[i])
+	return i + 1, true
+}
+
+type pairValue struct {
+	second Index
+	value1 valueRecord
+	value2 valueRecord
+}
+
+// pairPos adjusts the positions of glyph pairs, e.g. for kerning. Pairs are
+// either listed individually (format 1) or by glyph classes (format 2).
+type pairPos struct {
+	coverage    coverage
+	skipSecond  bool
+	sets        [][]pairValue
+	class1      classDef
+	class2      classDef
+	class2Count int
+	classValues []pairValue
+}
+
+func (s *pairPos) apply(c *applyContext, i int) (int, bool) {
+	k := s.coverage.index(c.buf.glyphs[i])
+	if k < 0 {
+		return 0, false
+	}
+	j := c.next(i)
+	if j >= len(c.buf.glyphs) {
+		return 0, false
+	}
+	var value *pairValue
+	if s.classValues != nil {
+		idx := int(s.class1.class(c.buf.glyphs[i]))*s.class2Count + int(s.class2.class(c.buf.glyphs[j]))
+		if idx >= len(s.classValues) {
+			return 0, false
+		}
+		value = &s.classValues[idx]
+	} else if k < len(s.sets) {
+		for m := range s.sets[k] {
+			if s.sets[k][m].second == c.buf.glyphs[j] {
+				value = &s.sets[k][m]
+				break
+			}
+		}
+	}
+	if value == nil {
+		return 0, false
+	}
+	value.value1.applyTo(&c.buf.positions[i])
+	value.value2.applyTo(&c.buf.positions[j])
+	if s.skipSecond {
+		return j + 1, true
+	}
+	return j, true
+}
+
+// cursivePos connects the exit anchor of a glyph with the entry anchor of
+// the following glyph.
+type cursivePos struct {
+	coverage    coverage
+	entry, exit []*anchor
+}
+
+func (s *cursivePos) apply(c *applyContext, i int) (int, bool) {
+	k := s.coverage.index(c.buf.glyphs[i])
+	if k < 0 || k >= len(s.exit) || s.exit[k] == nil {
+		return 0, false
+	}
+	j := c.next(i)
+	if j >= len(c.buf.glyphs) {
+		return 0, false
+	}
+	m := s.coverage.index(c.buf.glyphs[j])
+	if m < 0 || m >= len(s.entry) || s.entry[m] == nil {
+		return 0, false
+	}
+	exit, entry := s.exit[k], s.entry[m]
+	first, second := &c.buf.positions[i], &c.buf.positions[j]
+	if c.rtl {
+		// the advance of the second glyph ends at its entry anchor
+		d := exit.x + first.XOffset
+		first.XAdvance -= d
+		first.XOffset -= d
+		second.XAdvance = entry.x + second.XOffset
+	} else {
+		first.XAdvance = exit.x + first.XOffset
+		d := entry.x + second.XOffset
+		second.XAdvance -= d
+		second.XOffset -= d
+	}
+	if c.flag&lookupRightToLeft != 0 {
+		first.YOffset = second.YOffset + entry.y - exit.y
+	} else {
+		second.YOffset = first.YOffset + exit.y - entry.y
+	}
+	return j, true
+}
+
+type markRecord struct {
+	class  int
+	anchor *anchor
+}
+
+// markPos attaches marks to base glyphs, ligatures or other marks.
+type markPos struct {
+	kind        int
+	marks       coverage
+	bases       coverage
+	markRecords []markRecord
+	baseAnchors [][]*anchor   // indexed by base and mark class
+	ligatures   [][][]*anchor // indexed by ligature, component and mark class
+}
+
+func (s *markPos) apply(c *applyContext, i int) (int, bool) {
+	k := s.marks.index(c.buf.glyphs[i])
+	if k < 0 || k >= len(s.markRecords) {
+		return 0, false
+	}
+	mark := s.markRecords[k]
+
+	// locate the glyph the mark should be attached to
+	j := i - 1
+	if s.kind == gposMarkToMark {
+		j = c.prev(i)
+	} else {
+		for j >= 0 && c.f.glyphClass.class(c.buf.glyphs[j]) == glyphClassMark {
+			j--
+		}
+	}
+	if j < 0 {
+		return 0, false
+	}
+	b := s.bases.index(c.buf.glyphs[j])
+	if b < 0 {
+		return 0, false
+	}
+
+	var base *anchor
+	switch {
+	case s.kind == gposMarkToLigature && b < len(s.ligatures):
+		// Without information about the components of the ligature the
+		// mark is attached to its last component.
+		components := s.ligatures[b]
+		if len(components) > 0 && mark.class < len(components[len(components)-1]) {
+			base = components[len(components)-1][mark.class]
+		}
+	case s.kind != gposMarkToLigature && b < len(s.baseAnchors):
+		if mark.class < len(s.baseAnchors[b]) {
+			base = s.baseAnchors[b][mark.class]
+		}
+	}
+	if base == nil || mark.anchor == nil {
+		return 0, false
+	}
+
+	p := &c.buf.positions[i]
+	p.XAdvance = 0
+	p.YAdvance = 0
+	p.XOffset = c.buf.positions[j].XOffset + base.x - mark.anchor.x
+	p.YOffset = c.buf.positions[j].YOffset + base.y - mark.anchor.y
+	if c.rtl {
+		// right-to-left text is reversed later on, the mark will precede
+		// the glyphs between the base and itself.
+		for m := j + 1; m < i; m++ {
+			p.XOffset += c.buf.positions[m].XAdvance
+		}
+	} else {
+		for m := j; m < i; m++ {
+			p.XOffset -= c.buf.positions[m].XAdvance
+		}
+	}
+	return i + 1, true
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPosition(t *testing.T) {
+	f := openTestFont(t)
+	av := f.indexes("AV")
+	width := f.HMetric(av[0]).Width
+	if g := f.Position(av); g[0].XAdvance != width {
+		t.Errorf("advance of A without kerning is %d, want %d", g[0].XAdvance, width)
+	}
+	g := f.Position(av, "kern")
+	if g[0].XAdvance >= width {
+		t.Errorf("advance of A before V is %d, want less than %d", g[0].XAdvance, width)
+	}
+	if kern, want := f.Kerning(f.UnitsPerEm, av[0], av[1]), g[0].XAdvance-width; kern != want {
+		t.Errorf("Kerning(A, V) = %d, want %d", kern, want)
+	}
+	if kern := f.Kerning(1000, av[1], av[1]); kern != 0 {
+		t.Errorf("Kerning(V, V) = %d, want 0", kern)
+	}
+
+	// U+0301 is a combining acute accent
+	g = f.Shape("á", "mark")
+	if len(g) != 2 || g[1].XAdvance != 0 || g[1].XOffset >= 0 || g[1].Cluster != 1 {
+		t.Errorf("accent is not attached to the base: %v", g)
+	}
+}
+
+// positionWith applies a single GPOS subtable at every glyph. All glyphs
+// of the test font are 500 units wide.
+func positionWith(t *testing.T, data []byte, kind int, glyphs []Index) []Glyph {
+	f := &Font{nGlyph: 10, nHMetric: 1, hm: []HMetric{{Width: 500}}}
+	sub, _, err := f.parseGposSubtable(data, 0, kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := newGlyphBuffer(glyphs)
+	buf.initPositions(f)
+	c := &applyContext{f: f, buf: buf}
+	for i := range glyphs {
+		sub.apply(c, i)
+	}
+	return buf.result(f)
+}
+
+func TestGposSubtables(t *testing.T) {
+	var (
+		pairs = []byte{
+			0, 1, 0, 20, 0, 4, 0, 1, 0, 1, 0, 12, // format 1, x advance and x placement
+			0, 1, 0, 2, 0xff, 0xce, 0, 10, // glyph 2: -50 and 10
+			0, 1, 0, 1, 0, 1, // coverage of glyph 1
+		}
+		classPairs = []byte{
+			0, 2, 0, 24, 0, 4, 0, 0, 0, 32, 0, 42, 0, 2, 0, 2, // format 2, x advance
+			0, 0, 0, 0, 0, 0, 0xff, 0xb0, // class 1 and 1: -80
+			0, 1, 0, 2, 0, 1, 0, 2, // coverage of the glyphs 1 and 2
+			0, 1, 0, 1, 0, 2, 0, 1, 0, 1, // glyphs 1 and 2 are in class 1
+			0, 2, 0, 1, 0, 3, 0, 4, 0, 1, // glyphs 3 and 4 are in class 1
+		}
+		cursive = []byte{
+			0, 1, 0, 26, 0, 2, 0, 0, 0, 14, 0, 20, 0, 0, // format 1
+			0, 1, 1, 0x90, 0, 100, // exit of glyph 1 at (400, 100)
+			0, 1, 0, 50, 0, 0, // entry of glyph 2 at (50, 0)
+			0, 1, 0, 2, 0, 1, 0, 2, // coverage of the glyphs 1 and 2
+		}
+		markToBase = []byte{
+			0, 1, 0, 34, 0, 40, 0, 1, 0, 12, 0, 24, // format 1 with one class
+			0, 1, 0, 0, 0, 6, 0, 1, 0, 50, 0, 0, // mark anchor at (50, 0)
+			0, 1, 0, 4, 0, 1, 0, 250, 0x02, 0xbc, // base anchor at (250, 700)
+			0, 1, 0, 1, 0, 3, // coverage of the mark 3
+			0, 1, 0, 1, 0, 1, // coverage of the base 1
+		}
+	)
+	tests := []struct {
+		data   []byte
+		kind   int
+		glyphs []Index
+		want   []Glyph
+	}{
+		{pairs, gposPair, []Index{1, 2}, []Glyph{
+			{Index: 1, Cluster: 0, XAdvance: 450},
+			{Index: 2, Cluster: 1, XOffset: 10, XAdvance: 500},
+		}},
+		{pairs, gposPair, []Index{1, 3}, []Glyph{
+			{Index: 1, Cluster: 0, XAdvance: 500},
+			{Index: 3, Cluster: 1, XAdvance: 500},
+		}},
+		{classPairs, gposPair, []Index{2, 4}, []Glyph{
+			{Index: 2, Cluster: 0, XAdvance: 420},
+			{Index: 4, Cluster: 1, XAdvance: 500},
+		}},
+		{classPairs, gposPair, []Index{1, 2}, []Glyph{
+			{Index: 1, Cluster: 0, XAdvance: 500},
+			{Index: 2, Cluster: 1, XAdvance: 500},
+		}},
+		{cursive, gposCursive, []Index{1, 2}, []Glyph{
+			{Index: 1, Cluster: 0, XAdvance: 400},
+			{Index: 2, Cluster: 1, XOffset: -50, YOffset: 100, XAdvance: 450},
+		}},
+		{cursive, gposCursive, []Index{2, 1}, []Glyph{
+			{Index: 2, Cluster: 0, XAdvance: 500},
+			{Index: 1, Cluster: 1, XAdvance: 500},
+		}},
+		{markToBase, gposMarkToBase, []Index{1, 3}, []Glyph{
+			{Index: 1, Cluster: 0, XAdvance: 500},
+			{Index: 3, Cluster: 1, XOffset: -300, YOffset: 700},
+		}},
+		{markToBase, gposMarkToBase, []Index{2, 3}, []Glyph{
+			{Index: 2, Cluster: 0, XAdvance: 500},
+			{Index: 3, Cluster: 1, XAdvance: 500},
+		}},
+	}
+	for i, test := range tests {
+		if got := positionWith(t, test.data, test.kind, test.glyphs); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%d: got %v, want %v", i, got, test.want)
+		}
+	}
+}
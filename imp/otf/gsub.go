@@ -0,0 +1,290 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+// GSUB lookup types.
+const (
+	gsubSingle          = 1
+	gsubMultiple        = 2
+	gsubAlternate       = 3
+	gsubLigature        = 4
+	gsubContext         = 5
+	gsubChainingContext = 6
+	gsubExtension       = 7
+	gsubReverseChaining = 8
+)
+
+func (f *Font) parseGsub() error {
+	data := f.tables["GSUB"]
+	if len(data) == 0 {
+		return nil // GSUB block is optional
+	}
+	gsub, err := f.parseLayout("GSUB", data, f.parseGsubSubtable)
+	if err != nil {
+		return err
+	}
+	for i := range gsub.lookups {
+		gsub.lookups[i].reverse = gsub.lookups[i].kind == gsubReverseChaining
+	}
+	f.gsub = gsub
+	return nil
+}
+
+func (f *Font) parseGsubSubtable(data []byte, offset, kind int) (subtable, int, error) {
+	if offset+6 > len(data) {
+		return nil, kind, errorf("unexpected end of GSUB subblock at 0x%x", offset)
+	}
+	format := int(u16(data, offset))
+	r := &reader{data: data, pos: offset + 2}
+
+	var (
+		s   subtable
+		cov coverage
+		err error
+	)
+	if kind >= gsubSingle && kind <= gsubLigature {
+		if cov, err = f.parseCoverage(data, offset+r.u16()); err != nil {
+			return nil, kind, err
+		}
+	}
+
+	switch {
+	case kind == gsubSingle && format == 1:
+		s = &singleSubst{coverage: cov, delta: r.i16()}
+	case kind == gsubSingle && format == 2:
+		sub := &singleSubst{coverage: cov}
+		for n := r.u16(); n > 0 && r.err == nil; n-- {
+			sub.substitutes = append(sub.substitutes, Index(r.u16()))
+		}
+		s = sub
+	case (kind == gsubMultiple || kind == gsubAlternate) && format == 1:
+		var sequences [][]Index
+		for _, x := range r.offsets(r.u16(), offset) {
+			r2 := &reader{data: data, pos: x}
+			seq := make([]Index, 0, 1)
+			for n := r2.u16(); n > 0 && r2.err == nil; n-- {
+				seq = append(seq, Index(r2.u16()))
+			}
+			if r2.err != nil {
+				return nil, kind, r2.err
+			}
+			sequences = append(sequences, seq)
+		}
+		if kind == gsubMultiple {
+			s = &multipleSubst{coverage: cov, sequences: sequences}
+		} else {
+			s = &alternateSubst{coverage: cov, alternates: sequences}
+		}
+	case kind == gsubLigature && format == 1:
+		sub := &ligatureSubst{coverage: cov}
+		for k, x := range r.offsets(r.u16(), offset) {
+			if k >= len(cov) {
+				break
+			}
+			r2 := &reader{data: data, pos: x}
+			var set []Ligature
+			for _, y := range r2.offsets(r2.u16(), x) {
+				r3 := &reader{data: data, pos: y}
+				liga := Ligature{New: Index(r3.u16())}
+				count := r3.u16()
+				liga.Old = append(liga.Old, cov[k])
+				for n := 1; n < count && r3.err == nil; n++ {
+					liga.Old = append(liga.Old, Index(r3.u16()))
+				}
+				if r3.err != nil {
+					return nil, kind, r3.err
+				}
+				set = append(set, liga)
+			}
+			if r2.err != nil {
+				return nil, kind, r2.err
+			}
+			sub.sets = append(sub.sets, set)
+		}
+		s = sub
+	case kind == gsubContext || kind == gsubChainingContext:
+		ctx, err := f.parseContext(data, offset, kind == gsubChainingContext)
+		if err != nil {
+			return nil, kind, err
+		}
+		s = ctx
+	case kind == gsubExtension && format == 1:
+		extKind := r.u16()
+		extOffset := r.u32()
+		if r.err != nil || extKind == gsubExtension {
+			return nil, kind, errorf("invalid GSUB extension subtable at 0x%x", offset)
+		}
+		return f.parseGsubSubtable(data, offset+extOffset, extKind)
+	case kind == gsubReverseChaining && format == 1:
+		sub := &reverseChainSubst{}
+		if sub.coverage, err = f.parseCoverage(data, offset+r.u16()); err != nil {
+			return nil, kind, err
+		}
+		for _, x := range r.offsets(r.u16(), offset) {
+			c, err := f.parseCoverage(data, x)
+			if err != nil {
+				return nil, kind, err
+			}
+			sub.backtrack = append(sub.backtrack, c)
+		}
+		for _, x := range r.offsets(r.u16(), offset) {
+			c, err := f.parseCoverage(data, x)
+			if err != nil {
+				return nil, kind, err
+			}
+			sub.lookahead = append(sub.lookahead, c)
+		}
+		for n := r.u16(); n > 0 && r.err == nil; n-- {
+			sub.substitutes = append(sub.substitutes, Index(r.u16()))
+		}
+		s = sub
+	default:
+		return nil, kind, unsupportedf("unsupported GSUB lookup type %d format %d", kind, format)
+	}
+	if r.err != nil {
+		return nil, kind, r.err
+	}
+	return s, kind, nil
+}
+
+// Substitute applies the glyph substitutions of the given OpenType features
+// using the default script and language system. See Context.Substitute.
+func (f *Font) Substitute(glyphs []Index, features ...string) []Index {
+	return f.Context("", "").Substitute(glyphs, features...)
+}
+
+func (f *Font) substitute(buf *glyphBuffer, ls *langSys, features []Feature) {
+	c := &applyContext{f: f, buf: buf, lookups: f.gsub.lookups}
+	for _, lv := range f.gsub.selectLookups(ls, features) {
+		c.value, c.mask = lv.value, lv.mask
+		c.applyLookup(lv.index)
+	}
+}
+
+// SmallCaps replaces all lowercase letters with small capitals.
+func (f *Font) SmallCaps(glyphs []Index) []Index {
+	return f.Substitute(glyphs, "smcp")
+}
+
+// Ligatures replaces sequences of glyphs with standard ligatures.
+func (f *Font) Ligatures(glyphs []Index) []Index {
+	return f.Substitute(glyphs, "liga")
+}
+
+// singleSubst replaces a single glyph either by adding delta to the glyph
+// index (format 1) or by a list of substitutes (format 2).
+type singleSubst struct {
+	coverage    coverage
+	delta       int
+	substitutes []Index
+}
+
+func (s *singleSubst) apply(c *applyContext, i int) (int, bool) {
+	k := s.coverage.index(c.buf.glyphs[i])
+	if k < 0 {
+		return 0, false
+	}
+	if s.substitutes == nil {
+		c.buf.glyphs[i] = Index(int(c.buf.glyphs[i]) + s.delta)
+	} else if k < len(s.substitutes) {
+		c.buf.glyphs[i] = s.substitutes[k]
+	} else {
+		return 0, false
+	}
+	return i + 1, true
+}
+
+// multipleSubst replaces a single glyph with a sequence of glyphs.
+type multipleSubst struct {
+	coverage  coverage
+	sequences [][]Index
+}
+
+func (s *multipleSubst) apply(c *applyContext, i int) (int, bool) {
+	k := s.coverage.index(c.buf.glyphs[i])
+	if k < 0 || k >= len(s.sequences) {
+		return 0, false
+	}
+	seq := make([]Index, len(s.sequences[k]))
+	copy(seq, s.sequences[k])
+	c.buf.replace(i, 1, seq...)
+	return i + len(seq), true
+}
+
+// alternateSubst replaces a glyph with one of its alternates. The value of
+// the feature selects the alternate.
+type alternateSubst struct {
+	coverage   coverage
+	alternates [][]Index
+}
+
+func (s *alternateSubst) apply(c *applyContext, i int) (int, bool) {
+	k := s.coverage.index(c.buf.glyphs[i])
+	if k < 0 || k >= len(s.alternates) || c.value < 1 || c.value > len(s.alternates[k]) {
+		return 0, false
+	}
+	c.buf.glyphs[i] = s.alternates[k][c.value-1]
+	return i + 1, true
+}
+
+// ligatureSubst replaces a sequence of glyphs with a single ligature.
+type ligatureSubst struct {
+	coverage coverage
+	sets     [][]Ligature
+}
+
+func (s *ligatureSubst) apply(c *applyContext, i int) (int, bool) {
+	k := s.coverage.index(c.buf.glyphs[i])
+	if k < 0 || k >= len(s.sets) {
+		return 0, false
+	}
+	for _, liga := range s.sets[k] {
+		positions := make([]int, len(liga.Old))
+		positions[0] = i
+		found := true
+		for m := 1; m < len(liga.Old); m++ {
+			p := c.next(positions[m-1])
+			if p >= len(c.buf.glyphs) || c.buf.glyphs[p] != liga.Old[m] {
+				found = false
+				break
+			}
+			positions[m] = p
+		}
+		if found {
+			c.buf.ligate(positions, liga.New)
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// reverseChainSubst replaces single glyphs depending on their context. The
+// lookup is applied from the end of the buffer to its start.
+type reverseChainSubst struct {
+	coverage    coverage
+	backtrack   []coverage
+	lookahead   []coverage
+	substitutes []Index
+}
+
+func (s *reverseChainSubst) apply(c *applyContext, i int) (int, bool) {
+	k := s.coverage.index(c.buf.glyphs[i])
+	if k < 0 || k >= len(s.substitutes) {
+		return 0, false
+	}
+	p := i
+	for _, cov := range s.backtrack {
+		if p = c.prev(p); p < 0 || !cov.match(c.buf.glyphs[p]) {
+			return 0, false
+		}
+	}
+	p = i
+	for _, cov := range s.lookahead {
+		if p = c.next(p); p >= len(c.buf.glyphs) || !cov.match(c.buf.glyphs[p]) {
+			return 0, false
+		}
+	}
+	c.buf.glyphs[i] = s.substitutes[k]
+	return i + 1, true
+}
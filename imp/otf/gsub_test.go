@@ -0,0 +1,78 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func openTestFont(t *testing.T) *Font {
+	f, err := Open("../../fonts/SourceSansPro-Regular.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func (f *Font) indexes(text string) []Index {
+	var glyphs []Index
+	for _, r := range text {
+		glyphs = append(glyphs, f.Index(r))
+	}
+	return glyphs
+}
+
+func TestSubstitute(t *testing.T) {
+	f := openTestFont(t)
+	tests := []struct {
+		text     string
+		features []string
+		changed  bool
+		n        int // number of resulting glyphs
+	}{
+		{"ff", nil, false, 2},
+		{"ff", []string{"liga"}, true, 1},
+		{"ff", []string{"liga", "-liga"}, false, 2},
+		{"ffx", []string{"liga"}, true, 2},
+		{"AV", []string{"liga"}, false, 2},
+		{"abc", []string{"smcp"}, true, 3},
+		{"ABC", []string{"smcp"}, false, 3},
+		{"ABC", []string{"c2sc"}, true, 3},
+		{"123", []string{"onum"}, true, 3},
+		{"a", []string{"salt"}, true, 1},
+		{"a", []string{"salt=0"}, false, 1},
+		{"a", []string{"unkn"}, false, 1},
+	}
+	for _, test := range tests {
+		in := f.indexes(test.text)
+		out := f.Substitute(f.indexes(test.text), test.features...)
+		if changed := !reflect.DeepEqual(in, out); changed != test.changed || len(out) != test.n {
+			t.Errorf("Substitute(%q, %q) = %v, from %v", test.text, test.features, out, in)
+		}
+	}
+}
+
+func TestAlternates(t *testing.T) {
+	f := openTestFont(t)
+	a := f.indexes("a")
+	first, second := f.Substitute(f.indexes("a"), "aalt=1"), f.Substitute(f.indexes("a"), "aalt=2")
+	if reflect.DeepEqual(first, a) || reflect.DeepEqual(second, a) || reflect.DeepEqual(first, second) {
+		t.Errorf("alternates of %v are %v and %v", a, first, second)
+	}
+}
+
+func TestWouldSubstitute(t *testing.T) {
+	c := openTestFont(t).Context("", "")
+	ff := c.Font.indexes("ff")
+	if !c.WouldSubstitute(ff, "liga") {
+		t.Error("expected a ligature for ff")
+	}
+	if c.WouldSubstitute(ff, "c2sc") {
+		t.Error("unexpected small capitals for ff")
+	}
+	if got := c.Font.indexes("ff"); !reflect.DeepEqual(ff, got) {
+		t.Errorf("WouldSubstitute modified the glyphs to %v", got)
+	}
+}
@@ -0,0 +1,889 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Lookup flags which control the glyphs that are skipped during matching.
+const (
+	lookupRightToLeft         = 0x0001
+	lookupIgnoreBaseGlyphs    = 0x0002
+	lookupIgnoreLigatures     = 0x0004
+	lookupIgnoreMarks         = 0x0008
+	lookupUseMarkFilteringSet = 0x0010
+	lookupMarkAttachmentType  = 0xff00
+)
+
+// Glyph classes as defined by the GDEF table.
+const (
+	glyphClassBase      = 1
+	glyphClassLigature  = 2
+	glyphClassMark      = 3
+	glyphClassComponent = 4
+)
+
+// A layout holds the script, feature and lookup lists which are shared by
+// the GSUB and GPOS tables.
+type layout struct {
+	scripts  map[string]map[string]*langSys // default language has an empty tag
+	features []feature
+	lookups  []lookup
+}
+
+// A langSys lists the features which are available for a language.
+type langSys struct {
+	required int // index of the required feature or -1
+	features []int
+}
+
+type feature struct {
+	tag     string
+	lookups []int
+}
+
+type lookup struct {
+	kind      int
+	flag      uint16
+	markSet   int
+	reverse   bool // applied from the end of the buffer to the start
+	subtables []subtable
+}
+
+// A subtable is a single GSUB or GPOS lookup subtable. It returns the
+// position after the modified glyphs if it was applied at position i.
+type subtable interface {
+	apply(c *applyContext, i int) (next int, ok bool)
+}
+
+// subtableParser parses the subtable of the given lookup type located at
+// data[offset:]. Extension subtables return the type of the wrapped lookup.
+type subtableParser func(data []byte, offset, kind int) (subtable, int, error)
+
+// An unsupportedError reports a lookup type or subtable format which is not
+// implemented. Lookups with such subtables are ignored.
+type unsupportedError string
+
+func (e unsupportedError) Error() string {
+	return string(e)
+}
+
+func unsupportedf(format string, values ...interface{}) error {
+	return unsupportedError(errorf(format, values...))
+}
+
+func (f *Font) parseLayout(name string, data []byte, parse subtableParser) (*layout, error) {
+	if len(data) < 10 {
+		return nil, errorf("%s block is too short (%d bytes)", name, len(data))
+	}
+	var (
+		scriptListOffset  = int(u16(data, 4))
+		featureListOffset = int(u16(data, 6))
+		lookupListOffset  = int(u16(data, 8))
+	)
+	l := &layout{scripts: make(map[string]map[string]*langSys)}
+
+	// parse the script list
+	if scriptListOffset+2 > len(data) {
+		return nil, errorf("unexpected end of %s script list", name)
+	}
+	scriptCount := int(u16(data, scriptListOffset))
+	if scriptListOffset+2+6*scriptCount > len(data) {
+		return nil, errorf("unexpected end of %s script list with %d entries", name, scriptCount)
+	}
+	for i := 0; i < scriptCount; i++ {
+		x := scriptListOffset + 2 + 6*i
+		tag := string(data[x : x+4])
+		scriptOffset := int(u16(data, x+4)) + scriptListOffset
+		if scriptOffset+4 > len(data) {
+			return nil, errorf("invalid %s script offset", name)
+		}
+		langs := make(map[string]*langSys)
+		if offset := int(u16(data, scriptOffset)); offset != 0 {
+			ls, err := parseLangSys(data, scriptOffset+offset)
+			if err != nil {
+				return nil, err
+			}
+			langs[""] = ls
+		}
+		langCount := int(u16(data, scriptOffset+2))
+		if scriptOffset+4+6*langCount > len(data) {
+			return nil, errorf("unexpected end of script table with %d entries", langCount)
+		}
+		for k := 0; k < langCount; k++ {
+			y := scriptOffset + 4 + 6*k
+			ls, err := parseLangSys(data, scriptOffset+int(u16(data, y+4)))
+			if err != nil {
+				return nil, err
+			}
+			langs[string(data[y:y+4])] = ls
+		}
+		l.scripts[tag] = langs
+	}
+
+	// parse the feature list
+	if featureListOffset+2 > len(data) {
+		return nil, errorf("invalid %s feature list at 0x%x", name, featureListOffset)
+	}
+	featureCount := int(u16(data, featureListOffset))
+	if featureListOffset+2+6*featureCount > len(data) {
+		return nil, errorf("unexpected end of %s feature list with %d entries", name, featureCount)
+	}
+	l.features = make([]feature, featureCount)
+	for i := range l.features {
+		x := featureListOffset + 2 + 6*i
+		offset := int(u16(data, x+4)) + featureListOffset
+		if offset+4 > len(data) {
+			return nil, errorf("invalid %s feature at 0x%x", name, offset)
+		}
+		count := int(u16(data, offset+2))
+		if offset+4+2*count > len(data) {
+			return nil, errorf("unexpected end of %s feature at 0x%x", name, offset)
+		}
+		l.features[i].tag = string(data[x : x+4])
+		l.features[i].lookups = make([]int, count)
+		for k := 0; k < count; k++ {
+			l.features[i].lookups[k] = int(u16(data, offset+4+2*k))
+		}
+	}
+
+	// parse the lookup list
+	if lookupListOffset+2 > len(data) {
+		return nil, errorf("invalid %s lookup list at 0x%x", name, lookupListOffset)
+	}
+	lookupCount := int(u16(data, lookupListOffset))
+	if lookupListOffset+2+2*lookupCount > len(data) {
+		return nil, errorf("unexpected end of %s lookup list with %d entries", name, lookupCount)
+	}
+	l.lookups = make([]lookup, lookupCount)
+	for i := range l.lookups {
+		offset := int(u16(data, lookupListOffset+2+2*i)) + lookupListOffset
+		if offset+6 > len(data) {
+			return nil, errorf("unexpected end of %s lookup entry at 0x%x", name, offset)
+		}
+		lk := &l.lookups[i]
+		lk.kind = int(u16(data, offset))
+		lk.flag = u16(data, offset+2)
+		count := int(u16(data, offset+4))
+		if offset+6+2*count > len(data) {
+			return nil, errorf("unexpected end of %s lookup entry at 0x%x", name, offset)
+		}
+		lk.markSet = -1
+		if lk.flag&lookupUseMarkFilteringSet != 0 {
+			if offset+8+2*count > len(data) {
+				return nil, errorf("unexpected end of %s lookup entry at 0x%x", name, offset)
+			}
+			lk.markSet = int(u16(data, offset+6+2*count))
+		}
+		for k := 0; k < count; k++ {
+			sub, kind, err := parse(data, offset+int(u16(data, offset+6+2*k)), lk.kind)
+			if _, ok := err.(unsupportedError); ok {
+				// the lookup does nothing, but the others still work
+				lk.subtables = nil
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			lk.kind = kind
+			lk.subtables = append(lk.subtables, sub)
+		}
+	}
+	return l, nil
+}
+
+func parseLangSys(data []byte, offset int) (*langSys, error) {
+	if offset+6 > len(data) {
+		return nil, errorf("invalid langSysOffset 0x%x", offset)
+	}
+	ls := &langSys{required: -1}
+	if required := u16(data, offset+2); required != math.MaxUint16 {
+		ls.required = int(required)
+	}
+	count := int(u16(data, offset+4))
+	if offset+6+2*count > len(data) {
+		return nil, errorf("unexpected end of lang/sys table with %d entries", count)
+	}
+	ls.features = make([]int, count)
+	for i := range ls.features {
+		ls.features[i] = int(u16(data, offset+6+2*i))
+	}
+	return ls, nil
+}
+
+// langSys returns the language system for the given script and language
+// tags, falling back to the default script and language if necessary.
+func (l *layout) langSys(script, lang string) *langSys {
+	langs, ok := l.scripts[script]
+	if !ok {
+		if langs, ok = l.scripts["DFLT"]; !ok {
+			langs = l.scripts["latn"]
+		}
+	}
+	if ls, ok := langs[lang]; ok {
+		return ls
+	}
+	return langs[""]
+}
+
+// A lookupValue is a lookup which should be applied together with the
+// value and the mask of the feature which has requested it.
+type lookupValue struct {
+	index int
+	value int
+	mask  uint32
+}
+
+// selectLookups returns all lookups of the given features in the order
+// they have to be applied.
+func (l *layout) selectLookups(ls *langSys, features []Feature) []lookupValue {
+	if ls == nil {
+		return nil
+	}
+	enabled := make(map[string]Feature, len(features))
+	for _, f := range features {
+		tag := padTag(f.Tag)
+		if f.Value > 0 {
+			enabled[tag] = f
+		} else {
+			delete(enabled, tag)
+		}
+	}
+	values := make(map[int]lookupValue)
+	add := func(id int, value int, mask uint32) {
+		if id < 0 || id >= len(l.features) {
+			return
+		}
+		if mask == 0 {
+			mask = ^uint32(0)
+		}
+		for _, k := range l.features[id].lookups {
+			if k < len(l.lookups) {
+				values[k] = lookupValue{k, value, mask | values[k].mask}
+			}
+		}
+	}
+	add(ls.required, 1, 0)
+	for _, id := range ls.features {
+		if id < len(l.features) {
+			if f, ok := enabled[l.features[id].tag]; ok {
+				add(id, f.Value, f.Mask)
+			}
+		}
+	}
+	lookups := make([]lookupValue, 0, len(values))
+	for _, v := range values {
+		lookups = append(lookups, v)
+	}
+	sort.Slice(lookups, func(i, j int) bool { return lookups[i].index < lookups[j].index })
+	return lookups
+}
+
+// A Feature enables an OpenType feature for all glyphs whose mask shares a
+// bit with Mask. A zero Mask enables the feature for all glyphs. The Value
+// selects an alternate glyph (e.g. for "salt") while a zero value disables
+// the feature.
+type Feature struct {
+	Tag   string
+	Value int
+	Mask  uint32
+}
+
+// parseFeatures parses a list of feature tags. A feature can be written as
+// "tag=n" in order to select the n-th alternate glyph, while "tag=0" or
+// "-tag" disables a feature.
+func parseFeatures(features []string) []Feature {
+	values := make([]Feature, 0, len(features))
+	for _, f := range features {
+		value := 1
+		if strings.HasPrefix(f, "-") {
+			f, value = f[1:], 0
+		} else if pos := strings.IndexByte(f, '='); pos >= 0 {
+			if v, err := strconv.Atoi(f[pos+1:]); err == nil && v >= 0 {
+				value = v
+			}
+			f = f[:pos]
+		}
+		values = append(values, Feature{Tag: padTag(f), Value: value})
+	}
+	return values
+}
+
+// ParseFeatures parses a list of features as accepted by Context.Shape.
+func ParseFeatures(features ...string) []Feature {
+	return parseFeatures(features)
+}
+
+// A glyphBuffer holds a run of glyphs while lookups are applied. Each glyph
+// remembers the cluster (e.g. the position in the input text) it belongs to
+// and optionally a mask which selects the features applied to it.
+// Positions are only available once the glyph positioning has started.
+type glyphBuffer struct {
+	glyphs    []Index
+	clusters  []int
+	masks     []uint32
+	positions []Glyph
+}
+
+func newGlyphBuffer(glyphs []Index) *glyphBuffer {
+	b := &glyphBuffer{glyphs: glyphs, clusters: make([]int, len(glyphs))}
+	for i := range b.clusters {
+		b.clusters[i] = i
+	}
+	return b
+}
+
+// initPositions sets the advance of every glyph to its default width.
+func (b *glyphBuffer) initPositions(f *Font) {
+	b.positions = make([]Glyph, len(b.glyphs))
+	for i := range b.positions {
+		b.positions[i].XAdvance = f.HMetric(b.glyphs[i]).Width
+	}
+}
+
+// result returns the positioned glyphs.
+func (b *glyphBuffer) result(f *Font) []Glyph {
+	if b.positions == nil {
+		b.initPositions(f)
+	}
+	for i := range b.positions {
+		b.positions[i].Index = b.glyphs[i]
+		b.positions[i].Cluster = b.clusters[i]
+	}
+	return b.positions
+}
+
+// replace replaces n glyphs starting at position i with the given glyphs.
+// The new glyphs inherit the mask of the first replaced glyph.
+func (b *glyphBuffer) replace(i, n int, glyphs ...Index) {
+	cluster := b.clusters[i]
+	for k := i; k < i+n; k++ {
+		if b.clusters[k] < cluster {
+			cluster = b.clusters[k]
+		}
+	}
+	clusters := make([]int, len(glyphs))
+	for k := range clusters {
+		clusters[k] = cluster
+	}
+	b.glyphs = append(b.glyphs[:i], append(glyphs, b.glyphs[i+n:]...)...)
+	b.clusters = append(b.clusters[:i], append(clusters, b.clusters[i+n:]...)...)
+	if b.masks != nil {
+		masks := make([]uint32, len(glyphs))
+		for k := range masks {
+			masks[k] = b.masks[i]
+		}
+		b.masks = append(b.masks[:i], append(masks, b.masks[i+n:]...)...)
+	}
+}
+
+// ligate replaces the glyphs at the given positions with a single glyph
+// which is stored at the first position.
+func (b *glyphBuffer) ligate(positions []int, g Index) {
+	first := positions[0]
+	for _, p := range positions {
+		if b.clusters[p] < b.clusters[first] {
+			b.clusters[first] = b.clusters[p]
+		}
+	}
+	b.glyphs[first] = g
+	for k := len(positions) - 1; k > 0; k-- {
+		p := positions[k]
+		b.glyphs = append(b.glyphs[:p], b.glyphs[p+1:]...)
+		b.clusters = append(b.clusters[:p], b.clusters[p+1:]...)
+		if b.masks != nil {
+			b.masks = append(b.masks[:p], b.masks[p+1:]...)
+		}
+	}
+}
+
+// An applyContext holds the state while lookups are applied to a buffer.
+type applyContext struct {
+	f       *Font
+	buf     *glyphBuffer
+	lookups []lookup
+	flag    uint16
+	markSet int
+	value   int
+	mask    uint32
+	rtl     bool
+	depth   int
+}
+
+// applyLookup applies a single lookup to all glyphs of the buffer which
+// match the current mask.
+func (c *applyContext) applyLookup(index int) {
+	l := &c.lookups[index]
+	if l.reverse {
+		for i := len(c.buf.glyphs) - 1; i >= 0; i-- {
+			if !c.ignored(i, l) {
+				c.applyAt(index, i)
+			}
+		}
+		return
+	}
+	for i := 0; i < len(c.buf.glyphs); {
+		if c.ignored(i, l) {
+			i++
+			continue
+		}
+		if next, ok := c.applyAt(index, i); ok && next > i {
+			i = next
+		} else {
+			i++
+		}
+	}
+}
+
+// applyAt applies the lookup with the given index at position i.
+func (c *applyContext) applyAt(index, i int) (int, bool) {
+	if index < 0 || index >= len(c.lookups) || c.depth > 8 {
+		return 0, false
+	}
+	l := &c.lookups[index]
+	flag, markSet := c.flag, c.markSet
+	c.flag, c.markSet = l.flag, l.markSet
+	c.depth++
+	defer func() {
+		c.flag, c.markSet = flag, markSet
+		c.depth--
+	}()
+	for _, sub := range l.subtables {
+		if next, ok := sub.apply(c, i); ok {
+			return next, true
+		}
+	}
+	return 0, false
+}
+
+// ignored reports whether the glyph at position i should be skipped by the
+// given lookup.
+func (c *applyContext) ignored(i int, l *lookup) bool {
+	if c.buf.masks != nil && c.buf.masks[i]&c.mask == 0 {
+		return true
+	}
+	return c.f.ignoredGlyph(c.buf.glyphs[i], l.flag, l.markSet)
+}
+
+// skip reports whether a glyph should be skipped by the current lookup.
+func (c *applyContext) skip(g Index) bool {
+	return c.f.ignoredGlyph(g, c.flag, c.markSet)
+}
+
+func (f *Font) ignoredGlyph(g Index, flag uint16, markSet int) bool {
+	switch f.glyphClass.class(g) {
+	case glyphClassBase:
+		return flag&lookupIgnoreBaseGlyphs != 0
+	case glyphClassLigature:
+		return flag&lookupIgnoreLigatures != 0
+	case glyphClassMark:
+		if flag&lookupIgnoreMarks != 0 {
+			return true
+		}
+		if flag&lookupUseMarkFilteringSet != 0 {
+			return markSet < 0 || markSet >= len(f.markSets) || f.markSets[markSet].index(g) < 0
+		}
+		if t := (flag & lookupMarkAttachmentType) >> 8; t != 0 {
+			return f.markAttachClass.class(g) != t
+		}
+	}
+	return false
+}
+
+// next returns the position of the next glyph after i which is not skipped.
+func (c *applyContext) next(i int) int {
+	for i++; i < len(c.buf.glyphs) && c.skip(c.buf.glyphs[i]); i++ {
+	}
+	return i
+}
+
+// prev returns the position of the previous glyph before i which is not skipped.
+func (c *applyContext) prev(i int) int {
+	for i--; i >= 0 && c.skip(c.buf.glyphs[i]); i-- {
+	}
+	return i
+}
+
+// A coverage is a sorted list of glyphs. The position of a glyph in that
+// list is used as index by most subtables.
+type coverage []Index
+
+func (c coverage) index(g Index) int {
+	pos := sort.Search(len(c), func(i int) bool { return c[i] >= g })
+	if pos < len(c) && c[pos] == g {
+		return pos
+	}
+	return -1
+}
+
+func (c coverage) match(g Index) bool {
+	return c.index(g) >= 0
+}
+
+// A classDef assigns classes to sorted ranges of glyphs. Glyphs outside of
+// all ranges have the class 0.
+type classDef []classRange
+
+type classRange struct {
+	first, last Index
+	class       uint16
+}
+
+func (c classDef) class(g Index) uint16 {
+	k := sort.Search(len(c), func(i int) bool { return c[i].last >= g })
+	if k < len(c) && c[k].first <= g {
+		return c[k].class
+	}
+	return 0
+}
+
+func (f *Font) parseClassDef(data []byte, offset int) (classDef, error) {
+	if offset+4 > len(data) {
+		return nil, errorf("unexpected end of class definition")
+	}
+	var classes classDef
+	switch format := u16(data, offset); format {
+	case 1:
+		if offset+6 > len(data) {
+			return nil, errorf("unexpected end of class definition")
+		}
+		start := int(u16(data, offset+2))
+		count := int(u16(data, offset+4))
+		if offset+6+2*count > len(data) {
+			return nil, errorf("unexpected end of class definition")
+		}
+		// consecutive glyphs of the same class are joined into a range
+		for k := 0; k < count && start+k < f.nGlyph; k++ {
+			g, class := Index(start+k), u16(data, offset+6+2*k)
+			if n := len(classes); n > 0 && classes[n-1].last+1 == g && classes[n-1].class == class {
+				classes[n-1].last = g
+			} else if class != 0 {
+				classes = append(classes, classRange{g, g, class})
+			}
+		}
+	case 2:
+		count := int(u16(data, offset+2))
+		if offset+4+count*6 > len(data) {
+			return nil, errorf("unexpected end of class definition")
+		}
+		classes = make(classDef, 0, count)
+		for k := 0; k < count; k++ {
+			first := Index(u16(data, offset+4+k*6))
+			last := Index(u16(data, offset+4+k*6+2))
+			class := u16(data, offset+4+k*6+4)
+			if first <= last && class != 0 {
+				classes = append(classes, classRange{first, last, class})
+			}
+		}
+		sort.Slice(classes, func(i, j int) bool { return classes[i].first < classes[j].first })
+	default:
+		return nil, errorf("unsupported class definition format %d", format)
+	}
+	return classes, nil
+}
+
+// A glyphMatcher is used to match a single glyph of a contextual rule.
+type glyphMatcher interface {
+	match(g Index) bool
+}
+
+type glyphValue Index
+
+func (v glyphValue) match(g Index) bool {
+	return Index(v) == g
+}
+
+type classValue struct {
+	classes classDef
+	class   uint16
+}
+
+func (v classValue) match(g Index) bool {
+	return v.classes.class(g) == v.class
+}
+
+// A lookupRecord applies a nested lookup to a glyph of the input sequence.
+type lookupRecord struct {
+	sequence int
+	lookup   int
+}
+
+type contextRule struct {
+	backtrack []glyphMatcher // stored from the nearest glyph backwards
+	input     []glyphMatcher // including the first glyph
+	lookahead []glyphMatcher
+	records   []lookupRecord
+}
+
+// A contextSubtable implements (chaining) contextual lookups of all three
+// formats for both GSUB and GPOS.
+type contextSubtable struct {
+	format   int
+	coverage coverage
+	classes  classDef // selects the rule set in format 2
+	sets     [][]contextRule
+}
+
+func (s *contextSubtable) apply(c *applyContext, i int) (int, bool) {
+	g := c.buf.glyphs[i]
+	k := s.coverage.index(g)
+	if k < 0 {
+		return 0, false
+	}
+	switch s.format {
+	case 2:
+		k = int(s.classes.class(g))
+	case 3:
+		k = 0
+	}
+	if k >= len(s.sets) {
+		return 0, false
+	}
+	for r := range s.sets[k] {
+		rule := &s.sets[k][r]
+		positions, ok := c.matchRule(rule, i)
+		if !ok {
+			continue
+		}
+		end := positions[len(positions)-1] + 1
+		for _, rec := range rule.records {
+			if rec.sequence >= len(positions) {
+				continue
+			}
+			before := len(c.buf.glyphs)
+			c.applyAt(rec.lookup, positions[rec.sequence])
+			if delta := len(c.buf.glyphs) - before; delta != 0 {
+				for p := range positions {
+					if p > rec.sequence {
+						positions[p] += delta
+					}
+				}
+				end += delta
+			}
+		}
+		return end, true
+	}
+	return 0, false
+}
+
+// matchRule checks whether the rule matches at position i and returns the
+// positions of all glyphs in the input sequence.
+func (c *applyContext) matchRule(rule *contextRule, i int) ([]int, bool) {
+	positions := make([]int, len(rule.input))
+	p := i
+	for k, m := range rule.input {
+		if k > 0 {
+			p = c.next(p)
+		}
+		if p >= len(c.buf.glyphs) || !m.match(c.buf.glyphs[p]) {
+			return nil, false
+		}
+		positions[k] = p
+	}
+	for _, m := range rule.lookahead {
+		if p = c.next(p); p >= len(c.buf.glyphs) || !m.match(c.buf.glyphs[p]) {
+			return nil, false
+		}
+	}
+	p = i
+	for _, m := range rule.backtrack {
+		if p = c.prev(p); p < 0 || !m.match(c.buf.glyphs[p]) {
+			return nil, false
+		}
+	}
+	return positions, true
+}
+
+// parseContext parses contextual (chaining == false) and chaining contextual
+// subtables in all three formats.
+func (f *Font) parseContext(data []byte, offset int, chaining bool) (*contextSubtable, error) {
+	if offset+6 > len(data) {
+		return nil, errorf("unexpected end of context subtable at 0x%x", offset)
+	}
+	s := &contextSubtable{format: int(u16(data, offset))}
+	r := &reader{data: data}
+
+	// readRule parses a single (chain) rule located at data[pos:]. The
+	// matcher function converts glyph ids or classes into glyph matchers.
+	readRule := func(pos int, backMatch, inputMatch, aheadMatch func(v uint16) glyphMatcher, first glyphMatcher) contextRule {
+		r.pos = pos
+		var rule contextRule
+		if chaining {
+			for n := r.u16(); n > 0 && r.err == nil; n-- {
+				rule.backtrack = append(rule.backtrack, backMatch(uint16(r.u16())))
+			}
+		}
+		inputCount := r.u16()
+		recordCount := 0
+		if !chaining {
+			recordCount = r.u16()
+		}
+		rule.input = append(rule.input, first)
+		for n := 1; n < inputCount && r.err == nil; n++ {
+			rule.input = append(rule.input, inputMatch(uint16(r.u16())))
+		}
+		if chaining {
+			for n := r.u16(); n > 0 && r.err == nil; n-- {
+				rule.lookahead = append(rule.lookahead, aheadMatch(uint16(r.u16())))
+			}
+			recordCount = r.u16()
+		}
+		for n := 0; n < recordCount && r.err == nil; n++ {
+			rule.records = append(rule.records, lookupRecord{r.u16(), r.u16()})
+		}
+		return rule
+	}
+	// readSets parses the (chain) rule sets of format 1 and 2 subtables.
+	readSets := func(pos int, firstMatch func(k int) glyphMatcher, backMatch, inputMatch, aheadMatch func(v uint16) glyphMatcher) {
+		r.pos = pos
+		setCount := r.u16()
+		setOffsets := r.offsets(setCount, offset)
+		s.sets = make([][]contextRule, setCount)
+		for k, setOffset := range setOffsets {
+			if setOffset == offset || r.err != nil {
+				continue // no rules for this glyph or class
+			}
+			r.pos = setOffset
+			ruleOffsets := r.offsets(r.u16(), setOffset)
+			for _, ruleOffset := range ruleOffsets {
+				s.sets[k] = append(s.sets[k], readRule(ruleOffset, backMatch, inputMatch, aheadMatch, firstMatch(k)))
+			}
+		}
+	}
+	glyphMatch := func(v uint16) glyphMatcher { return glyphValue(v) }
+
+	switch s.format {
+	case 1:
+		var err error
+		if s.coverage, err = f.parseCoverage(data, offset+int(u16(data, offset+2))); err != nil {
+			return nil, err
+		}
+		readSets(offset+4, func(k int) glyphMatcher {
+			if k < len(s.coverage) {
+				return glyphValue(s.coverage[k])
+			}
+			return glyphValue(0)
+		}, glyphMatch, glyphMatch, glyphMatch)
+	case 2:
+		var err error
+		if s.coverage, err = f.parseCoverage(data, offset+int(u16(data, offset+2))); err != nil {
+			return nil, err
+		}
+		classDefs := []classDef{nil, nil, nil}
+		pos := offset + 4
+		if chaining {
+			if offset+12 > len(data) {
+				return nil, errorf("unexpected end of context subtable at 0x%x", offset)
+			}
+			for k := range classDefs {
+				if x := int(u16(data, offset+4+2*k)); x != 0 {
+					if classDefs[k], err = f.parseClassDef(data, offset+x); err != nil {
+						return nil, err
+					}
+				}
+			}
+			pos = offset + 10
+		} else {
+			if classDefs[1], err = f.parseClassDef(data, offset+int(u16(data, offset+4))); err != nil {
+				return nil, err
+			}
+			pos = offset + 6
+		}
+		s.classes = classDefs[1]
+		matcher := func(classes classDef) func(v uint16) glyphMatcher {
+			return func(v uint16) glyphMatcher { return classValue{classes, v} }
+		}
+		readSets(pos, func(k int) glyphMatcher {
+			return classValue{s.classes, uint16(k)}
+		}, matcher(classDefs[0]), matcher(classDefs[1]), matcher(classDefs[2]))
+	case 3:
+		coverages := func(n int) []glyphMatcher {
+			offsets := r.offsets(n, offset)
+			matchers := make([]glyphMatcher, 0, n)
+			for _, x := range offsets {
+				cov, err := f.parseCoverage(data, x)
+				if err != nil {
+					r.err = err
+					return nil
+				}
+				matchers = append(matchers, cov)
+			}
+			return matchers
+		}
+		var rule contextRule
+		r.pos = offset + 2
+		if chaining {
+			rule.backtrack = coverages(r.u16())
+		}
+		inputCount := r.u16()
+		recordCount := 0
+		if !chaining {
+			recordCount = r.u16()
+		}
+		rule.input = coverages(inputCount)
+		if chaining {
+			rule.lookahead = coverages(r.u16())
+			recordCount = r.u16()
+		}
+		for n := 0; n < recordCount && r.err == nil; n++ {
+			rule.records = append(rule.records, lookupRecord{r.u16(), r.u16()})
+		}
+		if r.err == nil && len(rule.input) == 0 {
+			r.err = errorf("context subtable without input glyphs at 0x%x", offset)
+		}
+		if r.err == nil {
+			s.coverage = rule.input[0].(coverage)
+			s.sets = [][]contextRule{{rule}}
+		}
+	default:
+		return nil, unsupportedf("unsupported context subtable format %d", s.format)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return s, nil
+}
+
+// A reader reads consecutive big-endian values and remembers the first
+// out of bounds error.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) u16() int {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos+2 > len(r.data) {
+		r.err = errorf("unexpected end of table at 0x%x", r.pos)
+		return 0
+	}
+	v := int(u16(r.data, r.pos))
+	r.pos += 2
+	return v
+}
+
+func (r *reader) i16() int {
+	return int(int16(r.u16()))
+}
+
+func (r *reader) u32() int {
+	hi := r.u16()
+	return hi<<16 | r.u16()
+}
+
+// offsets reads n 16-bit offsets relative to base.
+func (r *reader) offsets(n, base int) []int {
+	offsets := make([]int, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		offsets = append(offsets, base+r.u16())
+	}
+	return offsets
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+import "testing"
+
+func TestParseClassDef(t *testing.T) {
+	f := &Font{nGlyph: 10}
+	tests := []struct {
+		data  []byte
+		class []uint16 // classes of the glyphs 0 to 9 or nil for an error
+	}{
+		{[]byte{0, 1, 0, 2, 0, 3, 0, 1, 0, 2, 0, 1}, []uint16{0, 0, 1, 2, 1, 0, 0, 0, 0, 0}},
+		{[]byte{0, 2, 0, 1, 0, 5, 0, 7, 0, 3}, []uint16{0, 0, 0, 0, 0, 3, 3, 3, 0, 0}},
+		{[]byte{0, 1, 0, 2}, nil},
+		{[]byte{0, 1, 0, 2, 0, 3, 0, 1}, nil},
+		{[]byte{0, 2, 0, 1, 0, 5}, nil},
+		{[]byte{0, 3, 0, 0}, nil},
+	}
+	for i, test := range tests {
+		classes, err := f.parseClassDef(test.data, 0)
+		if test.class == nil {
+			if err == nil {
+				t.Errorf("%d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		for g, want := range test.class {
+			if got := classes.class(Index(g)); got != want {
+				t.Errorf("%d: class of glyph %d is %d, want %d", i, g, got, want)
+			}
+		}
+	}
+}
+
+func TestParseLayoutUnsupported(t *testing.T) {
+	f := &Font{nGlyph: 10}
+	data := []byte{
+		0, 1, 0, 0, 0, 10, 0, 12, 0, 14, // header
+		0, 0, // script list
+		0, 0, // feature list
+		0, 2, 0, 6, 0, 14, // lookup list
+		0, 9, 0, 0, 0, 1, 0, 16, // lookup of an unknown type
+		0, 1, 0, 0, 0, 1, 0, 14, // single substitution
+		0, 1, 0, 0, 0, 0, // subtable of the unknown lookup
+		0, 1, 0, 6, 0, 1, // single substitution format 1, delta 1
+		0, 1, 0, 1, 0, 3, // coverage of glyph 3
+	}
+	l, err := f.parseLayout("GSUB", data, f.parseGsubSubtable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.lookups) != 2 {
+		t.Fatalf("got %d lookups, want 2", len(l.lookups))
+	}
+	if n := len(l.lookups[0].subtables); n != 0 {
+		t.Errorf("unsupported lookup has %d subtables, want 0", n)
+	}
+	if n := len(l.lookups[1].subtables); n != 1 {
+		t.Errorf("single substitution has %d subtables, want 1", n)
+	}
+}
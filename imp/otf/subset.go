@@ -0,0 +1,234 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// ttfSubsetTables lists the tables which are required to embed a TrueType
+// font into a PDF document.
+var ttfSubsetTables = []string{"cvt ", "fpgm", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "prep"}
+
+// SubsetTTF returns a stripped down TrueType font which only contains the
+// outlines and metrics of the given glyphs and of all the components they
+// are composed of. Glyph indexes are kept stable, the outlines and metrics
+// of all other glyphs are left empty.
+func (f *Font) SubsetTTF(glyphs []Index) ([]byte, error) {
+	glyf, loca := f.tables["glyf"], f.tables["loca"]
+	if glyf == nil || loca == nil {
+		return nil, errorf("font doesn't contain TrueType outlines")
+	}
+	longLoca := int16(u16(f.head, 50)) != 0
+	offsets := make([]int, f.nGlyph+1)
+	for i := range offsets {
+		if longLoca {
+			if 4*i+4 > len(loca) {
+				return nil, errorf("loca block is too short (%d bytes)", len(loca))
+			}
+			offsets[i] = int(u32(loca, 4*i))
+		} else {
+			if 2*i+2 > len(loca) {
+				return nil, errorf("loca block is too short (%d bytes)", len(loca))
+			}
+			offsets[i] = 2 * int(u16(loca, 2*i))
+		}
+		if offsets[i] > len(glyf) || (i > 0 && offsets[i] < offsets[i-1]) {
+			return nil, errorf("invalid loca entry for glyph %d", i)
+		}
+	}
+
+	// collect all used glyphs including the components of composite glyphs
+	used := make([]bool, f.nGlyph)
+	queue := append([]Index{0}, glyphs...)
+	for len(queue) > 0 {
+		g := queue[0]
+		queue = queue[1:]
+		if int(g) >= f.nGlyph || used[g] {
+			continue
+		}
+		used[g] = true
+		components, err := glyphComponents(glyf[offsets[g]:offsets[g+1]])
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, components...)
+	}
+
+	newGlyf := &bytes.Buffer{}
+	newLoca := &bytes.Buffer{}
+	for g := 0; g < f.nGlyph; g++ {
+		binary.Write(newLoca, binary.BigEndian, uint32(newGlyf.Len()))
+		if used[g] {
+			newGlyf.Write(glyf[offsets[g]:offsets[g+1]])
+			for newGlyf.Len()%4 != 0 {
+				newGlyf.WriteByte(0)
+			}
+		}
+	}
+	binary.Write(newLoca, binary.BigEndian, uint32(newGlyf.Len()))
+
+	hhea, hmtx, err := f.subsetHmtx(used)
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, len(f.head))
+	copy(head, f.head)
+	head[8], head[9], head[10], head[11] = 0, 0, 0, 0 // checkSumAdjustment
+	head[50], head[51] = 0, 1                         // long loca format
+
+	tables := make(map[string][]byte)
+	for _, name := range ttfSubsetTables {
+		if data, ok := f.tables[name]; ok {
+			tables[name] = data
+		}
+	}
+	tables["glyf"] = newGlyf.Bytes()
+	tables["loca"] = newLoca.Bytes()
+	tables["head"] = head
+	tables["hhea"] = hhea
+	tables["hmtx"] = hmtx
+
+	data := writeSFNT(0x00010000, tables)
+	adjustment := 0xb1b0afba - ttfChecksum(data)
+	// locate the head table in the output again to patch the checksum
+	for i := 0; i < int(u16(data, 4)); i++ {
+		x := 12 + 16*i
+		if string(data[x:x+4]) == "head" {
+			binary.BigEndian.PutUint32(data[int(u32(data, x+8))+8:], adjustment)
+		}
+	}
+	return data, nil
+}
+
+// subsetHmtx returns the hhea and hmtx tables with the metrics of the used
+// glyphs. Long metrics are written up to the last used glyph, the glyphs
+// after it share its advance width and have a left side bearing of zero.
+func (f *Font) subsetHmtx(used []bool) (hhea, hmtx []byte, err error) {
+	orig := f.tables["hmtx"]
+	if f.nHMetric < 1 || len(orig) < 4*f.nHMetric+2*(f.nGlyph-f.nHMetric) {
+		return nil, nil, errorf("hmtx block is too short (%d bytes)", len(orig))
+	}
+	nHMetric := 1
+	for g := range used {
+		if used[g] {
+			nHMetric = g + 1
+		}
+	}
+	hmtx = make([]byte, 4*nHMetric+2*(f.nGlyph-nHMetric))
+	for g := 0; g < nHMetric; g++ {
+		switch {
+		case !used[g]:
+		case g < f.nHMetric:
+			copy(hmtx[4*g:], orig[4*g:4*g+4])
+		default:
+			copy(hmtx[4*g:], orig[4*f.nHMetric-4:4*f.nHMetric-2])
+			lsb := 4*f.nHMetric + 2*(g-f.nHMetric)
+			copy(hmtx[4*g+2:], orig[lsb:lsb+2])
+		}
+	}
+
+	hhea = make([]byte, len(f.tables["hhea"]))
+	copy(hhea, f.tables["hhea"])
+	binary.BigEndian.PutUint16(hhea[34:], uint16(nHMetric))
+	return hhea, hmtx, nil
+}
+
+// glyphComponents returns the glyphs referenced by a composite glyph.
+func glyphComponents(glyph []byte) ([]Index, error) {
+	const (
+		argsAreWords   = 0x0001
+		haveScale      = 0x0008
+		moreComponents = 0x0020
+		haveXYScale    = 0x0040
+		haveTwoByTwo   = 0x0080
+	)
+	if len(glyph) < 10 || int16(u16(glyph, 0)) >= 0 {
+		return nil, nil // empty or simple glyph
+	}
+	var components []Index
+	for offset := 10; ; {
+		if offset+4 > len(glyph) {
+			return nil, errorf("unexpected end of composite glyph")
+		}
+		flags := u16(glyph, offset)
+		components = append(components, Index(u16(glyph, offset+2)))
+		offset += 4
+		if flags&argsAreWords != 0 {
+			offset += 4
+		} else {
+			offset += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			offset += 2
+		case flags&haveXYScale != 0:
+			offset += 4
+		case flags&haveTwoByTwo != 0:
+			offset += 8
+		}
+		if flags&moreComponents == 0 {
+			return components, nil
+		}
+	}
+}
+
+// writeSFNT serializes a TrueType / OpenType font file containing the
+// given tables.
+func writeSFNT(version uint32, tables map[string][]byte) []byte {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entrySelector := 0
+	for 1<<uint(entrySelector+1) <= len(names) {
+		entrySelector++
+	}
+	searchRange := 16 << uint(entrySelector)
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, version)
+	binary.Write(buf, binary.BigEndian, uint16(len(names)))
+	binary.Write(buf, binary.BigEndian, uint16(searchRange))
+	binary.Write(buf, binary.BigEndian, uint16(entrySelector))
+	binary.Write(buf, binary.BigEndian, uint16(16*len(names)-searchRange))
+
+	offset := 12 + 16*len(names)
+	for _, name := range names {
+		data := tables[name]
+		buf.WriteString(name)
+		binary.Write(buf, binary.BigEndian, ttfChecksum(data))
+		binary.Write(buf, binary.BigEndian, uint32(offset))
+		binary.Write(buf, binary.BigEndian, uint32(len(data)))
+		offset += (len(data) + 3) &^ 3
+	}
+	for _, name := range names {
+		buf.Write(tables[name])
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	return buf.Bytes()
+}
+
+// ttfChecksum calculates the checksum of a table.
+func ttfChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var v uint32
+		for k := 0; k < 4; k++ {
+			v <<= 8
+			if i+k < len(data) {
+				v |= uint32(data[i+k])
+			}
+		}
+		sum += v
+	}
+	return sum
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package otf
+
+import (
+	"bytes"
+	"testing"
+)
+
+// cffProgram holds the parts of a CFF font program which are changed by
+// SubsetCFF.
+type cffProgram struct {
+	name        string
+	charStrings [][]byte
+	gsubrs      [][]byte
+	lsubrs      [][]byte
+}
+
+func parseCFFProgram(t *testing.T, data []byte) *cffProgram {
+	names, offset, err := parseCFFIndex(data, int(data[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topDicts, offset, err := parseCFFIndex(data, offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset, err = parseCFFIndex(data, offset); err != nil {
+		t.Fatal(err)
+	}
+	p := &cffProgram{name: string(names[0])}
+	if p.gsubrs, _, err = parseCFFIndex(data, offset); err != nil {
+		t.Fatal(err)
+	}
+	top, err := parseCFFDict(topDicts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.charStrings, _, err = parseCFFIndex(data, mustLookup(top, cffOpCharStrings)[0]); err != nil {
+		t.Fatal(err)
+	}
+	private, err := parseCFFPrivate(data, mustLookup(top, cffOpPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.lsubrs = private.subrs
+	return p
+}
+
+// compareSubrs checks that the subroutines which are still in use are kept
+// and that all other subroutines are replaced with a return operator.
+func compareSubrs(t *testing.T, kind string, orig, subset [][]byte) {
+	if len(subset) != len(orig) {
+		t.Fatalf("%s subroutines: got %d, want %d", kind, len(subset), len(orig))
+	}
+	kept, stubs := 0, 0
+	for i := range subset {
+		switch {
+		case bytes.Equal(subset[i], orig[i]):
+			kept++
+		case bytes.Equal(subset[i], []byte{11}):
+			stubs++
+		default:
+			t.Errorf("%s subroutine %d was modified", kind, i)
+		}
+	}
+	if len(orig) > 0 && (kept == 0 || stubs == 0) {
+		t.Errorf("%s subroutines: %d kept and %d stubs", kind, kept, stubs)
+	}
+}
+
+func TestSubsetCFF(t *testing.T) {
+	f, err := Open("../../fonts/SourceSansPro-Regular.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var glyphs []Index
+	for _, r := range "Hamburgefonstiv" {
+		glyphs = append(glyphs, f.Index(r))
+	}
+	cff, err := f.SubsetCFF(glyphs, "ABCDEF+"+f.PostscriptName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// embed the subset into the font again to check that it can be parsed
+	tables := make(map[string][]byte)
+	for name, data := range f.tables {
+		tables[name] = data
+	}
+	tables["CFF "] = cff
+	g, err := Parse(writeSFNT(0x4f54544f, tables))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig, subset := parseCFFProgram(t, f.CFF()), parseCFFProgram(t, g.CFF())
+	if want := "ABCDEF+" + f.PostscriptName; subset.name != want {
+		t.Errorf("name is %q, want %q", subset.name, want)
+	}
+	if len(subset.charStrings) != len(orig.charStrings) {
+		t.Fatalf("got %d glyphs, want %d", len(subset.charStrings), len(orig.charStrings))
+	}
+	used := map[Index]bool{0: true}
+	for _, g := range glyphs {
+		used[g] = true
+	}
+	for i, cs := range subset.charStrings {
+		switch {
+		case used[Index(i)] && !bytes.Equal(cs, orig.charStrings[i]):
+			t.Errorf("outline of glyph %d was modified", i)
+		case !used[Index(i)] && !bytes.Equal(cs, []byte{14}):
+			t.Errorf("unused glyph %d is not empty", i)
+		}
+	}
+	compareSubrs(t, "global", orig.gsubrs, subset.gsubrs)
+	compareSubrs(t, "local", orig.lsubrs, subset.lsubrs)
+
+	// all subroutines called by the remaining glyphs must still exist
+	for g := range used {
+		local := &cffPrivate{subrs: subset.lsubrs, used: make(map[int]bool)}
+		w := &charStringWalker{global: subset.gsubrs, local: local, usedG: make(map[int]bool)}
+		if _, err := w.walk(subset.charStrings[g]); err != nil {
+			t.Errorf("glyph %d: %v", g, err)
+		}
+		for n := range local.used {
+			if bytes.Equal(subset.lsubrs[n], []byte{11}) {
+				t.Errorf("glyph %d calls removed local subroutine %d", g, n)
+			}
+		}
+		for n := range w.usedG {
+			if bytes.Equal(subset.gsubrs[n], []byte{11}) {
+				t.Errorf("glyph %d calls removed global subroutine %d", g, n)
+			}
+		}
+	}
+}
+
+// simpleGlyph returns a fake outline which is distinct for every n.
+func simpleGlyph(n byte) []byte {
+	return []byte{0, 1, 0, 0, 0, 0, 0, n, 0, n, 0, 0}
+}
+
+// sfntTables reads the table directory of a font file and checks the
+// checksums of all tables.
+func sfntTables(t *testing.T, data []byte) map[string][]byte {
+	tables := make(map[string][]byte)
+	for i := 0; i < int(u16(data, 4)); i++ {
+		x := 12 + 16*i
+		name := string(data[x : x+4])
+		table, err := readTable(data, data[x+8:x+16])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := ttfChecksum(table)
+		if name == "head" {
+			sum -= u32(table, 8) // checksum adjustment
+		}
+		if sum != u32(data, x+4) {
+			t.Errorf("wrong checksum of the %q table", name)
+		}
+		tables[name] = table
+	}
+	return tables
+}
+
+// fakeGlyphs are the outlines of the glyphs 0 to 3 of fakeTTF. Glyph 3 is
+// composed of glyph 2.
+var fakeGlyphs = [][]byte{
+	simpleGlyph(0),
+	simpleGlyph(1),
+	simpleGlyph(2),
+	{0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0},
+}
+
+// fakeTTF returns a TrueType version of f and its tables. None of the
+// bundled fonts contains TrueType outlines, therefore the glyphs 0 to 3 get
+// fake outlines. Only the first nHMetric glyphs have long horizontal
+// metrics.
+func fakeTTF(t *testing.T, f *Font, nHMetric int) (*Font, map[string][]byte) {
+	glyf := &bytes.Buffer{}
+	loca := &bytes.Buffer{}
+	for i := 0; i <= f.nGlyph; i++ {
+		loca.Write([]byte{byte(glyf.Len() / 2 >> 8), byte(glyf.Len() / 2)})
+		if i < len(fakeGlyphs) {
+			glyf.Write(fakeGlyphs[i])
+		}
+	}
+	tables := make(map[string][]byte)
+	for name, data := range f.tables {
+		if name != "CFF " {
+			tables[name] = data
+		}
+	}
+	tables["head"] = append([]byte(nil), f.head...)
+	tables["head"][50], tables["head"][51] = 0, 0 // short loca format
+	tables["glyf"] = glyf.Bytes()
+	tables["loca"] = loca.Bytes()
+	if nHMetric < f.nHMetric {
+		hmtx := append([]byte(nil), f.tables["hmtx"][:4*nHMetric]...)
+		for g := nHMetric; g < f.nGlyph; g++ {
+			hmtx = append(hmtx, f.tables["hmtx"][4*g+2:4*g+4]...)
+		}
+		tables["hmtx"] = hmtx
+		tables["hhea"] = append([]byte(nil), f.tables["hhea"]...)
+		tables["hhea"][34], tables["hhea"][35] = byte(nHMetric>>8), byte(nHMetric)
+	}
+	ttf, err := Parse(writeSFNT(0x00010000, tables))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ttf, tables
+}
+
+func TestSubsetTTF(t *testing.T) {
+	f, err := Open("../../fonts/SourceSansPro-Regular.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.SubsetTTF([]Index{1}); err == nil {
+		t.Error("expected an error for a font with CFF outlines")
+	}
+
+	ttf, tables := fakeTTF(t, f, f.nHMetric)
+	data, err := ttf.SubsetTTF([]Index{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := ttfChecksum(data); sum != 0xb1b0afba {
+		t.Errorf("checksum of the font is 0x%x, want 0xb1b0afba", sum)
+	}
+	subset := sfntTables(t, data)
+	for _, name := range []string{"cmap", "name", "GSUB", "CFF "} {
+		if subset[name] != nil {
+			t.Errorf("subset contains the %q table", name)
+		}
+	}
+
+	// add the remaining tables again to check that the subset can be parsed
+	for name, data := range tables {
+		if subset[name] == nil {
+			subset[name] = data
+		}
+	}
+	g, err := Parse(writeSFNT(0x00010000, subset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.NumGlyphs() != f.NumGlyphs() {
+		t.Fatalf("got %d glyphs, want %d", g.NumGlyphs(), f.NumGlyphs())
+	}
+	glyf2, loca2 := g.tables["glyf"], g.tables["loca"]
+	if len(loca2) != 4*(f.nGlyph+1) {
+		t.Fatalf("loca table has %d bytes, want %d", len(loca2), 4*(f.nGlyph+1))
+	}
+	for i := 0; i < f.nGlyph; i++ {
+		outline := glyf2[u32(loca2, 4*i):u32(loca2, 4*i+4)]
+		var want []byte
+		switch i {
+		case 0, 2, 3: // notdef, the composite glyph and its component
+			want = fakeGlyphs[i]
+		}
+		if !bytes.Equal(outline, want) {
+			t.Errorf("glyph %d: outline is %v, want %v", i, outline, want)
+		}
+	}
+}
+
+func TestSubsetTTFMetrics(t *testing.T) {
+	f, err := Open("../../fonts/SourceSansPro-Regular.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// glyph 3 has long metrics or shares the advance width of glyph 1
+	for _, n := range []int{f.nHMetric, 2} {
+		ttf, tables := fakeTTF(t, f, n)
+		data, err := ttf.SubsetTTF([]Index{3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		subset := sfntTables(t, data)
+		if got := u16(subset["hhea"], 34); got != 4 {
+			t.Errorf("%d long metrics: the subset has %d long metrics, want 4", n, got)
+		}
+		if want := 4*4 + 2*(f.nGlyph-4); len(subset["hmtx"]) != want {
+			t.Errorf("%d long metrics: hmtx has %d bytes, want %d", n, len(subset["hmtx"]), want)
+		}
+		for name, data := range tables {
+			if subset[name] == nil {
+				subset[name] = data
+			}
+		}
+		g, err := Parse(writeSFNT(0x00010000, subset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 4; i++ {
+			var want HMetric
+			if i != 1 {
+				want = ttf.HMetric(Index(i))
+				if i >= n {
+					want.Left = int(u16(tables["hmtx"], 4*n+2*(i-n)))
+				}
+			}
+			if got := g.HMetric(Index(i)); got != want {
+				t.Errorf("%d long metrics: glyph %d has the metrics %v, want %v", n, i, got, want)
+			}
+		}
+		// the glyphs after the last used one only have a left side bearing
+		if !bytes.Equal(subset["hmtx"][16:], make([]byte, 2*(f.nGlyph-4))) {
+			t.Errorf("%d long metrics: the metrics of the unused glyphs are kept", n)
+		}
+		if w := g.HMetric(3).Width; w == 0 || w != f.HMetric(1).Width && n == 2 {
+			t.Errorf("%d long metrics: glyph 3 has the advance width %d", n, w)
+		}
+	}
+}
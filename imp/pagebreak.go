@@ -0,0 +1,162 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"math"
+)
+
+// infPenalty prohibits a column or page break.
+const infPenalty = 10000
+
+// BreakPages places column and page breaks. Lines are moved to the next
+// column or page when they do not fit anymore. The break is chosen among
+// the preceding lines, considering the remaining space and the widow and
+// orphan penalties. Paragraphs which should be kept with the next one are
+// never separated from it, unless there is no other choice.
+func (m *Imp) BreakPages(tokens []Token, top float64, bottom func(page int) float64) []Token {
+	type line struct {
+		start, end int // tokens of the line and the index of its terminator
+		content    bool
+		index, n   int // position within the paragraph and number of lines
+	}
+	var lines []line
+	par := 0
+	for start := 0; start < len(tokens); {
+		end := start
+		for end < len(tokens) && !isLineEnd(tokens[end]) {
+			end++
+		}
+		l := line{start: start, end: end, index: len(lines) - par}
+		for _, tok := range tokens[start:end] {
+			switch tok.(type) {
+			case Text, Space, Inline:
+				l.content = true
+			}
+		}
+		lines = append(lines, l)
+		if end >= len(tokens) || !isLineBreak(tokens[end]) {
+			for k := par; k < len(lines); k++ {
+				lines[k].n = len(lines) - par
+			}
+			par = len(lines)
+		}
+		start = end + 1
+	}
+
+	breaks := make(map[int]Token)
+	s := m.State.Clone()
+	page := 0
+	s.YPos = top - maxAscent(s.Clone(), tokens)
+	s.ColStart = s.YPos
+	best, bestCost, bestState := -1, math.Inf(1), (*State)(nil)
+	placed := 0
+	for k := 0; k < len(lines); k++ {
+		l := lines[k]
+		if l.content && placed > 0 && s.YPos < bottom(page) {
+			if best < 0 {
+				best, bestState = k-1, s
+			}
+			var tok Token
+			s = bestState.Clone()
+			if s.Column+1 < s.Columns {
+				tok = ColBreak{}
+				s.nextColumn()
+			} else {
+				tok = PageBreak{}
+				page++
+				s.Column = 0
+				s.YPos = top - maxAscent(s.Clone(), tokens[lines[best].end+1:])
+				s.ColStart = s.YPos
+			}
+			breaks[lines[best].end] = tok
+			k = best
+			best, bestCost, bestState, placed = -1, math.Inf(1), nil, 0
+			continue
+		}
+
+		for _, tok := range tokens[l.start:l.end] {
+			GetWidth(s, tok)
+		}
+		if l.content {
+			placed++
+		}
+		if l.end >= len(tokens) {
+			break
+		}
+		penalty := 0.0
+		switch tokens[l.end].(type) {
+		case LineBreak:
+			if l.index == 0 {
+				penalty += s.OrphanPenalty
+			}
+			if l.index == l.n-2 {
+				penalty += s.WidowPenalty
+			}
+			s.YPos -= s.LineHeight * s.Size
+		case ParagraphBreak:
+			if s.KeepWithNext {
+				penalty = infPenalty
+			}
+			s.KeepWithNext = false
+			s.YPos -= s.LineHeight * s.Size * s.ParSkip
+		case ColBreak:
+			if s.Column+1 < s.Columns {
+				s.nextColumn()
+			} else {
+				breaks[l.end] = PageBreak{}
+				page++
+				s.Column = 0
+				s.YPos = top - maxAscent(s.Clone(), tokens[l.end+1:])
+				s.ColStart = s.YPos
+			}
+			best, bestCost, bestState, placed = -1, math.Inf(1), nil, 0
+			continue
+		}
+		if penalty < infPenalty {
+			f := (s.YPos - bottom(page)) / (top - bottom(page))
+			if cost := penalty + 100*math.Abs(f*f*f); cost <= bestCost {
+				best, bestCost, bestState = k, cost, s.Clone()
+			}
+		}
+	}
+
+	ntokens := make([]Token, 0, len(tokens)+len(breaks))
+	for i, tok := range tokens {
+		b, ok := breaks[i]
+		if _, col := tok.(ColBreak); !ok || !col {
+			ntokens = append(ntokens, tok)
+		}
+		if ok {
+			ntokens = append(ntokens, b)
+		}
+	}
+	return ntokens
+}
+
+func isLineBreak(t Token) bool {
+	_, ok := t.(LineBreak)
+	return ok
+}
+
+func (m *Imp) CalcMaxAscent(line []Token) float64 {
+	return maxAscent(m.State.Clone(), line)
+}
+
+func maxAscent(s *State, line []Token) float64 {
+	ascent := 0.0
+	for _, tok := range line {
+		GetWidth(s, tok)
+		switch tok.(type) {
+		case LineBreak, ParagraphBreak:
+			return ascent
+		case Text, Space, Inline:
+			a := float64(s.Font.Scale(s.Font.Ascender, 1000)) / 1000 * s.Size
+			if a > ascent {
+				ascent = a
+			}
+		}
+	}
+	return ascent
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// breakPages breaks a test document into pages of the given height.
+func breakPages(t *testing.T, text string, height float64) (*Imp, []Token) {
+	m, tokens := splitLines(t, text, 1000)
+	return m, m.BreakPages(tokens, height, func(int) float64 { return 0 })
+}
+
+// widowsAndOrphans counts the pages which start with the last line of a
+// paragraph or end with its first line. The lines of the paragraphs are
+// called first, mid and last.
+func widowsAndOrphans(tokens []Token) (widows, orphans int) {
+	var last Text
+	broken := false
+	for _, tok := range tokens {
+		switch tok := tok.(type) {
+		case Text:
+			if broken && tok == "last" {
+				widows++
+			}
+			last, broken = tok, false
+		case PageBreak, ColBreak:
+			if last == "first" {
+				orphans++
+			}
+			broken = true
+		}
+	}
+	return widows, orphans
+}
+
+func TestWidowsAndOrphans(t *testing.T) {
+	par := `first\break mid\break mid\break mid\break last\par `
+	text := "A\\par " + strings.Repeat(par, 6)
+	count := func(penalties string) (widows, orphans int) {
+		for height := 100.0; height <= 300; height += 4 {
+			_, tokens := breakPages(t, penalties+text, height)
+			w, o := widowsAndOrphans(tokens)
+			widows, orphans = widows+w, orphans+o
+		}
+		return widows, orphans
+	}
+	if w, o := count(`\widowpenalty{0}\orphanpenalty{0}`); w == 0 || o == 0 {
+		t.Errorf("without penalties: got %d widows and %d orphans, want some", w, o)
+	}
+	if w, _ := count(`\widowpenalty{10000}\orphanpenalty{0}`); w != 0 {
+		t.Errorf("got %d widows", w)
+	}
+	if _, o := count(`\widowpenalty{0}\orphanpenalty{10000}`); o != 0 {
+		t.Errorf("got %d orphans", o)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	text := strings.Repeat(`line\break `, 30)
+	for _, test := range []struct {
+		macro   string
+		columns int
+	}{
+		{`\column `, 2},
+		{`\columns{1}`, 1},
+		{`\columns{3}`, 3},
+	} {
+		m, tokens := breakPages(t, test.macro+text, 100)
+		if len(m.Diagnostics) > 0 {
+			t.Errorf("%s: %v", test.macro, m.Diagnostics)
+		}
+		columns := 1
+		for _, tok := range tokens {
+			if _, ok := tok.(PageBreak); ok {
+				break
+			}
+			if _, ok := tok.(ColBreak); ok {
+				columns++
+			}
+		}
+		if columns != test.columns {
+			t.Errorf("%s: got %d columns on the first page, want %d", test.macro, columns, test.columns)
+		}
+	}
+
+	// the width of the columns does not depend on the previous columns
+	s := &State{TextWidth: 300, MaxWidth: 300}
+	s.setColumns(2)
+	s.setColumns(1)
+	if s.MaxWidth != 300 {
+		t.Errorf(`width after \columns{2}\columns{1} is %v, want 300`, s.MaxWidth)
+	}
+	s.beginGroup()
+	s.setColumns(2)
+	s.beginGroup()
+	s.setColumns(2)
+	if want := 300 * (1 - columnGap) / 2; s.MaxWidth != want {
+		t.Errorf("width in nested groups is %v, want %v", s.MaxWidth, want)
+	}
+
+	m, _ := breakPages(t, `\columns{0}`+text, 100)
+	if len(m.Diagnostics) != 1 || m.Diagnostics[0].Message != `\columns: invalid number of columns "0"` {
+		t.Errorf("got diagnostics %v", m.Diagnostics)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	d := newTestDocument(t)
+	d.AddText(`{\large\german\blue\columns{2}\raggedright text} text`)
+	m := newTestImp(d, 300)
+	tokens, err := d.tokens(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := m.State.Clone()
+	for _, tok := range tokens {
+		GetWidth(s, tok)
+		if _, ok := tok.(Text); ok && s.Columns != 2 {
+			t.Errorf("the group does not set the columns")
+		}
+		if _, ok := tok.(EndGroup); ok {
+			break
+		}
+	}
+	if s.Font != m.State.Font || s.Size != 12 || s.Language != "" || s.Color != m.State.Color || !s.Justify {
+		t.Errorf("the style is not restored at the end of the group: %+v", s)
+	}
+	if s.Columns != 0 || s.MaxWidth != 300 {
+		t.Errorf("got %d columns of width %v at the end of the group, want the text width", s.Columns, s.MaxWidth)
+	}
+
+	// the text after the group continues below the longest column
+	for _, bottom := range []float64{500, 400} {
+		s := &State{TextWidth: 300, MaxWidth: 300, YPos: 700}
+		s.beginGroup()
+		s.setColumns(2)
+		s.YPos = 500
+		s.nextColumn()
+		s.YPos = bottom
+		s.endGroup()
+		if s.Columns != 0 || s.MaxWidth != 300 || s.Column != 0 || s.YPos != math.Min(500, bottom) || s.ColStart != s.YPos {
+			t.Errorf("bottom %v: got column %d of %d with width %v at %v (column start %v)",
+				bottom, s.Column, s.Columns, s.MaxWidth, s.YPos, s.ColStart)
+		}
+	}
+
+	// a group which does not change the columns stays in the column
+	s = &State{TextWidth: 300, MaxWidth: 300, YPos: 700}
+	s.setColumns(2)
+	s.beginGroup()
+	s.YPos = 500
+	s.nextColumn()
+	s.endGroup()
+	if s.Column != 1 || s.YPos != 700 {
+		t.Errorf("got column %d at %v, want column 1 at 700", s.Column, s.YPos)
+	}
+
+	for _, test := range []struct {
+		text string
+		want Diagnostic
+	}{
+		{"a } b", Diagnostic{2, "unexpected }"}},
+		{"a { b", Diagnostic{2, "unclosed {"}},
+		{"{a} {b", Diagnostic{4, "unclosed {"}},
+	} {
+		m, _ := splitLines(t, test.text, 300)
+		if len(m.Diagnostics) != 1 || m.Diagnostics[0] != test.want {
+			t.Errorf("%q: got diagnostics %v, want %v", test.text, m.Diagnostics, test.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// An Object is a value of the PDF object model.
+type Object interface {
+	writeObject(buf *bytes.Buffer)
+}
+
+// A Number is an integer or real number.
+type Number float64
+
+// A Bool is a boolean value.
+type Bool bool
+
+// A Name is an atomic symbol, like /Type. The name is stored without the
+// leading slash and escaped when it is written.
+type Name string
+
+// A String is a sequence of bytes. Strings consisting of printable ASCII
+// characters are written as literal strings, all others as hexadecimal
+// strings.
+type String string
+
+// An Array is a sequence of objects.
+type Array []Object
+
+// A Dict maps names to objects.
+type Dict map[Name]Object
+
+// A Ref is a reference to the indirect object with the given id.
+type Ref int
+
+// A Stream is a dictionary followed by a sequence of bytes. The /Length
+// entry is added automatically. Streams can only be written as indirect
+// objects.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// TextString returns a string which is used for text, like the title of a
+// document. Text containing non-ASCII characters is encoded in UTF-16.
+func TextString(s string) String {
+	ascii := true
+	for _, r := range s {
+		if r >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return String(s)
+	}
+	buf := []byte{0xfe, 0xff}
+	for _, c := range utf16.Encode([]rune(s)) {
+		buf = append(buf, byte(c>>8), byte(c))
+	}
+	return String(buf)
+}
+
+// format returns the serialized representation of an object.
+func format(obj Object) string {
+	buf := &bytes.Buffer{}
+	obj.writeObject(buf)
+	return buf.String()
+}
+
+func (n Number) writeObject(buf *bytes.Buffer) {
+	v := float64(n)
+	if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+		buf.WriteString(strconv.FormatInt(int64(v), 10))
+		return
+	}
+	s := strconv.FormatFloat(v, 'f', 4, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	buf.WriteString(s)
+}
+
+func (b Bool) writeObject(buf *bytes.Buffer) {
+	buf.WriteString(strconv.FormatBool(bool(b)))
+}
+
+func (n Name) writeObject(buf *bytes.Buffer) {
+	buf.WriteByte('/')
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if c < 0x21 || c > 0x7e || c == '#' || isDelimiter(c) {
+			fmt.Fprintf(buf, "#%02x", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (s String) writeObject(buf *bytes.Buffer) {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			fmt.Fprintf(buf, "<%x>", string(s))
+			return
+		}
+	}
+	buf.WriteByte('(')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '(', ')', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte(')')
+}
+
+func (a Array) writeObject(buf *bytes.Buffer) {
+	buf.WriteByte('[')
+	for i, obj := range a {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		obj.writeObject(buf)
+	}
+	buf.WriteByte(']')
+}
+
+func (d Dict) writeObject(buf *bytes.Buffer) {
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, string(k))
+	}
+	// the type is written first to make the output more readable
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == "Type") != (keys[j] == "Type") {
+			return keys[i] == "Type"
+		}
+		return keys[i] < keys[j]
+	})
+	buf.WriteString("<<")
+	for _, k := range keys {
+		buf.WriteByte(' ')
+		Name(k).writeObject(buf)
+		buf.WriteByte(' ')
+		d[Name(k)].writeObject(buf)
+	}
+	buf.WriteString(" >>")
+}
+
+func (r Ref) writeObject(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "%d 0 R", int(r))
+}
+
+func (s *Stream) writeObject(buf *bytes.Buffer) {
+	d := make(Dict, len(s.Dict)+1)
+	for k, v := range s.Dict {
+		d[k] = v
+	}
+	d["Length"] = Number(len(s.Data))
+	d.writeObject(buf)
+	buf.WriteString("\nstream\n")
+	buf.Write(s.Data)
+	buf.WriteString("\nendstream")
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package pdf
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		obj  Object
+		want string
+	}{
+		{Number(42), "42"},
+		{Number(-3), "-3"},
+		{Number(0.5), "0.5"},
+		{Number(1.0 / 3), "0.3333"},
+		{Bool(true), "true"},
+
+		// names escape white space, delimiters, # and non-ASCII bytes
+		{Name("Type"), "/Type"},
+		{Name("A B"), "/A#20B"},
+		{Name("A/B"), "/A#2fB"},
+		{Name("A#B"), "/A#23B"},
+		{Name("(x)[y]<z>{w}%"), "/#28x#29#5by#5d#3cz#3e#7bw#7d#25"},
+		{Name("Größe"), "/Gr#c3#b6#c3#9fe"},
+		{Name("Adobe-Identity_0"), "/Adobe-Identity_0"},
+		{Name(""), "/"},
+
+		// parentheses and backslashes are escaped in literal strings
+		{String("Hello World"), "(Hello World)"},
+		{String("(balanced)"), `(\(balanced\))`},
+		{String("a (b (c)) d"), `(a \(b \(c\)\) d)`},
+		{String("unbalanced ("), `(unbalanced \()`},
+		{String(") unbalanced"), `(\) unbalanced)`},
+		{String(`C:\dir\`), `(C:\\dir\\)`},
+		{String(`\(`), `(\\\()`},
+		{String(""), "()"},
+		// all other strings are written as hexadecimal strings
+		{String("line\n"), "<6c696e650a>"},
+		{String("\xfe\xff"), "<feff>"},
+		{TextString("Größe"), "<feff0047007200f600df0065>"},
+		{TextString("Size (pt)"), `(Size \(pt\))`},
+
+		{Array{}, "[]"},
+		{Array{Number(1), Name("A"), String("b")}, "[1 /A (b)]"},
+		{Dict{}, "<< >>"},
+		{Dict{"Size": Number(2), "A B": Ref(3), "Type": Name("Page")}, "<< /Type /Page /A#20B 3 0 R /Size 2 >>"},
+		{Ref(7), "7 0 R"},
+	}
+	for _, test := range tests {
+		if got := format(test.obj); got != test.want {
+			t.Errorf("%#v: got %s, want %s", test.obj, got, test.want)
+		}
+	}
+}
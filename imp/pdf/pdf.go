@@ -6,29 +6,54 @@ package pdf
 import (
 	"bufio"
 	"bytes"
+	"compress/zlib"
 	"crypto/md5"
-	"encoding/ascii85"
 	"encoding/binary"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"io"
-	"math"
 	"time"
 	"unicode"
+	"unicode/utf16"
 
 	"github.com/tux21b/imp/imp/otf"
 )
 
 type PDFWriter struct {
-	w    *bufio.Writer
-	pos  int
-	err  error
-	xref []int
+	// Compress enables the FlateDecode compression of content, font and
+	// CMap streams.
+	Compress bool
+
+	// ObjectStreams enables the output of PDF 1.5 documents. Objects
+	// without streams are packed into object streams and the
+	// cross-reference table is written as a stream.
+	ObjectStreams bool
+
+	w      *bufio.Writer
+	pos    int
+	err    error
+	xref   []xrefEntry
+	objStm objectStream
 
 	inTJ bool
 }
 
+type xrefEntry struct {
+	offset int // position of the object or its index in the object stream
+	stream int // id of the object stream containing the object or 0
+}
+
+// maxObjStm is the maximum number of objects per object stream.
+const maxObjStm = 100
+
+// An objectStream collects objects until they are written.
+type objectStream struct {
+	ids     []int
+	offsets []int
+	buf     bytes.Buffer
+}
+
 func NewPDFWriter(out io.Writer) *PDFWriter {
 	return &PDFWriter{w: bufio.NewWriter(out)}
 }
@@ -43,22 +68,11 @@ func (w *PDFWriter) WriteString(s string) (int, error) {
 	return n, w.err
 }
 
-func (w *PDFWriter) WriteStreamPlain(s string) error {
-	if w.err != nil {
-		return w.err
-	}
-	fmt.Fprintf(w, "<< /Length %d >>\n", len(s))
-	w.WriteString("stream\n")
-	w.WriteString(s)
-	w.WriteString("\nendstream\n")
-	return w.err
-}
-
 func (w *PDFWriter) WriteObjectStart(id int) int {
 	if id <= 0 {
 		id = w.NextID()
 	}
-	w.xref[id-1] = w.pos
+	w.xref[id-1] = xrefEntry{offset: w.pos}
 	fmt.Fprintf(w, "%d 0 obj\n", id)
 	return id
 }
@@ -67,49 +81,154 @@ func (w *PDFWriter) WriteObjectEnd() {
 	w.WriteString("endobj\n")
 }
 
-func (w *PDFWriter) WriteObjectf(id int, format string, args ...interface{}) int {
-	id = w.WriteObjectStart(id)
-	fmt.Fprintf(w, format, args...)
+// WriteObject writes obj as the indirect object with the given id or with
+// a newly allocated id if id is 0. Streams are compressed if Compress is
+// set and do not have a filter yet. In PDF 1.5 mode, all other objects are
+// collected in object streams.
+func (w *PDFWriter) WriteObject(id int, obj Object) int {
+	if id <= 0 {
+		id = w.NextID()
+	}
+	if s, ok := obj.(*Stream); ok {
+		obj = w.compress(s)
+	} else if w.ObjectStreams {
+		o := &w.objStm
+		o.ids = append(o.ids, id)
+		o.offsets = append(o.offsets, o.buf.Len())
+		obj.writeObject(&o.buf)
+		o.buf.WriteString("\n")
+		if len(o.ids) >= maxObjStm {
+			w.flushObjectStream()
+		}
+		return id
+	}
+	w.WriteObjectStart(id)
+	w.WriteString(format(obj))
 	w.WriteString("\n")
 	w.WriteObjectEnd()
 	return id
 }
 
+func (w *PDFWriter) compress(s *Stream) *Stream {
+	if _, ok := s.Dict["Filter"]; ok || !w.Compress {
+		return s
+	}
+	buf := &bytes.Buffer{}
+	zw, _ := zlib.NewWriterLevel(buf, zlib.BestCompression)
+	zw.Write(s.Data)
+	zw.Close()
+	d := make(Dict, len(s.Dict)+1)
+	for k, v := range s.Dict {
+		d[k] = v
+	}
+	d["Filter"] = Name("FlateDecode")
+	return &Stream{Dict: d, Data: buf.Bytes()}
+}
+
+// flushObjectStream writes the collected objects as an object stream.
+func (w *PDFWriter) flushObjectStream() {
+	o := &w.objStm
+	if len(o.ids) == 0 {
+		return
+	}
+	id := w.NextID()
+	data := &bytes.Buffer{}
+	for i := range o.ids {
+		w.xref[o.ids[i]-1] = xrefEntry{offset: i, stream: id}
+		fmt.Fprintf(data, "%d %d ", o.ids[i], o.offsets[i])
+	}
+	data.WriteString("\n")
+	first := data.Len()
+	data.Write(o.buf.Bytes())
+
+	w.WriteObject(id, &Stream{
+		Dict: Dict{
+			"Type":  Name("ObjStm"),
+			"N":     Number(len(o.ids)),
+			"First": Number(first),
+		},
+		Data: data.Bytes(),
+	})
+	o.ids, o.offsets = o.ids[:0], o.offsets[:0]
+	o.buf.Reset()
+}
+
 func (w *PDFWriter) NextID() int {
-	w.xref = append(w.xref, 0)
+	w.xref = append(w.xref, xrefEntry{})
 	return len(w.xref)
 }
 
 func (w *PDFWriter) WriteHeader() {
-	w.WriteString("%PDF-1.4\n")
+	if w.ObjectStreams {
+		w.WriteString("%PDF-1.5\n")
+	} else {
+		w.WriteString("%PDF-1.4\n")
+	}
 	w.WriteString("%âãÏÓ\n")
 }
 
 func (w *PDFWriter) WriteFooter(root, info int) {
+	h := md5.New()
+	binary.Write(h, binary.BigEndian, time.Now().UnixNano())
+	id := String(h.Sum(nil))
+	trailer := Dict{
+		"Info": Ref(info),
+		"Root": Ref(root),
+		"ID":   Array{id, id},
+	}
+
+	if w.ObjectStreams {
+		w.writeXRefStream(trailer)
+		return
+	}
+
 	startxref := w.pos
 	fmt.Fprintf(w, "xref\n0 %d\n0000000000 65535 f \n", len(w.xref)+1)
-	for _, pos := range w.xref {
-		fmt.Fprintf(w, "%010d 00000 n \n", pos)
+	for _, e := range w.xref {
+		fmt.Fprintf(w, "%010d 00000 n \n", e.offset)
+	}
+	trailer["Size"] = Number(len(w.xref) + 1)
+	fmt.Fprintf(w, "trailer\n%s\n", format(trailer))
+	fmt.Fprintf(w, "startxref\n%d\n", startxref)
+	w.WriteString("%%EOF\n")
+	w.w.Flush()
+}
+
+// writeXRefStream finishes a PDF 1.5 document with a cross-reference stream
+// instead of the cross-reference table and trailer.
+func (w *PDFWriter) writeXRefStream(trailer Dict) {
+	w.flushObjectStream()
+	xref := w.NextID()
+	startxref := w.pos
+	w.xref[xref-1] = xrefEntry{offset: startxref}
+
+	data := &bytes.Buffer{}
+	data.Write([]byte{0, 0, 0, 0, 0, 0xff, 0xff})
+	for _, e := range w.xref {
+		if e.stream > 0 {
+			data.WriteByte(2)
+			binary.Write(data, binary.BigEndian, uint32(e.stream))
+			binary.Write(data, binary.BigEndian, uint16(e.offset))
+		} else {
+			data.WriteByte(1)
+			binary.Write(data, binary.BigEndian, uint32(e.offset))
+			binary.Write(data, binary.BigEndian, uint16(0))
+		}
 	}
-	w.WriteString("trailer\n")
 
-	h := md5.New()
-	binary.Write(h, binary.BigEndian, time.Now().UnixNano())
-	id := h.Sum(nil)
-
-	fmt.Fprintf(w, `<<
-  /Size %d
-  /Info %d 0 R
-  /Root %d 0 R
-  /ID [<%x> <%x>]
->>
-`, len(w.xref)+1, info, root, id, id)
+	trailer["Type"] = Name("XRef")
+	trailer["Size"] = Number(len(w.xref) + 1)
+	trailer["W"] = Array{Number(1), Number(4), Number(2)}
+	w.WriteObject(xref, &Stream{Dict: trailer, Data: data.Bytes()})
 	fmt.Fprintf(w, "startxref\n%d\n", startxref)
 	w.WriteString("%%EOF\n")
 	w.w.Flush()
 }
 
-func (w *PDFWriter) WriteFontEmbedded(id int, f *otf.Font) {
+// WriteFontEmbedded writes the font f together with all its descendant
+// objects. If glyphs is not nil, only a subset of the font containing those
+// glyphs is embedded and the font name is prefixed with a subset tag.
+func (w *PDFWriter) WriteFontEmbedded(id int, f *otf.Font, glyphs []otf.Index) {
 	var (
 		fontBase       = id
 		fontDescedant  = w.NextID()
@@ -118,114 +237,147 @@ func (w *PDFWriter) WriteFontEmbedded(id int, f *otf.Font) {
 		fontUnicode    = w.NextID()
 	)
 
-	name := encodeName(f.PostscriptName)
-	cff := f.CFF()
+	psName := f.PostscriptName
+	if glyphs != nil {
+		psName = subsetTag(psName, glyphs) + "+" + psName
+	}
+	name := Name(psName)
+	cff, ttf := f.CFF(), f.TTF()
+	if glyphs != nil {
+		var err error
+		if cff != nil {
+			cff, err = f.SubsetCFF(glyphs, psName)
+		} else {
+			ttf, err = f.SubsetTTF(glyphs)
+		}
+		if err != nil {
+			w.err = err
+			return
+		}
+	} else {
+		glyphs = make([]otf.Index, f.NumGlyphs())
+		for i := range glyphs {
+			glyphs[i] = otf.Index(i)
+		}
+	}
 
 	// base font object
-	w.WriteObjectf(fontBase, `<<
-  /Type /Font
-  /Subtype /Type0
-  /BaseFont %s
-  /Encoding /Identity-H
-  /ToUnicode %d 0 R
-  /DescendantFonts [%d 0 R]
->>`, name, fontUnicode, fontDescedant)
+	w.WriteObject(fontBase, Dict{
+		"Type":            Name("Font"),
+		"Subtype":         Name("Type0"),
+		"BaseFont":        name,
+		"Encoding":        Name("Identity-H"),
+		"ToUnicode":       Ref(fontUnicode),
+		"DescendantFonts": Array{Ref(fontDescedant)},
+	})
 
 	// font descedant
-	widths := make([]int, f.NumGlyphs())
-	for i := 0; i < len(widths); i++ {
-		widths[i] = f.Scale(f.HMetric(otf.Index(i)).Width, 1000)
+	var widths, run Array
+	for i := 0; i < len(glyphs); i++ {
+		if i == 0 || glyphs[i] != glyphs[i-1]+1 {
+			if i > 0 {
+				widths = append(widths, run)
+			}
+			widths = append(widths, Number(glyphs[i]))
+			run = nil
+		}
+		run = append(run, Number(f.Scale(f.HMetric(glyphs[i]).Width, 1000)))
+	}
+	if len(glyphs) > 0 {
+		widths = append(widths, run)
 	}
-	fontType := 2
+	subtype := Name("CIDFontType2")
 	if cff != nil {
-		fontType = 0
+		subtype = "CIDFontType0"
 	}
-	w.WriteObjectf(fontDescedant, `<<
-  /Type /Font
-  /Subtype /CIDFontType%d
-  /BaseFont %s
-  /CIDSystemInfo
-  <<
-    /Registry (Adobe)
-    /Ordering (Identity)
-    /Supplement 0
-  >>
-  /DW %d
-  /W [0 %v]
-  /FontDescriptor %d 0 R
->>`, fontType, name, widths[0], widths, fontDescriptor)
+	w.WriteObject(fontDescedant, Dict{
+		"Type":     Name("Font"),
+		"Subtype":  subtype,
+		"BaseFont": name,
+		"CIDSystemInfo": Dict{
+			"Registry":   String("Adobe"),
+			"Ordering":   String("Identity"),
+			"Supplement": Number(0),
+		},
+		"DW":             Number(f.Scale(f.HMetric(0).Width, 1000)),
+		"W":              widths,
+		"FontDescriptor": Ref(fontDescriptor),
+	})
 
 	// font descriptor
-	fontFile := 2
+	fontFile := Name("FontFile2")
 	if cff != nil {
-		fontFile = 3
+		fontFile = "FontFile3"
 	}
 	flags := 0
 	if f.ItalicAngle != 0 {
 		flags |= 0x40 // italic
 	}
 	flags |= 0x20 // non-symbolic font
-	w.WriteObjectf(fontDescriptor, `<<
-  /Type /FontDescriptor
-  /FontName %s
-  /Ascent %d
-  /Descent %d
-  /CapHeight %d
-  /FontBBox [%d %d %d %d]
-  /ItalicAngle %.4f
-  /Flags %d
-  /StemV 0
-  /FontFile%d %d 0 R
->>`, name, f.Scale(f.Ascender, 1000), f.Scale(f.Descender, 1000),
-		f.Scale(f.CapHeight, 1000), f.Scale(f.XMin, 1000),
-		f.Scale(f.YMin, 1000), f.Scale(f.XMax, 1000),
-		f.Scale(f.YMax, 1000), f.ItalicAngle, flags, fontFile, fontStream)
+	w.WriteObject(fontDescriptor, Dict{
+		"Type":      Name("FontDescriptor"),
+		"FontName":  name,
+		"Ascent":    Number(f.Scale(f.Ascender, 1000)),
+		"Descent":   Number(f.Scale(f.Descender, 1000)),
+		"CapHeight": Number(f.Scale(f.CapHeight, 1000)),
+		"FontBBox": Array{
+			Number(f.Scale(f.XMin, 1000)), Number(f.Scale(f.YMin, 1000)),
+			Number(f.Scale(f.XMax, 1000)), Number(f.Scale(f.YMax, 1000)),
+		},
+		"ItalicAngle": Number(f.ItalicAngle),
+		"Flags":       Number(flags),
+		"StemV":       Number(0),
+		fontFile:      Ref(fontStream),
+	})
 
 	// font stream
-	w.WriteObjectStart(fontStream)
-	streamBuf := &bytes.Buffer{}
-	enc := ascii85.NewEncoder(streamBuf)
-	enc.Write(cff)
-	enc.Close()
-	fontStreamBytes := streamBuf.Bytes()
-
 	if cff == nil {
-		ttf := f.TTF()
-		fmt.Fprintf(w, "<< /Length %d /Length1 %d >>\n", len(ttf), len(ttf))
-		fmt.Fprintf(w, "stream\n%s\nendstream\n", ttf)
+		w.WriteObject(fontStream, &Stream{
+			Dict: Dict{"Length1": Number(len(ttf))},
+			Data: ttf,
+		})
 	} else {
-		fmt.Fprintf(w, "<< /Length %d /Length1 %d /Filter /ASCII85Decode /Subtype /CIDFontType0C >>\n", len(fontStreamBytes), len(cff)) // CIDType0C or Type1C depending on the font
-		fmt.Fprintf(w, "stream\n%s\nendstream\n", fontStreamBytes)
+		// CIDType0C or Type1C depending on the font
+		w.WriteObject(fontStream, &Stream{
+			Dict: Dict{"Subtype": Name("CIDFontType0C")},
+			Data: cff,
+		})
 	}
-	w.WriteObjectEnd()
 
 	// to unicode mapping
-	w.WriteObjectStart(fontUnicode)
 	buf := &bytes.Buffer{}
 	fmt.Fprintf(buf, `/CIDInit /ProcSet findresource begin
 12 dict begin
 begincmap
-/CIDSystemInfo << /Registry (FontSpecific) /Ordering (%s) /Supplement 0 >> def
-/CMapName /FontSpecific-%s def
+/CIDSystemInfo << /Registry (FontSpecific) /Ordering %s /Supplement 0 >> def
+/CMapName %s def
 /CMapType 2 def
 1 begincodespacerange
 <0000> <FFFF>
 endcodespacerange
-`, name[1:], name[1:])
-	glyphs := make([]rune, f.NumGlyphs())
-	for i := 0; i < math.MaxUint16; i++ {
-		glyphs[f.Index(rune(i))] = rune(i)
+`, format(String(psName)), format(Name("FontSpecific-"+psName)))
+	used := make([]bool, f.NumGlyphs())
+	for _, g := range glyphs {
+		if int(g) < len(used) {
+			used[g] = true
+		}
+	}
+	runes := f.Runes()
+	for i := range runes {
+		if !used[i] {
+			runes[i] = 0
+		}
 	}
 	total := 0
-	for i := 0; i < len(glyphs); i++ {
-		if glyphs[i] != 0 {
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != 0 {
 			total++
 		}
 	}
 	section := 0
 	inside := false
-	for i := 0; i < len(glyphs); i++ {
-		if glyphs[i] == 0 {
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == 0 {
 			continue
 		}
 		if section--; section < 0 {
@@ -239,7 +391,13 @@ endcodespacerange
 			fmt.Fprintf(buf, "%d beginbfchar\n", section)
 			inside = true
 		}
-		fmt.Fprintf(buf, "<%04x> <%04x>\n", i, glyphs[i])
+		fmt.Fprintf(buf, "<%04x> <", i)
+		if r1, r2 := utf16.EncodeRune(runes[i]); r1 != unicode.ReplacementChar {
+			fmt.Fprintf(buf, "%04x%04x", r1, r2)
+		} else {
+			fmt.Fprintf(buf, "%04x", runes[i])
+		}
+		buf.WriteString(">\n")
 	}
 	if inside {
 		fmt.Fprintf(buf, "endbfchar\n")
@@ -248,31 +406,26 @@ endcodespacerange
 CMapName currentdict /CMap defineresource pop
 end
 end`)
-	w.WriteStreamPlain(buf.String())
-	w.WriteObjectEnd()
+	w.WriteObject(fontUnicode, &Stream{Data: buf.Bytes()})
 }
 
 func (w *PDFWriter) WriteImageJPEG(id int, img image.Image) {
-	w.WriteObjectStart(id)
 	buf := &bytes.Buffer{}
 	jpeg.Encode(buf, img, nil)
 	s := img.Bounds().Size()
-	fmt.Fprintf(w, `<<
-  /Type /XObject
-  /Subtype /Image
-  /Width %d
-  /Height %d
-  /ColorSpace /DeviceRGB
-  /BitsPerComponent 8
-  /Interpolate true
-  /Filter [/DCTDecode]
-  /Length %d
->>
-stream
-%s
-endstream
-`, s.X, s.Y, buf.Len(), buf.Bytes())
-	w.WriteObjectEnd()
+	w.WriteObject(id, &Stream{
+		Dict: Dict{
+			"Type":             Name("XObject"),
+			"Subtype":          Name("Image"),
+			"Width":            Number(s.X),
+			"Height":           Number(s.Y),
+			"ColorSpace":       Name("DeviceRGB"),
+			"BitsPerComponent": Number(8),
+			"Interpolate":      Bool(true),
+			"Filter":           Array{Name("DCTDecode")},
+		},
+		Data: buf.Bytes(),
+	})
 }
 
 func (w *PDFWriter) Write(p []byte) (int, error) {
@@ -293,6 +446,11 @@ func (w *PDFWriter) Pos() int {
 	return w.pos
 }
 
+// Err returns the first error that occurred while writing.
+func (w *PDFWriter) Err() error {
+	return w.err
+}
+
 func mmToPt(v float32) float32 {
 	return v * 72.0 / 25.4
 }
@@ -301,18 +459,16 @@ func mm(v float32) int {
 	return int(v * 72.0 / 25.4 * 1000)
 }
 
-func encodeName(s string) string {
-	buf := &bytes.Buffer{}
-	buf.WriteByte('/')
-	for i, r := range s {
-		if i == 0 && r == '/' {
-			continue
-		}
-		if unicode.IsLetter(r) {
-			buf.WriteRune(r)
-		} else if r <= 0xff {
-			fmt.Fprintf(buf, "#%02x", r)
-		}
+// subsetTag calculates a tag consisting of six uppercase letters which
+// identifies a subset of a font.
+func subsetTag(name string, glyphs []otf.Index) string {
+	h := md5.New()
+	io.WriteString(h, name)
+	binary.Write(h, binary.BigEndian, glyphs)
+	sum := h.Sum(nil)
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + sum[i]%26
 	}
-	return buf.String()
+	return string(tag)
 }
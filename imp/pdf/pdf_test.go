@@ -0,0 +1,303 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tux21b/imp/imp/otf"
+)
+
+func TestSubsetTag(t *testing.T) {
+	tag := subsetTag("Font", []otf.Index{1, 2, 3})
+	if !regexp.MustCompile(`^[A-Z]{6}$`).MatchString(tag) {
+		t.Errorf("invalid subset tag %q", tag)
+	}
+	if other := subsetTag("Font", []otf.Index{1, 2, 3}); other != tag {
+		t.Errorf("subset tag changed from %q to %q", tag, other)
+	}
+	if other := subsetTag("Font", []otf.Index{1, 2, 4}); other == tag {
+		t.Errorf("different subsets have the same tag %q", tag)
+	}
+}
+
+func TestWriteFontEmbedded(t *testing.T) {
+	f, err := otf.Open("../../fonts/SourceSansPro-Regular.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	w := NewPDFWriter(buf)
+	w.WriteHeader()
+	w.WriteFontEmbedded(w.NextID(), f, []otf.Index{f.Index('a'), f.Index('b')})
+	w.WriteFooter(0, 0)
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile(`/BaseFont /[A-Z]{6}\+` + regexp.QuoteMeta(f.PostscriptName) + `\b`)
+	if n := len(re.FindAll(buf.Bytes(), -1)); n != 2 {
+		t.Errorf("found %d subset font names, want 2", n)
+	}
+}
+
+var streamPattern = regexp.MustCompile(`(?s)(\d+) 0 obj\n(<<.*?>>)\nstream\n(.*?)\nendstream\nendobj\n`)
+
+// A streamObject is a stream object found in the output.
+type streamObject struct {
+	id   int
+	dict string
+	data []byte
+}
+
+// findStreams returns the stream objects of a document.
+func findStreams(data []byte) []streamObject {
+	var streams []streamObject
+	for _, m := range streamPattern.FindAllSubmatch(data, -1) {
+		id, _ := strconv.Atoi(string(m[1]))
+		streams = append(streams, streamObject{id, string(m[2]), m[3]})
+	}
+	return streams
+}
+
+func TestCompress(t *testing.T) {
+	content := []byte(strings.Repeat("BT /F1 12 Tf (Hello World) Tj ET\n", 100))
+	jpeg := []byte("\xff\xd8 not compressed again \xff\xd9")
+	for _, compress := range []bool{false, true} {
+		buf := &bytes.Buffer{}
+		w := NewPDFWriter(buf)
+		w.Compress = compress
+		w.WriteHeader()
+		w.WriteObject(0, &Stream{Dict: Dict{"Length1": Number(len(content))}, Data: content})
+		w.WriteObject(0, &Stream{Dict: Dict{"Filter": Name("DCTDecode")}, Data: jpeg})
+		w.WriteFooter(0, 0)
+		if err := w.Err(); err != nil {
+			t.Fatal(err)
+		}
+		streams := findStreams(buf.Bytes())
+		if len(streams) != 2 {
+			t.Fatalf("compress %v: found %d streams, want 2", compress, len(streams))
+		}
+
+		s := streams[0]
+		if want := fmt.Sprintf("/Length %d ", len(s.data)); !strings.Contains(s.dict, want) {
+			t.Errorf("compress %v: got %q for a stream of %d bytes", compress, s.dict, len(s.data))
+		}
+		if !strings.Contains(s.dict, fmt.Sprintf("/Length1 %d ", len(content))) {
+			t.Errorf("compress %v: the entries of the stream are lost: %q", compress, s.dict)
+		}
+		data := s.data
+		if compress {
+			if !strings.Contains(s.dict, "/Filter /FlateDecode ") {
+				t.Errorf("got %q, want the filter /FlateDecode", s.dict)
+			}
+			r, err := zlib.NewReader(bytes.NewReader(s.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err = ioutil.ReadAll(r); err != nil {
+				t.Fatal(err)
+			}
+			if len(s.data) >= len(content) {
+				t.Errorf("the compressed stream has %d bytes, the content %d", len(s.data), len(content))
+			}
+		} else if strings.Contains(s.dict, "/Filter") {
+			t.Errorf("got %q, want no filter", s.dict)
+		}
+		if !bytes.Equal(data, content) {
+			t.Errorf("compress %v: got the content %.40q", compress, data)
+		}
+
+		// streams which are already encoded are not compressed again
+		s = streams[1]
+		if !bytes.Equal(s.data, jpeg) || strings.Count(s.dict, "/Filter") != 1 {
+			t.Errorf("compress %v: got %q with %q", compress, s.dict, s.data)
+		}
+	}
+}
+
+// objectAt returns the id of the object at the given offset and the rest of
+// the document after its header.
+func objectAt(data []byte, offset int) (int, []byte) {
+	m := regexp.MustCompile(`^(\d+) 0 obj\n`).FindSubmatch(data[offset:])
+	if m == nil {
+		return 0, nil
+	}
+	id, _ := strconv.Atoi(string(m[1]))
+	return id, data[offset+len(m[0]):]
+}
+
+// inflate decompresses the data of a stream written with Compress set.
+func inflate(t *testing.T, s streamObject) []byte {
+	if !strings.Contains(s.dict, "/Filter /FlateDecode ") {
+		t.Fatalf("got %q, want a compressed stream", s.dict)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(s.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// writeTestDocument writes a document with n dictionaries and a stream. It
+// returns the document and the start of every object.
+func writeTestDocument(t *testing.T, objectStreams bool, n int) ([]byte, map[int]string) {
+	buf := &bytes.Buffer{}
+	w := NewPDFWriter(buf)
+	w.Compress = true
+	w.ObjectStreams = objectStreams
+	w.WriteHeader()
+	objects := make(map[int]string)
+	for i := 0; i < n; i++ {
+		objects[w.WriteObject(0, Dict{"Index": Number(i)})] = fmt.Sprintf("<< /Index %d >>", i)
+	}
+	objects[w.WriteObject(0, &Stream{Data: []byte("BT ET")})] = "<< /Filter /FlateDecode /Length "
+	w.WriteFooter(1, 2)
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), objects
+}
+
+// checkObject checks the start of the object with the given id.
+func checkObject(t *testing.T, id int, obj []byte, objects map[int]string) {
+	want, ok := objects[id]
+	if !ok {
+		t.Errorf("unexpected object %d: %.40q", id, obj)
+	} else if !bytes.HasPrefix(obj, []byte(want)) {
+		t.Errorf("object %d: got %.40q, want %q", id, obj, want)
+	}
+	delete(objects, id)
+}
+
+func TestObjectStreams(t *testing.T) {
+	const n = 150 // more than fit into one object stream
+	data, objects := writeTestDocument(t, true, n)
+	if !bytes.HasPrefix(data, []byte("%PDF-1.5\n")) {
+		t.Errorf("got the header %.9q, want PDF 1.5", data)
+	}
+	if bytes.Contains(data, []byte("\nxref\n")) || bytes.Contains(data, []byte("trailer")) {
+		t.Errorf("a PDF 1.5 document contains a cross-reference table")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if m == nil {
+		t.Fatalf("no startxref at the end of the document")
+	}
+	startxref, _ := strconv.Atoi(string(m[1]))
+	streams := make(map[int]streamObject)
+	for _, s := range findStreams(data) {
+		streams[s.id] = s
+	}
+	xrefID, _ := objectAt(data, startxref)
+	xref, ok := streams[xrefID]
+	if !ok || !strings.Contains(xref.dict, "/Type /XRef ") || !strings.Contains(xref.dict, "/W [1 4 2] ") ||
+		!strings.Contains(xref.dict, "/Root 1 0 R ") || !strings.Contains(xref.dict, "/Info 2 0 R ") {
+		t.Fatalf("startxref does not point to a cross-reference stream: %q", xref.dict)
+	}
+	size := regexp.MustCompile(`/Size (\d+) `).FindStringSubmatch(xref.dict)
+	entries := inflate(t, xref)
+	if size == nil || size[1] != strconv.Itoa(len(entries)/7) || len(entries)%7 != 0 {
+		t.Fatalf("got %q for %d bytes of entries", xref.dict, len(entries))
+	}
+
+	objStms := 0
+	for i := 1; i < len(entries)/7; i++ {
+		e := entries[7*i:]
+		field := int(binary.BigEndian.Uint32(e[1:]))
+		index := int(binary.BigEndian.Uint16(e[5:]))
+		switch e[0] {
+		case 1:
+			id, obj := objectAt(data, field)
+			if id != i {
+				t.Errorf("object %d: the offset %d points to object %d", i, field, id)
+				continue
+			}
+			if s, ok := streams[id]; ok && strings.Contains(s.dict, "/Type /ObjStm ") {
+				objStms++
+			} else if id != xrefID {
+				checkObject(t, id, obj, objects)
+			}
+		case 2:
+			s, ok := streams[field]
+			if !ok || !strings.Contains(s.dict, "/Type /ObjStm ") {
+				t.Errorf("object %d: object %d is not an object stream", i, field)
+				continue
+			}
+			var count, first int
+			fmt.Sscanf(regexp.MustCompile(`/N \d+`).FindString(s.dict), "/N %d", &count)
+			fmt.Sscanf(regexp.MustCompile(`/First \d+`).FindString(s.dict), "/First %d", &first)
+			if index >= count {
+				t.Errorf("object %d: index %d in an object stream of %d objects", i, index, count)
+				continue
+			}
+			stm := inflate(t, s)
+			var pairs []int
+			for _, f := range strings.Fields(string(stm[:first])) {
+				v, _ := strconv.Atoi(f)
+				pairs = append(pairs, v)
+			}
+			if len(pairs) != 2*count || pairs[2*index] != i {
+				t.Errorf("object %d: got %v in the object stream at index %d", i, pairs, index)
+				continue
+			}
+			checkObject(t, i, stm[first+pairs[2*index+1]:], objects)
+		default:
+			t.Errorf("object %d: entry of type %d", i, e[0])
+		}
+	}
+	if objStms != 2 {
+		t.Errorf("got %d object streams, want 2", objStms)
+	}
+	if len(objects) > 0 {
+		t.Errorf("%d objects are not in the cross-reference stream", len(objects))
+	}
+}
+
+func TestXRefTable(t *testing.T) {
+	const n = 10
+	data, objects := writeTestDocument(t, false, n)
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) {
+		t.Errorf("got the header %.9q, want PDF 1.4", data)
+	}
+	if bytes.Contains(data, []byte("/ObjStm")) || bytes.Contains(data, []byte("/XRef")) {
+		t.Errorf("a PDF 1.4 document contains object or cross-reference streams")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if m == nil {
+		t.Fatalf("no startxref at the end of the document")
+	}
+	startxref, _ := strconv.Atoi(string(m[1]))
+	table := string(data[startxref:])
+	want := fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", n+2)
+	if !strings.HasPrefix(table, want) {
+		t.Fatalf("got %.40q at startxref, want %q", table, want)
+	}
+	for i := 1; i <= n+1; i++ {
+		var offset int
+		fmt.Sscanf(table[len(want)+20*(i-1):], "%010d 00000 n \n", &offset)
+		id, obj := objectAt(data, offset)
+		if id != i {
+			t.Errorf("object %d: the offset %d points to object %d", i, offset, id)
+			continue
+		}
+		checkObject(t, id, obj, objects)
+	}
+	if len(objects) > 0 {
+		t.Errorf("%d objects are not in the cross-reference table", len(objects))
+	}
+	if !strings.Contains(table, fmt.Sprintf("/Info 2 0 R /Root 1 0 R /Size %d >>\nstartxref\n", n+2)) {
+		t.Errorf("got the trailer %q", table[len(want)+20*(n+1):])
+	}
+}
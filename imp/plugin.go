@@ -0,0 +1,74 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// A MacroFunc implements a macro in Go. It is called with the arguments of
+// every use of the macro and returns the tokens which replace it. The
+// returned tokens are expanded again.
+type MacroFunc func(args [][]Token) ([]Token, error)
+
+type plugin struct {
+	params int
+	fn     MacroFunc
+}
+
+var (
+	pluginsMu sync.RWMutex
+	plugins   = make(map[Macro]plugin)
+)
+
+// RegisterMacro makes the macro \name with the given number of arguments
+// available in all documents. Macros defined with \def take precedence.
+// RegisterMacro panics if the macro is already registered.
+func RegisterMacro(name string, params int, fn MacroFunc) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if fn == nil {
+		panic("imp: RegisterMacro function is nil")
+	}
+	if _, dup := plugins[Macro("\\"+name)]; dup {
+		panic("imp: RegisterMacro called twice for \\" + name)
+	}
+	plugins[Macro("\\"+name)] = plugin{params, fn}
+}
+
+func lookupPlugin(name Macro) (plugin, bool) {
+	pluginsMu.RLock()
+	defer pluginsMu.RUnlock()
+	p, ok := plugins[name]
+	return p, ok
+}
+
+// An Inline is a token which is drawn by Go code, like a barcode or a
+// signature box. It is placed within the text like a word.
+type Inline interface {
+	// Width returns the width of the element in points.
+	Width(s *State) float64
+
+	// Draw writes the PDF operators which draw the element. The origin is
+	// at the start of the element on the baseline and the graphics state
+	// is restored afterwards.
+	Draw(s *State, buf *bytes.Buffer)
+}
+
+// PlainText returns the text of the tokens, e.g. of a macro argument.
+// Spaces are collapsed and all other tokens are ignored.
+func PlainText(tokens []Token) string {
+	var buf bytes.Buffer
+	for _, tok := range tokens {
+		switch t := tok.(type) {
+		case Text:
+			buf.WriteString(string(t))
+		case Space:
+			buf.WriteByte(' ')
+		}
+	}
+	return strings.TrimSpace(buf.String())
+}
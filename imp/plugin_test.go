@@ -0,0 +1,101 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A testBox is a filled rectangle of the given width and half the font size
+// high.
+type testBox float64
+
+func (b testBox) Width(s *State) float64 {
+	return float64(b)
+}
+
+func (b testBox) Draw(s *State, buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "0 0 %.4f %.4f re f\n", float64(b), s.Size/2)
+}
+
+func init() {
+	RegisterMacro("testgreet", 1, func(args [][]Token) ([]Token, error) {
+		return append(append([]Token{Text("Hello,"), Space(" ")}, args[0]...), Text("!")), nil
+	})
+	RegisterMacro("testbox", 1, func(args [][]Token) ([]Token, error) {
+		w, err := strconv.ParseFloat(PlainText(args[0]), 64)
+		if err != nil {
+			return nil, errors.New("invalid width")
+		}
+		return []Token{testBox(w)}, nil
+	})
+}
+
+func TestRegisterMacro(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		diag  string
+	}{
+		{`\testgreet{World}`, "Hello, World!", ""},
+		{`\def\x{Imp}\testgreet\x`, "Hello, Imp!", ""},
+		{`\def\testgreet#1{Hi #1}\testgreet{World}`, "Hi World", ""},
+		{`\testbox{x}`, "", `\testbox: invalid width`},
+	}
+	for _, test := range tests {
+		m := &Imp{}
+		tokens, err := m.ExpandMacros(Lex(test.input))
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if got := dump(tokens); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.input, got, test.want)
+		}
+		diag := ""
+		if len(m.Diagnostics) > 0 {
+			diag = m.Diagnostics[0].Message
+		}
+		if diag != test.diag {
+			t.Errorf("%q: got diagnostic %q, want %q", test.input, diag, test.diag)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering \\testgreet twice does not panic")
+		}
+	}()
+	RegisterMacro("testgreet", 0, func([][]Token) ([]Token, error) { return nil, nil })
+}
+
+func TestInline(t *testing.T) {
+	d := newTestDocument(t)
+	d.AddText(`\testbox{20}Box`)
+	var buf bytes.Buffer
+	if err := d.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Diagnostics) > 0 {
+		t.Fatalf("got diagnostics %v", d.Diagnostics)
+	}
+
+	// the box is drawn at the start of the line and the text follows it
+	out := buf.String()
+	var x, y float64
+	i := strings.Index(out, " Td\n")
+	if _, err := fmt.Sscanf(out[strings.LastIndex(out[:i], "\n")+1:], "%f %f Td", &x, &y); err != nil {
+		t.Fatalf("no position of the first line: %v", err)
+	}
+	want := fmt.Sprintf("ET\nq 1 0 0 1 %.4f %.4f cm\n0 0 20.0000 6.0000 re f\nQ\nBT\n%.4f %.4f Td\n[-1666] TJ\n",
+		x, y, x, y)
+	if !strings.Contains(out, want) {
+		t.Errorf("the output does not contain %q", want)
+	}
+}
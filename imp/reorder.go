@@ -0,0 +1,185 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"github.com/tux21b/imp/imp/bidi"
+)
+
+// ResolveBidi resolves the embedding levels of every paragraph. Text is
+// split where the level changes and the level of the following text is
+// stored in the state.
+func (m *Imp) ResolveBidi(tokens []Token) []Token {
+	ntokens := make([]Token, 0, len(tokens))
+	start := 0
+	for start < len(tokens) {
+		end := len(tokens)
+		for i := start; i < len(tokens); i++ {
+			if _, ok := tokens[i].(ParagraphBreak); ok {
+				end = i
+				break
+			}
+		}
+		ntokens = append(ntokens, resolveParagraph(tokens[start:end])...)
+		if end < len(tokens) {
+			ntokens = append(ntokens, tokens[end])
+		}
+		start = end + 1
+	}
+	return ntokens
+}
+
+func resolveParagraph(par []Token) []Token {
+	var runes []rune
+	for _, tok := range par {
+		switch t := tok.(type) {
+		case Text:
+			runes = append(runes, []rune(string(t))...)
+		case CanBreak:
+			if _, ok := t.NoBreak.(Space); ok {
+				runes = append(runes, ' ')
+			}
+		case Inline:
+			runes = append(runes, '\uFFFC')
+		}
+	}
+	levels, _ := bidi.Resolve(runes, bidi.Auto)
+	if !hasLevels(levels) {
+		return par
+	}
+
+	ntokens := make([]Token, 0, len(par))
+	level := bidi.Level(0)
+	setLevel := func(l bidi.Level) {
+		if l != level {
+			level = l
+			ntokens = append(ntokens, StateAction(func(s *State) {
+				s.Level = l
+			}))
+		}
+	}
+	k := 0
+	for _, tok := range par {
+		switch t := tok.(type) {
+		case Text:
+			start := 0
+			for pos := range string(t) {
+				if levels[k] != level {
+					if pos > start {
+						ntokens = append(ntokens, t[start:pos])
+						start = pos
+					}
+					setLevel(levels[k])
+				}
+				k++
+			}
+			ntokens = append(ntokens, t[start:])
+			continue
+		case CanBreak:
+			if _, ok := t.NoBreak.(Space); ok {
+				setLevel(levels[k])
+				k++
+			}
+		case Inline:
+			setLevel(levels[k])
+			k++
+		}
+		ntokens = append(ntokens, tok)
+	}
+	setLevel(0)
+	return ntokens
+}
+
+func hasLevels(levels []bidi.Level) bool {
+	for _, l := range levels {
+		if l != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ReorderLines displays the text of lines which contain right-to-left text
+// in visual order. The state and the source position of every text are
+// restored before it is emitted and the remaining tokens of the line
+// follow in logical order.
+func (m *Imp) ReorderLines(tokens []Token) []Token {
+	ntokens := make([]Token, 0, len(tokens))
+	s := m.State.Clone()
+	pos := Pos(-1)
+	start := 0
+	for start < len(tokens) {
+		end := start
+		for end < len(tokens) && !isLineEnd(tokens[end]) {
+			end++
+		}
+		line := tokens[start:end]
+		first, firstPos := s.Clone(), pos
+		var items []Token
+		var states []*State
+		var levels []bidi.Level
+		var positions []Pos
+		for _, tok := range line {
+			switch t := tok.(type) {
+			case Text, Space, Inline:
+				items = append(items, tok)
+				states = append(states, s.Clone())
+				levels = append(levels, s.Level)
+				positions = append(positions, pos)
+			case Pos:
+				pos = t
+			default:
+				GetWidth(s, tok)
+			}
+		}
+		if !hasLevels(levels) {
+			ntokens = append(ntokens, line...)
+		} else {
+			cur, curPos := first, firstPos
+			for _, i := range bidi.Reorder(levels) {
+				ntokens = append(ntokens, switchState(cur, states[i])...)
+				if positions[i] != curPos {
+					ntokens = append(ntokens, positions[i])
+					curPos = positions[i]
+				}
+				ntokens = append(ntokens, items[i])
+				cur = states[i]
+			}
+			ntokens = append(ntokens, switchState(cur, first)...)
+			for _, tok := range line {
+				switch tok.(type) {
+				case Text, Space, Inline:
+				default:
+					ntokens = append(ntokens, tok)
+				}
+			}
+		}
+		if end < len(tokens) {
+			ntokens = append(ntokens, tokens[end])
+		}
+		start = end + 1
+	}
+	return ntokens
+}
+
+func isLineEnd(t Token) bool {
+	switch t.(type) {
+	case LineBreak, ParagraphBreak, ColBreak:
+		return true
+	}
+	return false
+}
+
+func switchState(from, to *State) []Token {
+	var tokens []Token
+	if from.Font != to.Font || from.Size != to.Size {
+		tokens = append(tokens, SetFont{Font: to.Font, Size: int(to.Size)})
+	}
+	if from.Color != to.Color {
+		tokens = append(tokens, to.Color)
+	}
+	return append(tokens, StateAction(func(s *State) {
+		s.Features, s.Script, s.Language, s.Level = to.Features, to.Script, to.Language, to.Level
+	}))
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tux21b/imp/imp/bidi"
+)
+
+// reorderLines sets the text of a test document like Document.Render and
+// returns the lines in visual order.
+func reorderLines(t *testing.T, text string, width float64) (*Imp, []Token) {
+	d := newTestDocument(t)
+	d.AddText(text)
+	m := newTestImp(d, width)
+	tokens, err := d.tokens(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens = m.FindBreaks(tokens)
+	tokens = m.ResolveBidi(tokens)
+	tokens = m.SplitLines(tokens, 0)
+	return m, m.ReorderLines(tokens)
+}
+
+// visual returns the characters of every line in the order they are
+// displayed. Like the shaper, text at an odd embedding level is reversed
+// and mirrored.
+func visual(m *Imp, tokens []Token) []string {
+	s := m.State.Clone()
+	lines := []string{""}
+	for _, tok := range tokens {
+		switch t := tok.(type) {
+		case Text:
+			runes := []rune(string(t))
+			if s.Level%2 == 1 {
+				for i, j := 0, len(runes)-1; i <= j; i, j = i+1, j-1 {
+					runes[i], runes[j] = mirror(runes[j]), mirror(runes[i])
+				}
+			}
+			lines[len(lines)-1] += string(runes)
+		case Space:
+			lines[len(lines)-1] += " "
+		case LineBreak, ParagraphBreak:
+			lines = append(lines, "")
+		}
+		GetWidth(s, tok)
+	}
+	return lines
+}
+
+func mirror(r rune) rune {
+	if m, ok := bidi.Mirror(r); ok {
+		return m
+	}
+	return r
+}
+
+func TestReorderLines(t *testing.T) {
+	tests := []struct {
+		text  string
+		width float64
+		want  []string
+	}{
+		{"abc def", 1000, []string{"abc def"}},
+		{"abc אבג דהו def", 1000, []string{"abc והד גבא def"}},
+		{"abc (אבג) def", 1000, []string{"abc (גבא) def"}},
+		{"אבג (abc) דהו", 1000, []string{"והד (abc) גבא"}},
+		{"אבג [abc דהו] זחט", 1000, []string{"טחז [והד abc] גבא"}},
+		{"אבג 123 דהו", 1000, []string{"והד 123 גבא"}},
+		{"abc אבג\n\nאבג abc", 1000, []string{"abc גבא", "abc גבא"}},
+		// every line is reordered on its own
+		{"abc אבג דהו זחט def", 80, []string{"abc והד גבא", "טחז def"}},
+	}
+	for _, test := range tests {
+		m, tokens := reorderLines(t, test.text, test.width)
+		if got := visual(m, tokens); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q is displayed as %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestReorderLinesPos(t *testing.T) {
+	text := "abc def אבג דהו (זחט) ghi"
+	_, tokens := reorderLines(t, text, 1000)
+	pos := Pos(-1)
+	for _, tok := range tokens {
+		switch tok := tok.(type) {
+		case Pos:
+			pos = tok
+		case Text:
+			if pos < 0 || !strings.HasPrefix(text[pos:], string(tok)) {
+				t.Errorf("%q has the position %d", tok, pos)
+			}
+		}
+	}
+}
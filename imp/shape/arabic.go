@@ -0,0 +1,159 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package shape
+
+import (
+	"sort"
+	"unicode"
+
+	"github.com/tux21b/imp/imp/otf"
+)
+
+// Masks of the positional forms of joining scripts.
+const (
+	maskIsol = 1 << (iota + 1)
+	maskFina
+	maskMedi
+	maskInit
+)
+
+var arabicStages = []stage{
+	{features: features("ccmp", "locl")},
+	{features: []otf.Feature{masked("isol", maskIsol)}},
+	{features: []otf.Feature{masked("fina", maskFina)}},
+	{features: []otf.Feature{masked("medi", maskMedi)}},
+	{features: []otf.Feature{masked("init", maskInit)}},
+	{features: features("rlig")},
+	{features: features("calt")},
+	{features: features("mset", "clig", "liga")},
+}
+
+var arabicPositioning = features("curs", "kern", "mark", "mkmk")
+
+// shapeArabic shapes scripts where letters join their neighbours, like
+// Arabic, Syriac, N'Ko and Mongolian.
+func shapeArabic(c *otf.Context, text string, features []otf.Feature) []otf.Glyph {
+	b := newBuffer(c, text)
+	runes := []rune(text)
+	forms := joiningForms(runes)
+	for i := range b.Masks {
+		b.Masks[i] |= forms[i]
+	}
+	substitute(c, b, arabicStages, features)
+	return position(c, b, arabicPositioning, features)
+}
+
+// joiningForms returns the mask of the positional form of every character.
+// Transparent characters, like most marks, are skipped and do not have a
+// form on their own.
+func joiningForms(runes []rune) []uint32 {
+	forms := make([]uint32, len(runes))
+	prev := -1
+	for i, r := range runes {
+		t := joining(r)
+		if t == joinTransparent {
+			continue
+		}
+		if prev >= 0 && joinsFollowing(joining(runes[prev])) && joinsPreceding(t) {
+			switch forms[prev] {
+			case maskIsol:
+				forms[prev] = maskInit
+			case maskFina:
+				forms[prev] = maskMedi
+			}
+			forms[i] = maskFina
+		} else if t != joinNone {
+			forms[i] = maskIsol
+		}
+		prev = i
+	}
+	return forms
+}
+
+// Joining types as defined by ArabicShaping.txt of the Unicode standard.
+type joiningType uint8
+
+const (
+	joinNone joiningType = iota
+	joinRight
+	joinLeft
+	joinDual
+	joinCausing
+	joinTransparent
+)
+
+func joinsFollowing(t joiningType) bool {
+	return t == joinDual || t == joinLeft || t == joinCausing
+}
+
+func joinsPreceding(t joiningType) bool {
+	return t == joinDual || t == joinRight || t == joinCausing
+}
+
+// joining returns the joining type of a character. Letters of joining
+// scripts are dual joining unless listed in joiningTypes.
+func joining(r rune) joiningType {
+	k := sort.Search(len(joiningTypes), func(i int) bool { return joiningTypes[i].hi >= r })
+	if k < len(joiningTypes) && joiningTypes[k].lo <= r {
+		return joiningTypes[k].t
+	}
+	switch {
+	case r == 0x200C:
+		return joinNone
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return joinTransparent
+	case unicode.IsLetter(r) && unicode.In(r, unicode.Arabic, unicode.Syriac, unicode.Nko, unicode.Mongolian):
+		return joinDual
+	}
+	return joinNone
+}
+
+var joiningTypes = []struct {
+	lo, hi rune
+	t      joiningType
+}{
+	{0x0600, 0x0605, joinNone},
+	{0x0608, 0x0608, joinNone},
+	{0x060B, 0x060B, joinNone},
+	{0x0621, 0x0621, joinNone},
+	{0x0622, 0x0625, joinRight},
+	{0x0627, 0x0627, joinRight},
+	{0x0629, 0x0629, joinRight},
+	{0x062F, 0x0632, joinRight},
+	{0x0640, 0x0640, joinCausing},
+	{0x0648, 0x0648, joinRight},
+	{0x0671, 0x0673, joinRight},
+	{0x0674, 0x0674, joinNone},
+	{0x0675, 0x0677, joinRight},
+	{0x0688, 0x0699, joinRight},
+	{0x06C0, 0x06C0, joinRight},
+	{0x06C3, 0x06CB, joinRight},
+	{0x06CD, 0x06CD, joinRight},
+	{0x06CF, 0x06CF, joinRight},
+	{0x06D2, 0x06D3, joinRight},
+	{0x06D5, 0x06D5, joinRight},
+	{0x06DD, 0x06DD, joinNone},
+	{0x06EE, 0x06EF, joinRight},
+	{0x0710, 0x0710, joinRight},
+	{0x0715, 0x0719, joinRight},
+	{0x071E, 0x071E, joinRight},
+	{0x0728, 0x0728, joinRight},
+	{0x072A, 0x072A, joinRight},
+	{0x072C, 0x072C, joinRight},
+	{0x072F, 0x072F, joinRight},
+	{0x074D, 0x074D, joinRight},
+	{0x0759, 0x075B, joinRight},
+	{0x076B, 0x076C, joinRight},
+	{0x0771, 0x0771, joinRight},
+	{0x0773, 0x0774, joinRight},
+	{0x0778, 0x0779, joinRight},
+	{0x07FA, 0x07FA, joinCausing},
+	{0x08AA, 0x08AC, joinRight},
+	{0x08AE, 0x08AE, joinRight},
+	{0x08B1, 0x08B2, joinRight},
+	{0x08B9, 0x08B9, joinRight},
+	{0x180A, 0x180A, joinCausing},
+	{0x1880, 0x1884, joinNone},
+	{0x200D, 0x200D, joinCausing},
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package shape
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tux21b/imp/imp/otf"
+)
+
+func TestJoiningForms(t *testing.T) {
+	const (
+		isol = maskIsol
+		fina = maskFina
+		medi = maskMedi
+		init = maskInit
+	)
+	tests := []struct {
+		text string
+		want []uint32
+	}{
+		{"ب", []uint32{isol}},
+		{"بب", []uint32{init, fina}},
+		{"ببب", []uint32{init, medi, fina}},
+		{"اب", []uint32{isol, isol}},          // alef does not join the following letter
+		{"باب", []uint32{init, fina, isol}},   // alef in the middle of a word
+		{"بَب", []uint32{init, 0, fina}},      // the fatha is transparent
+		{"ب\u200cب", []uint32{isol, 0, isol}}, // zero width non-joiner
+		{"ب\u200d", []uint32{init, fina}},     // zero width joiner
+		{"بـ", []uint32{init, fina}},          // tatweel
+		{"ب ب", []uint32{isol, 0, isol}},
+		{"ءب", []uint32{0, isol}}, // hamza does not join
+	}
+	for _, test := range tests {
+		if got := joiningForms([]rune(test.text)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got forms %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestShapeArabic(t *testing.T) {
+	// the forms of every letter are the glyphs following the letter in the
+	// order isolated, final, medial and initial
+	const beh, alef, fatha, space = 100, 110, 120, 3
+	f := testFont(t, map[rune]otf.Index{
+		' ': space, 'ب': beh, 'ا': alef, 'َ': fatha, 0x200C: 1, 0x200D: 2,
+	}, []lookup{
+		{"isol", 1, map[otf.Index][]otf.Index{beh: {beh + 1}, alef: {alef + 1}}},
+		{"fina", 1, map[otf.Index][]otf.Index{beh: {beh + 2}, alef: {alef + 2}}},
+		{"medi", 1, map[otf.Index][]otf.Index{beh: {beh + 3}}},
+		{"init", 1, map[otf.Index][]otf.Index{beh: {beh + 4}}},
+	})
+	tests := []struct {
+		text string
+		want []otf.Index
+	}{
+		{"ب", []otf.Index{beh + 1}},
+		{"ببب", []otf.Index{beh + 4, beh + 3, beh + 2}},
+		{"با", []otf.Index{beh + 4, alef + 2}},
+		{"اب", []otf.Index{alef + 1, beh + 1}},
+		{"بَب", []otf.Index{beh + 4, fatha, beh + 2}},
+		{"ب\u200cب", []otf.Index{beh + 1, beh + 1}},
+		{"ب\u200dب", []otf.Index{beh + 4, beh + 2}},
+		{"بب بب", []otf.Index{beh + 4, beh + 2, space, beh + 4, beh + 2}},
+	}
+	for _, test := range tests {
+		if got := glyphs(f, test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got glyphs %v, want %v", test.text, got, test.want)
+		}
+	}
+}
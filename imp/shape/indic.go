@@ -0,0 +1,450 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package shape
+
+import (
+	"sort"
+	"unicode"
+
+	"github.com/tux21b/imp/imp/otf"
+)
+
+// Categories of the characters of Indic scripts.
+type indicCategory uint8
+
+const (
+	indicOther indicCategory = iota
+	indicConsonant
+	indicRa
+	indicVowel
+	indicMatra
+	indicNukta
+	indicHalant
+	indicZWJ
+	indicZWNJ
+	indicModifier
+)
+
+// Positions of the glyphs within a syllable. The initial reordering sorts
+// the characters of a syllable by their position, which is kept in the
+// upper bits of the glyph masks for the final reordering.
+const (
+	posStart = iota
+	posRaToBecomeReph
+	posPreM
+	posPreC
+	posBaseC
+	posAfterMain
+	posAboveC
+	posBeforeSub
+	posBelowC
+	posAfterSub
+	posBeforePost
+	posPostC
+	posAfterPost
+	posFinalC
+	posSMVD
+	posEnd
+
+	posShift = 24
+)
+
+// Masks of the Indic features which are only applied to some glyphs.
+const (
+	maskRphf = 1 << (iota + 8)
+	maskHalf
+	maskBlwf
+	maskAbvf
+	maskPstf
+
+	maskWordStart = 1 << 30
+)
+
+type indicConfig struct {
+	block   rune // first character of the Unicode block
+	rephPos int  // position of the reph after the final reordering
+	blwfPre bool // below-base forms are also applied before the base
+}
+
+var indicConfigs = map[string]indicConfig{
+	"deva": {0x0900, posBeforePost, true},
+	"beng": {0x0980, posAfterSub, true},
+	"guru": {0x0A00, posBeforeSub, true},
+	"gujr": {0x0A80, posBeforePost, true},
+	"orya": {0x0B00, posAfterMain, true},
+	"taml": {0x0B80, posAfterPost, true},
+	"telu": {0x0C00, posAfterPost, false},
+	"knda": {0x0C80, posAfterPost, false},
+	"mlym": {0x0D00, posAfterMain, true},
+}
+
+var indicStages = []stage{
+	{features: features("locl", "ccmp")},
+	{features: features("nukt")},
+	{features: features("akhn")},
+	{features: []otf.Feature{masked("rphf", maskRphf)}},
+	{features: features("rkrf")},
+	{features: []otf.Feature{masked("blwf", maskBlwf)}},
+	{features: []otf.Feature{masked("abvf", maskAbvf)}},
+	{features: []otf.Feature{masked("half", maskHalf)}},
+	{features: []otf.Feature{masked("pstf", maskPstf)}},
+	{features: features("vatu")},
+	{features: features("cjct"), pause: finalReordering},
+	{features: append([]otf.Feature{masked("init", maskInit)},
+		features("pres", "abvs", "blws", "psts", "haln")...)},
+	{features: features("calt", "clig", "liga", "rclt")},
+}
+
+var indicPositioning = features("dist", "abvm", "blwm", "kern", "mark", "mkmk")
+
+// preBaseMatras are the dependent vowel signs which are written in front
+// of the consonant cluster they belong to.
+var preBaseMatras = map[rune]bool{
+	0x093F: true, 0x094E: true,
+	0x09BF: true, 0x09C7: true, 0x09C8: true,
+	0x0A3F: true,
+	0x0ABF: true,
+	0x0B47: true,
+	0x0BC6: true, 0x0BC7: true, 0x0BC8: true,
+	0x0D46: true, 0x0D47: true, 0x0D48: true,
+}
+
+// splitMatras are the vowel signs which consist of several parts, some of
+// which have to be reordered separately.
+var splitMatras = map[rune][]rune{
+	0x09CB: {0x09C7, 0x09BE},
+	0x09CC: {0x09C7, 0x09D7},
+	0x0B48: {0x0B47, 0x0B56},
+	0x0B4B: {0x0B47, 0x0B3E},
+	0x0B4C: {0x0B47, 0x0B57},
+	0x0BCA: {0x0BC6, 0x0BBE},
+	0x0BCB: {0x0BC7, 0x0BBE},
+	0x0BCC: {0x0BC6, 0x0BD7},
+	0x0C48: {0x0C46, 0x0C56},
+	0x0CC0: {0x0CBF, 0x0CD5},
+	0x0CC7: {0x0CC6, 0x0CD5},
+	0x0CC8: {0x0CC6, 0x0CD6},
+	0x0CCA: {0x0CC6, 0x0CC2},
+	0x0CCB: {0x0CC6, 0x0CC2, 0x0CD5},
+	0x0D4A: {0x0D46, 0x0D3E},
+	0x0D4B: {0x0D47, 0x0D3E},
+	0x0D4C: {0x0D46, 0x0D57},
+}
+
+func indicCategoryOf(r, block rune) indicCategory {
+	switch r {
+	case 0x200C:
+		return indicZWNJ
+	case 0x200D:
+		return indicZWJ
+	case 0x09F0, 0x09F1:
+		return indicConsonant
+	}
+	if r < block || r >= block+0x80 {
+		return indicOther
+	}
+	switch off := r - block; {
+	case off == 0x4D:
+		return indicHalant
+	case off == 0x3C:
+		return indicNukta
+	case unicode.In(r, unicode.Mn, unicode.Mc):
+		if off <= 0x03 || (off >= 0x51 && off <= 0x54) || off >= 0x70 {
+			return indicModifier
+		}
+		return indicMatra
+	case !unicode.IsLetter(r) || off == 0x3D:
+		return indicOther
+	case off == 0x30:
+		return indicRa
+	case off >= 0x15 && off <= 0x39, off >= 0x58 && off <= 0x5F, off >= 0x78 && block == 0x0900:
+		return indicConsonant
+	case off <= 0x14, off == 0x60, off == 0x61, off >= 0x72 && off <= 0x77:
+		return indicVowel
+	}
+	return indicOther
+}
+
+func isConsonant(cat indicCategory) bool {
+	return cat == indicConsonant || cat == indicRa
+}
+
+// An indicChar is a character of an Indic text during the initial
+// reordering.
+type indicChar struct {
+	r       rune
+	cat     indicCategory
+	cluster int
+	pos     int
+	mask    uint32
+}
+
+// shapeIndic shapes the scripts of India. The characters of each syllable
+// are reordered, so that the GSUB lookups of the font can form half forms,
+// below-base forms and the reph, before the pre-base matras and the reph
+// are moved to their final positions.
+func shapeIndic(c *otf.Context, text string, features []otf.Feature) []otf.Glyph {
+	cfg := indicConfigs[c.Script]
+	f := c.Font
+
+	var chars []indicChar
+	for pos, r := range text {
+		parts, ok := splitMatras[r]
+		for _, p := range parts {
+			ok = ok && f.Index(p) != 0
+		}
+		if !ok {
+			parts = []rune{r}
+		}
+		for _, p := range parts {
+			chars = append(chars, indicChar{
+				r:       p,
+				cat:     indicCategoryOf(p, cfg.block),
+				cluster: pos,
+				mask:    mask(p, 1),
+			})
+		}
+	}
+
+	positions := make(map[rune]int)
+	for start := 0; start < len(chars); {
+		end := syllableEnd(chars, start)
+		if start == 0 || !unicode.In(chars[start-1].r, unicode.L, unicode.M) {
+			for i := start; i < end; i++ {
+				chars[i].mask |= maskWordStart
+			}
+		}
+		initialReordering(c, cfg, chars[start:end], positions)
+		start = end
+	}
+
+	b := &otf.Buffer{}
+	for _, ch := range chars {
+		b.Append(f.Index(ch.r), ch.cluster, ch.mask|uint32(ch.pos)<<posShift)
+	}
+	substitute(c, b, indicStages, features)
+	return position(c, b, indicPositioning, features)
+}
+
+// syllableEnd returns the end of the syllable starting at i.
+func syllableEnd(chars []indicChar, i int) int {
+	n := len(chars)
+	is := func(i int, cat indicCategory) bool {
+		return i < n && chars[i].cat == cat
+	}
+	switch cat := chars[i].cat; {
+	case isConsonant(cat):
+		for {
+			if i++; is(i, indicNukta) {
+				i++
+			}
+			if !is(i, indicHalant) {
+				break
+			}
+			if i++; is(i, indicZWNJ) {
+				return i + 1 // explicit halant
+			}
+			if is(i, indicZWJ) {
+				i++
+			}
+			if i >= n || !isConsonant(chars[i].cat) {
+				break
+			}
+		}
+	case cat == indicVowel:
+		if i++; is(i, indicNukta) {
+			i++
+		}
+		if is(i, indicHalant) {
+			i++
+		}
+	default:
+		i++
+	}
+	for is(i, indicMatra) || is(i, indicNukta) {
+		i++
+	}
+	for is(i, indicModifier) {
+		i++
+	}
+	return i
+}
+
+// consonantPosition reports whether the font has a below-base or post-base
+// form of a consonant.
+func consonantPosition(c *otf.Context, cfg indicConfig, r rune, cache map[rune]int) int {
+	if pos, ok := cache[r]; ok {
+		return pos
+	}
+	halant, g := c.Font.Index(cfg.block+0x4D), c.Font.Index(r)
+	pos := posBaseC
+	for _, pair := range [][]otf.Index{{halant, g}, {g, halant}} {
+		if c.WouldSubstitute(pair, "blwf") {
+			pos = posBelowC
+			break
+		} else if c.WouldSubstitute(pair, "pstf") {
+			pos = posPostC
+			break
+		}
+	}
+	cache[r] = pos
+	return pos
+}
+
+// initialReordering determines the base consonant of a syllable, marks the
+// glyphs for the basic features and sorts the characters by position.
+func initialReordering(c *otf.Context, cfg indicConfig, syl []indicChar, cache map[rune]int) {
+	cluster := syl[0].cluster
+	for i := range syl {
+		syl[i].cluster = cluster
+		syl[i].pos = posBaseC
+		if syl[i].cat == indicModifier {
+			syl[i].pos = posSMVD
+		}
+	}
+	if !isConsonant(syl[0].cat) {
+		return
+	}
+	n := len(syl)
+
+	hasReph := false
+	if n > 2 && syl[0].cat == indicRa && syl[1].cat == indicHalant && syl[2].cat != indicZWJ {
+		for i := 2; i < n && !hasReph; i++ {
+			hasReph = isConsonant(syl[i].cat)
+		}
+		hasReph = hasReph && c.WouldSubstitute([]otf.Index{
+			c.Font.Index(syl[0].r), c.Font.Index(syl[1].r)}, "rphf")
+	}
+	limit := 0
+	if hasReph {
+		limit = 2
+	}
+
+	// find the base consonant, skipping below-base and post-base forms
+	base, seenBelow := n, false
+	for i := n - 1; i >= limit; i-- {
+		if isConsonant(syl[i].cat) {
+			pos := posBaseC
+			if i > 0 && (syl[i-1].cat == indicHalant || syl[i-1].cat == indicZWJ) {
+				pos = consonantPosition(c, cfg, syl[i].r, cache)
+			}
+			syl[i].pos = pos
+			if pos != posBelowC && (pos != posPostC || seenBelow) {
+				base = i
+				break
+			}
+			seenBelow = seenBelow || pos == posBelowC
+			base = i
+		} else if i > 0 && syl[i].cat == indicZWJ && syl[i-1].cat == indicHalant {
+			break
+		}
+	}
+	if base >= n {
+		base, hasReph, limit = 0, false, 0
+	}
+
+	for i := range syl {
+		ch := &syl[i]
+		switch {
+		case hasReph && i < 2:
+			ch.pos = posRaToBecomeReph
+			ch.mask |= maskRphf
+		case ch.cat == indicMatra && preBaseMatras[ch.r]:
+			ch.pos = posPreM
+		case ch.cat == indicModifier:
+			ch.pos = posSMVD
+		case i < base:
+			ch.pos = posPreC
+			ch.mask |= maskHalf
+			if cfg.blwfPre {
+				ch.mask |= maskBlwf
+			}
+		case i == base:
+			ch.pos = posBaseC
+		default:
+			ch.mask |= maskBlwf | maskAbvf | maskPstf
+			switch {
+			case ch.cat == indicMatra:
+				ch.pos = posAfterSub
+			case isConsonant(ch.cat):
+				if ch.pos == posBaseC {
+					ch.pos = posAfterMain
+				}
+			default:
+				ch.pos = syl[i-1].pos // nukta and halant stay with their consonant
+			}
+		}
+	}
+	sort.SliceStable(syl, func(i, j int) bool { return syl[i].pos < syl[j].pos })
+}
+
+// finalReordering moves the pre-base matras and the reph to their final
+// positions, after the basic features have been applied.
+func finalReordering(c *otf.Context, b *otf.Buffer) {
+	cfg := indicConfigs[c.Script]
+	halant := c.Font.Index(cfg.block + 0x4D)
+	pos := func(i int) int {
+		return int(b.Masks[i]>>posShift) & 0xF
+	}
+	for start := 0; start < len(b.Glyphs); {
+		end := start + 1
+		for end < len(b.Glyphs) && b.Clusters[end] == b.Clusters[start] {
+			end++
+		}
+		base := start
+		for base < end && pos(base) < posBaseC {
+			base++
+		}
+
+		// pre-base matras are moved after the last halant which did not
+		// form a conjunct with the following consonant.
+		i := start
+		for i < end && pos(i) == posRaToBecomeReph {
+			i++
+		}
+		m := i
+		for m < end && pos(m) == posPreM {
+			m++
+		}
+		if m > i {
+			for j := base - 1; j >= m; j-- {
+				if b.Glyphs[j] == halant {
+					for k := i; k < m; k++ {
+						moveGlyph(b, i, j)
+					}
+					break
+				}
+			}
+		}
+
+		// a reph which has been formed is moved after the base consonant
+		if pos(start) == posRaToBecomeReph && (start+1 >= end || pos(start+1) != posRaToBecomeReph) {
+			j := base
+			for j < end && pos(j) <= cfg.rephPos {
+				j++
+			}
+			moveGlyph(b, start, j-1)
+		}
+
+		if b.Masks[start]&maskWordStart != 0 && pos(start) == posPreM {
+			b.Masks[start] |= maskInit
+		}
+		start = end
+	}
+}
+
+// moveGlyph moves the glyph at position i to position j.
+func moveGlyph(b *otf.Buffer, i, j int) {
+	g, cluster, m := b.Glyphs[i], b.Clusters[i], b.Masks[i]
+	if i < j {
+		copy(b.Glyphs[i:j], b.Glyphs[i+1:j+1])
+		copy(b.Clusters[i:j], b.Clusters[i+1:j+1])
+		copy(b.Masks[i:j], b.Masks[i+1:j+1])
+	} else {
+		copy(b.Glyphs[j+1:i+1], b.Glyphs[j:i])
+		copy(b.Clusters[j+1:i+1], b.Clusters[j:i])
+		copy(b.Masks[j+1:i+1], b.Masks[j:i])
+	}
+	b.Glyphs[j], b.Clusters[j], b.Masks[j] = g, cluster, m
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package shape
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tux21b/imp/imp/otf"
+)
+
+func TestShapeIndic(t *testing.T) {
+	const (
+		ka, ta, ra, halant, iMatra, aaMatra = 100, 101, 102, 103, 104, 105
+		reph, halfKa, rakar, space          = 110, 111, 112, 3
+	)
+	f := testFont(t, map[rune]otf.Index{
+		'क': ka, 'त': ta, 'र': ra, '्': halant, 'ि': iMatra, 'ा': aaMatra,
+		' ': space, 0x200C: 1, 0x200D: 2,
+	}, []lookup{
+		{"rphf", 4, map[otf.Index][]otf.Index{ra: {reph, halant}}},
+		{"blwf", 4, map[otf.Index][]otf.Index{halant: {rakar, ra}}},
+		{"half", 4, map[otf.Index][]otf.Index{ka: {halfKa, halant}}},
+	})
+	tests := []struct {
+		text string
+		want []otf.Index
+	}{
+		{"का", []otf.Index{ka, aaMatra}},
+		{"कि", []otf.Index{iMatra, ka}},                       // pre-base matra
+		{"र्क", []otf.Index{ka, reph}},                        // reph after the base
+		{"र्कि", []otf.Index{iMatra, ka, reph}},               // reph and pre-base matra
+		{"क्त", []otf.Index{halfKa, ta}},                      // half form
+		{"क्ति", []otf.Index{iMatra, halfKa, ta}},             // matra before the cluster
+		{"क्र", []otf.Index{ka, rakar}},                       // below-base form
+		{"क्\u200cत", []otf.Index{ka, halant, ta}},            // explicit halant
+		{"कि कि", []otf.Index{iMatra, ka, space, iMatra, ka}}, // two syllables
+	}
+	for _, test := range tests {
+		if got := glyphs(f, test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got glyphs %v, want %v", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+// Package shape converts text into positioned glyphs. Beside applying the
+// requested OpenType features, it performs the script specific processing
+// needed by complex scripts, like selecting the joining forms of Arabic
+// letters or reordering the syllables of Indic scripts.
+package shape
+
+import (
+	"github.com/tux21b/imp/imp/bidi"
+	"github.com/tux21b/imp/imp/otf"
+)
+
+const (
+	// maskIgnorable marks glyphs of default ignorable characters, like the
+	// zero width joiner, which are removed after the substitution.
+	maskIgnorable = 1 << 31
+
+	// maskMirror marks glyphs of mirrored characters in right-to-left text
+	// which are not covered by the font and are left to the rtlm feature.
+	maskMirror = 1 << 29
+)
+
+// A Run is a part of a text which is written in a single script.
+type Run struct {
+	Text   string
+	Offset int    // byte offset of the run within the text
+	Script string // OpenType script tag or "" if unknown
+}
+
+// Itemize splits a text into runs of the same script. Characters which are
+// shared by many scripts, like spaces, digits and punctuation, belong to
+// the surrounding run.
+func Itemize(text string) []Run {
+	var runs []Run
+	start, script := 0, ""
+	for pos, r := range text {
+		s := otf.ScriptTag(r)
+		if s == "" || s == script {
+			continue
+		}
+		if script != "" {
+			runs = append(runs, Run{text[start:pos], start, script})
+			start = pos
+		}
+		script = s
+	}
+	if start < len(text) {
+		runs = append(runs, Run{text[start:], start, script})
+	}
+	return runs
+}
+
+// Shape converts a text into positioned glyphs using the given OpenType
+// features. If the context has no script, the text is itemized first and
+// every run is shaped with the script detected for it. The clusters of the
+// glyphs are byte offsets into the text and right-to-left runs are
+// returned in visual order.
+//
+// The direction overrides the direction of the script, which is useful
+// for text whose embedding level was resolved by the bidi package.
+// Mirrored characters, like parentheses, are replaced in right-to-left
+// text.
+func Shape(c *otf.Context, text string, dir bidi.Direction, features ...string) []otf.Glyph {
+	user := otf.ParseFeatures(features...)
+	if c.Script != "" {
+		return shapeRun(direct(c, dir), text, 0, user)
+	}
+	runs := Itemize(text)
+	if dir == bidi.RightToLeft {
+		for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+			runs[i], runs[j] = runs[j], runs[i]
+		}
+	}
+	var glyphs []otf.Glyph
+	for _, run := range runs {
+		rc := direct(c.Font.Context(run.Script, c.Language), dir)
+		glyphs = append(glyphs, shapeRun(rc, run.Text, run.Offset, user)...)
+	}
+	return glyphs
+}
+
+// direct returns a copy of the context with the given direction.
+func direct(c *otf.Context, dir bidi.Direction) *otf.Context {
+	if dir == bidi.Auto {
+		return c
+	}
+	cp := *c
+	cp.RightToLeft = dir == bidi.RightToLeft
+	return &cp
+}
+
+// A shaperFunc shapes a run of text written in a single script.
+type shaperFunc func(c *otf.Context, text string, features []otf.Feature) []otf.Glyph
+
+var shapers = map[string]shaperFunc{
+	"arab": shapeArabic,
+	"mong": shapeArabic,
+	"nko ": shapeArabic,
+	"syrc": shapeArabic,
+}
+
+func init() {
+	for tag := range indicConfigs {
+		shapers[tag] = shapeIndic
+	}
+}
+
+func shapeRun(c *otf.Context, text string, offset int, features []otf.Feature) []otf.Glyph {
+	shape, ok := shapers[c.Script]
+	if !ok {
+		shape = shapeDefault
+	}
+	glyphs := shape(c, text, features)
+	for i := range glyphs {
+		glyphs[i].Cluster += offset
+	}
+	return glyphs
+}
+
+// shapeDefault shapes scripts which do not need any special processing.
+func shapeDefault(c *otf.Context, text string, features []otf.Feature) []otf.Glyph {
+	b := newBuffer(c, text)
+	substitute(c, b, nil, features)
+	return position(c, b, nil, features)
+}
+
+// newBuffer maps the runes of a text to glyphs like otf.Font.NewBuffer,
+// but marks glyphs of default ignorable characters. Characters of
+// right-to-left text are mirrored if the font contains the counterpart.
+func newBuffer(c *otf.Context, text string) *otf.Buffer {
+	b := &otf.Buffer{}
+	for pos, r := range text {
+		m := mask(r, 1)
+		if c.RightToLeft {
+			if mr, ok := bidi.Mirror(r); ok {
+				if c.Font.Index(mr) != 0 {
+					r = mr
+				} else {
+					m |= maskMirror
+				}
+			}
+		}
+		b.Append(c.Font.Index(r), pos, m)
+	}
+	return b
+}
+
+func mask(r rune, m uint32) uint32 {
+	if isIgnorable(r) {
+		m |= maskIgnorable
+	}
+	return m
+}
+
+func isIgnorable(r rune) bool {
+	switch r {
+	case 0x034F, 0x200B, 0x200C, 0x200D, 0x2060, 0xFEFF:
+		return true
+	}
+	return false
+}
+
+// A stage is a set of GSUB features which are applied together. The
+// optional pause function is called afterwards and may modify the buffer.
+type stage struct {
+	features []otf.Feature
+	pause    func(c *otf.Context, b *otf.Buffer)
+}
+
+// substitute applies the GSUB features stage by stage. The features
+// requested by the user are added to the last stage, unless one of the
+// stages already contains them, in which case they only change the value.
+func substitute(c *otf.Context, b *otf.Buffer, stages []stage, user []otf.Feature) {
+	if len(stages) == 0 {
+		stages = []stage{{}}
+	}
+	if c.RightToLeft {
+		c.SubstituteBuffer(b, masked("rtlm", maskMirror))
+	}
+	for i, s := range stages {
+		features := make([]otf.Feature, 0, len(s.features)+len(user))
+		for _, f := range s.features {
+			for _, u := range user {
+				if u.Tag == f.Tag {
+					f.Value = u.Value
+				}
+			}
+			features = append(features, f)
+		}
+		if i == len(stages)-1 {
+			for _, u := range user {
+				if !hasFeature(stages, u.Tag) {
+					features = append(features, u)
+				}
+			}
+		}
+		c.SubstituteBuffer(b, features...)
+		if s.pause != nil {
+			s.pause(c, b)
+		}
+	}
+	removeIgnorables(b)
+}
+
+// position applies the GPOS features together with the user features.
+func position(c *otf.Context, b *otf.Buffer, features []otf.Feature, user []otf.Feature) []otf.Glyph {
+	list := make([]otf.Feature, 0, len(features)+len(user))
+	list = append(list, features...)
+	return c.PositionBuffer(b, append(list, user...)...)
+}
+
+func hasFeature(stages []stage, tag string) bool {
+	for _, s := range stages {
+		for _, f := range s.features {
+			if f.Tag == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeIgnorables removes the glyphs of default ignorable characters.
+func removeIgnorables(b *otf.Buffer) {
+	n := 0
+	for i := range b.Glyphs {
+		if b.Masks[i]&maskIgnorable == 0 {
+			b.Glyphs[n], b.Clusters[n], b.Masks[n] = b.Glyphs[i], b.Clusters[i], b.Masks[i]
+			n++
+		}
+	}
+	b.Glyphs, b.Clusters, b.Masks = b.Glyphs[:n], b.Clusters[:n], b.Masks[:n]
+}
+
+// features returns a list of features which are applied to all glyphs.
+func features(tags ...string) []otf.Feature {
+	list := make([]otf.Feature, len(tags))
+	for i, tag := range tags {
+		list[i] = otf.Feature{Tag: tag, Value: 1}
+	}
+	return list
+}
+
+// masked returns a feature which is only applied to glyphs with the mask.
+func masked(tag string, mask uint32) otf.Feature {
+	return otf.Feature{Tag: tag, Value: 1, Mask: mask}
+}
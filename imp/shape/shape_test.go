@@ -0,0 +1,209 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package shape
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/tux21b/imp/imp/bidi"
+	"github.com/tux21b/imp/imp/otf"
+)
+
+// A table is a font table which is written field by field.
+type table []byte
+
+func (t *table) u16(values ...int) {
+	for _, v := range values {
+		*t = append(*t, byte(v>>8), byte(v))
+	}
+}
+
+func (t *table) u32(values ...int) {
+	for _, v := range values {
+		*t = append(*t, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
+
+// A lookup of the test font replaces single glyphs (kind 1) or sequences
+// of glyphs (kind 4) if the feature is applied. The substitutions map a
+// glyph to its substitute, or the first glyph of a sequence to the
+// ligature followed by the remaining glyphs of the sequence.
+type lookup struct {
+	feature string
+	kind    int
+	subst   map[otf.Index][]otf.Index
+}
+
+// subtable returns the lookup subtable with the coverage at its end.
+func (l lookup) subtable() table {
+	var keys []int
+	for g := range l.subst {
+		keys = append(keys, int(g))
+	}
+	sort.Ints(keys)
+	cov := table{}
+	cov.u16(1, len(keys))
+	cov.u16(keys...)
+
+	t := table{}
+	if l.kind == 1 {
+		t.u16(2, 6+2*len(keys), len(keys))
+		for _, g := range keys {
+			t.u16(int(l.subst[otf.Index(g)][0]))
+		}
+		return append(t, cov...)
+	}
+	// one ligature set per first glyph, with a single ligature each
+	t.u16(1, 0, len(keys))
+	offset := 6 + 2*len(keys)
+	var sets table
+	for _, g := range keys {
+		t.u16(offset + len(sets))
+		lig := l.subst[otf.Index(g)]
+		sets.u16(1, 4, int(lig[0]), len(lig))
+		for _, c := range lig[1:] {
+			sets.u16(int(c))
+		}
+	}
+	t = append(t, sets...)
+	t[2], t[3] = byte(len(t)>>8), byte(len(t))
+	return append(t, cov...)
+}
+
+// gsubTable returns a GSUB table with one feature per lookup for the
+// default script.
+func gsubTable(lookups []lookup) table {
+	n := len(lookups)
+	scripts := table{}
+	scripts.u16(1)
+	scripts = append(scripts, "DFLT"...)
+	scripts.u16(8, 4, 0, 0, 0xffff, n)
+	for i := range lookups {
+		scripts.u16(i)
+	}
+
+	features := table{}
+	features.u16(n)
+	for i, l := range lookups {
+		features = append(features, l.feature...)
+		features.u16(2 + 6*n + 6*i)
+	}
+	for i := range lookups {
+		features.u16(0, 1, i)
+	}
+
+	list := table{}
+	list.u16(n)
+	var subtables table
+	for _, l := range lookups {
+		list.u16(2 + 2*n + len(subtables))
+		sub := l.subtable()
+		subtables.u16(l.kind, 0, 1, 8)
+		subtables = append(subtables, sub...)
+	}
+	list = append(list, subtables...)
+
+	t := table{}
+	t.u32(0x00010000)
+	t.u16(10, 10+len(scripts), 10+len(scripts)+len(features))
+	t = append(t, scripts...)
+	t = append(t, features...)
+	return append(t, list...)
+}
+
+// cmapTable returns a cmap table with a format 12 subtable.
+func cmapTable(runes map[rune]otf.Index) table {
+	var keys []int
+	for r := range runes {
+		keys = append(keys, int(r))
+	}
+	sort.Ints(keys)
+	t := table{}
+	t.u16(0, 1, 3, 10)
+	t.u32(12)
+	t.u16(12, 0)
+	t.u32(16+12*len(keys), 0, len(keys))
+	for _, r := range keys {
+		t.u32(r, r, int(runes[rune(r)]))
+	}
+	return t
+}
+
+// testFont returns the bundled font with a new cmap and GSUB table. None
+// of the bundled fonts covers the complex scripts, so their characters are
+// mapped to arbitrary glyphs of the font.
+func testFont(t *testing.T, runes map[rune]otf.Index, lookups []lookup) *otf.Font {
+	data, err := ioutil.ReadFile("../../fonts/SourceSansPro-Regular.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := make(map[string][]byte)
+	for i := 0; i < int(binary.BigEndian.Uint16(data[4:])); i++ {
+		x := 12 + 16*i
+		offset := binary.BigEndian.Uint32(data[x+8:])
+		length := binary.BigEndian.Uint32(data[x+12:])
+		tables[string(data[x:x+4])] = data[offset : offset+length]
+	}
+	delete(tables, "GDEF")
+	delete(tables, "GPOS")
+	tables["cmap"] = cmapTable(runes)
+	tables["GSUB"] = gsubTable(lookups)
+
+	var names []string
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sfnt := table{}
+	sfnt.u32(0x4f54544f)
+	sfnt.u16(len(names), 0, 0, 0)
+	offset := 12 + 16*len(names)
+	for _, name := range names {
+		sfnt = append(sfnt, name...)
+		sfnt.u32(0, offset, len(tables[name]))
+		offset += (len(tables[name]) + 3) &^ 3
+	}
+	for _, name := range names {
+		sfnt = append(sfnt, tables[name]...)
+		for len(sfnt)%4 != 0 {
+			sfnt = append(sfnt, 0)
+		}
+	}
+	f, err := otf.Parse(sfnt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// glyphs returns the glyphs of the shaped text in logical order.
+func glyphs(f *otf.Font, text string) []otf.Index {
+	var list []otf.Index
+	for _, g := range Shape(f.Context("", ""), text, bidi.LeftToRight) {
+		list = append(list, g.Index)
+	}
+	return list
+}
+
+func TestItemize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Run
+	}{
+		{"", nil},
+		{"abc", []Run{{"abc", 0, "latn"}}},
+		{"1, 2", []Run{{"1, 2", 0, ""}}},
+		{"ab سلام.", []Run{{"ab ", 0, "latn"}, {"سلام.", 3, "arab"}}},
+		{"कि a", []Run{{"कि ", 0, "deva"}, {"a", 7, "latn"}}},
+	}
+	for _, test := range tests {
+		if got := Itemize(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Itemize(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
@@ -4,16 +4,33 @@
 package text
 
 import (
+	"bufio"
+	"io"
 	"sort"
 	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 )
 
+// A Hyphenator finds the points where words can be hyphenated using the
+// patterns of Liang's algorithm and a list of exceptions.
 type Hyphenator struct {
-	entries hEntries
+	// LeftMin and RightMin are the minimal number of letters before the
+	// first and after the last hyphen, like \lefthyphenmin and
+	// \righthyphenmin in TeX. They do not apply to exceptions.
+	LeftMin, RightMin int
+
+	entries    hEntries
+	maxLen     int              // number of letters of the longest pattern
+	exceptions map[string][]int // break points of the exceptions
 }
 
+// NewHyphenator returns a hyphenator for the given patterns. The minimums
+// are set to TeX's defaults of two letters before and three letters after
+// a hyphen.
 func NewHyphenator(patterns []string) *Hyphenator {
-	h := &Hyphenator{}
+	h := &Hyphenator{LeftMin: 2, RightMin: 3}
 	for i := range patterns {
 		h.addPattern(patterns[i])
 	}
@@ -41,17 +58,125 @@ func (h *Hyphenator) addPattern(pattern string) {
 		points = append(points, 0)
 	}
 	h.entries = append(h.entries, hEntry{string(chars), points})
+	if len(chars) > h.maxLen {
+		h.maxLen = len(chars)
+	}
+}
+
+// ReadHyphenator reads hyphenation patterns in the format of TeX, like the
+// hyph-*.pat.txt files of the hyph-utf8 project. The patterns are separated
+// by white space and comments start with %.
+func ReadHyphenator(r io.Reader) (*Hyphenator, error) {
+	patterns, err := readWords(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewHyphenator(patterns), nil
+}
+
+// ReadExceptions adds the words in r as exceptions, like the words of the
+// hyph-*.hyp.txt files. See AddException.
+func (h *Hyphenator) ReadExceptions(r io.Reader) error {
+	words, err := readWords(r)
+	for _, word := range words {
+		h.AddException(word)
+	}
+	return err
+}
+
+func readWords(r io.Reader) ([]string, error) {
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '%'); i >= 0 {
+			line = line[:i]
+		}
+		words = append(words, strings.Fields(line)...)
+	}
+	return words, scanner.Err()
 }
 
+// AddException overrides the patterns for a word, like \hyphenation in TeX.
+// The word is hyphenated only at the given hyphens, e.g. "ta-ble". A word
+// without hyphens is never hyphenated. Exceptions ignore the case.
+func (h *Hyphenator) AddException(word string) {
+	if h.exceptions == nil {
+		h.exceptions = make(map[string][]int)
+	}
+	var points []int
+	var runes []rune
+	for _, r := range word {
+		if r != '-' {
+			runes = append(runes, unicode.ToLower(r))
+		} else if len(runes) > 0 && (len(points) == 0 || points[len(points)-1] != len(runes)) {
+			points = append(points, len(runes))
+		}
+	}
+	if len(points) > 0 && points[len(points)-1] == len(runes) {
+		points = points[:len(points)-1]
+	}
+	h.exceptions[string(runes)] = points
+}
+
+// Clone returns a copy of h whose exceptions can be changed without
+// affecting h.
+func (h *Hyphenator) Clone() *Hyphenator {
+	c := *h
+	c.exceptions = make(map[string][]int)
+	for word, points := range h.exceptions {
+		c.exceptions[word] = points
+	}
+	return &c
+}
+
+// Hyphenate splits the word at the points where it can be hyphenated.
+// Punctuation at the start and the end of the word stays with the first
+// and the last piece.
 func (h *Hyphenator) Hyphenate(word string) []string {
-	if len([]rune(word)) < 4 {
+	start := strings.IndexFunc(word, isLetter)
+	if start < 0 {
 		return []string{word}
 	}
-	search := "." + strings.ToLower(word) + ".."
-	points := make([]int, len(search))
+	end := strings.LastIndexFunc(word, isLetter)
+	_, n := utf8.DecodeRuneInString(word[end:])
+	end += n
+
+	// offsets of the runes of the word without punctuation
+	var offs []int
+	var lower []rune
+	for i, r := range word[start:end] {
+		offs = append(offs, start+i)
+		lower = append(lower, unicode.ToLower(r))
+	}
+	offs = append(offs, end)
+
+	breaks, ok := h.exceptions[string(lower)]
+	if !ok {
+		breaks = h.breaks(lower)
+	}
+	pieces := make([]string, 0, len(breaks)+1)
+	last := 0
+	for _, b := range breaks {
+		pieces = append(pieces, word[last:offs[b]])
+		last = offs[b]
+	}
+	return append(pieces, word[last:])
+}
+
+// breaks returns the indices of the runes of a lower case word before which
+// the word can be hyphenated according to the patterns.
+func (h *Hyphenator) breaks(word []rune) []int {
+	if len(word) < h.LeftMin+h.RightMin {
+		return nil
+	}
+	search := make([]rune, 0, len(word)+2)
+	search = append(append(append(search, '.'), word...), '.')
+	// points[i] is the value before search[i]
+	points := make([]int, len(search)+1)
 	for i := range search {
-		for j := range search[i:] {
-			entry := h.entries.Find(search[i : i+j])
+		for j := i + 1; j <= len(search) && j-i <= h.maxLen; j++ {
+			entry := h.entries.Find(string(search[i:j]))
 			if entry == nil {
 				continue
 			}
@@ -62,20 +187,24 @@ func (h *Hyphenator) Hyphenate(word string) []string {
 			}
 		}
 	}
-	points[1], points[2] = 0, 0
-	points[len(points)-2], points[len(points)-3] = 0, 0
-	points = points[2:]
-
-	var pieces []string
-	last := 0
-	for i := range points {
-		if points[i]%2 == 1 {
-			pieces = append(pieces, word[last:i+1])
-			last = i + 1
+	left, right := h.LeftMin, h.RightMin
+	if left < 1 {
+		left = 1
+	}
+	if right < 1 {
+		right = 1
+	}
+	var breaks []int
+	for i := left; i <= len(word)-right; i++ {
+		if points[i+1]%2 == 1 {
+			breaks = append(breaks, i)
 		}
 	}
-	pieces = append(pieces, word[last:])
-	return pieces
+	return breaks
+}
+
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r)
 }
 
 type hEntry struct {
@@ -107,10 +236,42 @@ func (p hEntries) Find(word string) *hEntry {
 
 var defaultHyphenator = NewHyphenator(strings.Fields(patterns))
 
+// Hyphenate splits an English word at the points where it can be
+// hyphenated.
 func Hyphenate(word string) []string {
 	return defaultHyphenator.Hyphenate(word)
 }
 
+var (
+	hyphenatorsMu sync.RWMutex
+	hyphenators   = map[string]*Hyphenator{"en": defaultHyphenator}
+)
+
+// RegisterHyphenator makes h the hyphenator of a language, which is given
+// as ISO 639 code, e.g. "de" or "de-CH". A previously registered hyphenator
+// of the language is replaced. The English patterns are registered as "en".
+func RegisterHyphenator(lang string, h *Hyphenator) {
+	hyphenatorsMu.Lock()
+	defer hyphenatorsMu.Unlock()
+	hyphenators[strings.ToLower(lang)] = h
+}
+
+// HyphenatorFor returns the hyphenator of a language or nil. Regional
+// variants without a hyphenator of their own, like "de-AT", use the
+// hyphenator of the language.
+func HyphenatorFor(lang string) *Hyphenator {
+	hyphenatorsMu.RLock()
+	defer hyphenatorsMu.RUnlock()
+	lang = strings.ToLower(strings.Replace(lang, "_", "-", -1))
+	if h, ok := hyphenators[lang]; ok {
+		return h
+	}
+	if i := strings.IndexByte(lang, '-'); i >= 0 {
+		return hyphenators[lang[:i]]
+	}
+	return nil
+}
+
 /*
 Knuth and Liang's original hyphenation patterns from classic TeX.
 In the public domain.
@@ -0,0 +1,156 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package text
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// germanPatterns are a few patterns in the format of hyph-de-1996.pat.txt.
+// Liang's algorithm allows a break for odd values only, so 2ß1s moves the
+// break before ß which 1ß would allow in Maßstab after it.
+const germanPatterns = `% German patterns for the tests
+1ß 2ß1s
+1ser
+ü1b
+`
+
+func germanHyphenator(t *testing.T) *Hyphenator {
+	h, err := ReadHyphenator(strings.NewReader(germanPatterns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.RightMin = 2 // like \righthyphenmin in babel's german
+	return h
+}
+
+func TestHyphenate(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"hyphenation", []string{"hy", "phen", "ation"}},
+		{"algorithm", []string{"al", "go", "rithm"}},
+		{"computer", []string{"com", "puter"}},
+		{"concatenation", []string{"con", "cate", "na", "tion"}},
+		{"university", []string{"uni", "ver", "sity"}},
+		{"table", []string{"table"}},
+		{"Hyphenation", []string{"Hy", "phen", "ation"}},
+		{"(hyphenation),", []string{"(hy", "phen", "ation),"}},
+		{`"computer"`, []string{`"com`, `puter"`}},
+		{"...", []string{"..."}},
+		{"", []string{""}},
+	}
+	for _, test := range tests {
+		if got := Hyphenate(test.word); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.word, got, test.want)
+		}
+	}
+}
+
+func TestHyphenateGerman(t *testing.T) {
+	h := germanHyphenator(t)
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"Straße", []string{"Stra", "ße"}},
+		{"Größe", []string{"Grö", "ße"}},
+		{"Maßstab", []string{"Maß", "stab"}},
+		{"Häuser", []string{"Häu", "ser"}},
+		{"HÄUSER", []string{"HÄU", "SER"}},
+		{"„Größe“,", []string{"„Grö", "ße“,"}},
+		{"(Straße)", []string{"(Stra", "ße)"}},
+		{"Übung", []string{"Übung"}},
+	}
+	for _, test := range tests {
+		if got := h.Hyphenate(test.word); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.word, got, test.want)
+		}
+	}
+}
+
+func TestHyphenateMin(t *testing.T) {
+	tests := []struct {
+		word        string
+		left, right int
+		want        []string
+	}{
+		{"Übung", 2, 2, []string{"Übung"}},
+		{"Übung", 1, 2, []string{"Ü", "bung"}},
+		{"Häuser", 2, 3, []string{"Häu", "ser"}},
+		{"Häuser", 2, 4, []string{"Häuser"}},
+		{"Häuser", 4, 2, []string{"Häuser"}},
+		{"Größe", 2, 2, []string{"Grö", "ße"}},
+		{"Größe", 2, 3, []string{"Größe"}},
+	}
+	for _, test := range tests {
+		h := germanHyphenator(t)
+		h.LeftMin, h.RightMin = test.left, test.right
+		if got := h.Hyphenate(test.word); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q with minimums %d and %d: got %q, want %q",
+				test.word, test.left, test.right, got, test.want)
+		}
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	h := germanHyphenator(t)
+	h.AddException("Stra-ße")
+	h.AddException("Maßstab")
+	h.AddException("ü-ber")
+	err := h.ReadExceptions(strings.NewReader("% exceptions\nHäu-ser\nGrö-ße-re\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"Straße.", []string{"Stra", "ße."}},
+		{"STRASSE", []string{"STRASSE"}},
+		{"Maßstab", []string{"Maßstab"}},
+		{"über", []string{"ü", "ber"}}, // the minimums do not apply
+		{"Häuser", []string{"Häu", "ser"}},
+		{"größere", []string{"grö", "ße", "re"}},
+		{"Größe", []string{"Grö", "ße"}},
+	}
+	for _, test := range tests {
+		if got := h.Hyphenate(test.word); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.word, got, test.want)
+		}
+	}
+
+	c := h.Clone()
+	c.AddException("Größe")
+	if got := h.Hyphenate("Größe"); len(got) != 2 {
+		t.Errorf("the exceptions of a clone change the original: got %q", got)
+	}
+	if got := c.Hyphenate("Größe"); len(got) != 1 {
+		t.Errorf("clone: got %q, want the word unhyphenated", got)
+	}
+}
+
+func TestHyphenatorFor(t *testing.T) {
+	h := NewHyphenator(nil)
+	RegisterHyphenator("xt", h)
+	tests := []struct {
+		lang string
+		want *Hyphenator
+	}{
+		{"en", defaultHyphenator},
+		{"xt", h},
+		{"XT", h},
+		{"xt-CH", h},
+		{"xt_AT", h},
+		{"xx", nil},
+	}
+	for _, test := range tests {
+		if got := HyphenatorFor(test.lang); got != test.want {
+			t.Errorf("%q: got %p, want %p", test.lang, got, test.want)
+		}
+	}
+}
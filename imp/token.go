@@ -0,0 +1,153 @@
+// Copyright (c) 2014 by Christoph Hack <christoph@tux21b.org>
+// All rights reserved. Distributed under the Simplified BSD License.
+
+package imp
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tux21b/imp/imp/otf"
+)
+
+// A Token is an element of a document. Plug-ins add their own tokens by
+// implementing Inline.
+type Token interface{}
+
+// A LineBreak ends a line. Forced line breaks, like \break, end the line
+// without justifying it.
+type LineBreak struct {
+	Forced bool
+}
+
+type ParagraphBreak struct{}
+
+// A CanBreak is a point where a line can be broken. Before ends the line if
+// it is broken there and NoBreak is set otherwise. Both may be nil.
+type CanBreak struct {
+	Before  Token
+	NoBreak Token
+	After   Token
+}
+
+type Text string
+
+type Space string
+
+// paragraph reports whether the space contains an empty line, which ends
+// the paragraph.
+func (s Space) paragraph() bool {
+	return strings.Count(string(s), "\n") >= 2
+}
+
+type Macro string
+
+// A Param is a parameter #1 to #9 in the body of a macro definition.
+type Param int
+
+type SetTextColor struct {
+	C, M, Y, K float32
+}
+
+type ColBreak struct{}
+
+// A Problem is reported as a diagnostic at its position when the macros are
+// expanded. LexMarkdown uses it for elements which cannot be displayed.
+type Problem string
+
+type PageBreak struct{}
+
+type SetFont struct {
+	Font *otf.Font
+	Size int
+}
+
+type StateAction func(s *State)
+
+// BeginGroup and EndGroup enclose a group. Changes of the style within a
+// group are undone at its end.
+type BeginGroup struct{}
+
+type EndGroup struct{}
+
+// A Pos is a byte offset in the source of a document. Pos tokens are
+// placed before the tokens which originate from that position.
+type Pos int
+
+// Lex splits the input into tokens. Every token except spaces is preceded
+// by its position.
+func Lex(input string) []Token {
+	var tokens []Token
+	pos := 0
+	for pos < len(input) {
+		r, n := utf8.DecodeRuneInString(input[pos:])
+		if isBreakingSpace(r) {
+			end := pos + n
+			for end < len(input) {
+				r, n := utf8.DecodeRuneInString(input[end:])
+				if !isBreakingSpace(r) {
+					break
+				}
+				end += n
+			}
+			tokens = append(tokens, Space(input[pos:end]))
+			pos = end
+			continue
+		}
+		tokens = append(tokens, Pos(pos))
+		if r == '#' && pos+n < len(input) && input[pos+n] >= '1' && input[pos+n] <= '9' {
+			tokens = append(tokens, Param(input[pos+n]-'0'))
+			pos += n + 1
+		} else if r == '{' {
+			tokens = append(tokens, BeginGroup{})
+			pos += n
+		} else if r == '}' {
+			tokens = append(tokens, EndGroup{})
+			pos += n
+		} else if r == '\\' {
+			end := pos + n
+			for end < len(input) {
+				r, n := utf8.DecodeRuneInString(input[end:])
+				if !unicode.IsLetter(r) {
+					break
+				}
+				end += n
+			}
+			if end == pos+n && end < len(input) {
+				// a single symbol, like \{, is a macro too
+				_, n := utf8.DecodeRuneInString(input[end:])
+				tokens = append(tokens, Macro(input[pos:end+n]))
+				pos = end + n
+				continue
+			}
+			tokens = append(tokens, Macro(input[pos:end]))
+			pos = end
+			for pos < len(input) {
+				r, n := utf8.DecodeRuneInString(input[pos:])
+				if !isBreakingSpace(r) {
+					break
+				}
+				pos += n
+			}
+		} else {
+			end := pos + n
+			for end < len(input) {
+				r, n := utf8.DecodeRuneInString(input[end:])
+				if isBreakingSpace(r) || r == '\\' || r == '{' || r == '}' || r == '#' {
+					break
+				}
+				end += n
+			}
+			tokens = append(tokens, Text(input[pos:end]))
+			pos = end
+		}
+	}
+	return tokens
+}
+
+// isBreakingSpace reports whether r is a space at which lines can be broken.
+// No-break spaces, like U+00A0, are part of the text.
+func isBreakingSpace(r rune) bool {
+	return unicode.IsSpace(r) && !isNoBreak(r)
+}